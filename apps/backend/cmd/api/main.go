@@ -25,12 +25,34 @@ func main() {
 	fmt.Printf("   GET    /health                 - Health check\n")
 	fmt.Printf("   POST   /workflow/start         - Run a workflow immediately\n")
 	fmt.Printf("   GET    /workflows/files        - List workflow JSON files\n")
+	fmt.Printf("   POST   /workflows              - Store a workflow (version 1)\n")
+	fmt.Printf("   GET    /workflows              - List stored workflows\n")
+	fmt.Printf("   GET    /workflows/:id          - Inspect a workflow (?version=n)\n")
+	fmt.Printf("   PUT    /workflows/:id          - Save a new workflow version\n")
+	fmt.Printf("   DELETE /workflows/:id          - Delete a workflow and its versions\n")
+	fmt.Printf("   GET    /workflows/:id/versions - List workflow versions\n")
+	fmt.Printf("   GET    /workflows/:id/versions/:version - Inspect one workflow version\n")
+	fmt.Printf("   POST   /workflows/:id/files    - Upload a file (multipart field file)\n")
+	fmt.Printf("   GET    /workflows/:id/files    - List a workflow's files\n")
+	fmt.Printf("   GET    /workflows/:id/files/:fileId - Download a file\n")
+	fmt.Printf("   DELETE /workflows/:id/files/:fileId - Delete a file\n")
 	fmt.Printf("   POST   /instances              - Create a managed workflow instance\n")
 	fmt.Printf("   GET    /instances              - List workflow instances\n")
 	fmt.Printf("   GET    /instances/:id          - Inspect one workflow instance\n")
 	fmt.Printf("   POST   /instances/:id/stop     - Stop a workflow instance\n")
 	fmt.Printf("   GET    /instances/:id/logs     - Read workflow instance logs\n")
 	fmt.Printf("   POST   /instances/:id/enqueue  - Enqueue execution data\n")
+	fmt.Printf("   GET    /instances/:id/executions - Execution history of an instance\n")
+	fmt.Printf("   GET    /instances/:id/dead-letters - Dead letters of an instance\n")
+	fmt.Printf("   POST   /instances/:id/dead-letters/replay - Queue dead letters again\n")
+	fmt.Printf("   POST   /instances/:id/dead-letters/purge  - Delete dead letters\n")
+	fmt.Printf("   GET    /executions             - List execution history\n")
+	fmt.Printf("   POST   /executions             - Start an execution (?wait=true to block)\n")
+	fmt.Printf("   GET    /executions/:id         - Execution status, progress and result\n")
+	fmt.Printf("   POST   /executions/:id/cancel  - Cancel a running execution\n")
+	fmt.Printf("   GET    /executions/:id/events  - Live execution events (SSE)\n")
+	fmt.Printf("   GET    /instances/:id/events   - Live instance events (SSE)\n")
+	fmt.Printf("   ANY    /webhook/*path          - Webhook triggers of running instances\n")
 	fmt.Printf("   GET    /dashboard/metrics      - Dashboard metrics\n")
 	fmt.Printf("🌐 Dashboard: http://localhost:%s/\n", port)
 
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tsinling0525/rivulet/infra"
+)
+
+// deadLetterSelection picks dead letters by ID or all of them
+type deadLetterSelection struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
+func bindDeadLetterSelection(c *gin.Context) (deadLetterSelection, bool) {
+	var sel deadLetterSelection
+	if err := c.ShouldBindJSON(&sel); err != nil {
+		sendError(c, http.StatusBadRequest, "invalid json")
+		return sel, false
+	}
+	if !sel.All && len(sel.IDs) == 0 {
+		sendError(c, http.StatusBadRequest, `expected {"ids": [...]} or {"all": true}`)
+		return sel, false
+	}
+	return sel, true
+}
+
+// deadLetterStatus maps a dead letter error to a status code
+func deadLetterStatus(err error) int {
+	if errors.Is(err, infra.ErrDeadLetterNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// registerDeadLetterRoutes adds browsing, replay and purge of the inputs of
+// an instance's failed executions
+func registerDeadLetterRoutes(r *gin.Engine, mgr *infra.InstanceManager) {
+	r.GET("/instances/:id/dead-letters", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, ok := mgr.Get(id); !ok {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		letters, err := mgr.DeadLetters(id)
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sendSuccess(c, map[string]any{"dead_letters": letters, "count": len(letters)})
+	})
+
+	// POST /instances/:id/dead-letters/replay queues the inputs again as new
+	// executions; body {"ids": [...]} or {"all": true}
+	r.POST("/instances/:id/dead-letters/replay", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, ok := mgr.Get(id); !ok {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		sel, ok := bindDeadLetterSelection(c)
+		if !ok {
+			return
+		}
+		replayed, err := mgr.ReplayDeadLetters(c.Request.Context(), id, sel.IDs, sel.All)
+		if err != nil {
+			if len(replayed) == 0 {
+				sendError(c, deadLetterStatus(err), err.Error())
+				return
+			}
+			sendResponse(c, http.StatusInternalServerError, false, map[string]any{"replayed": replayed}, err.Error())
+			return
+		}
+		sendSuccess(c, map[string]any{"replayed": replayed, "count": len(replayed)})
+	})
+
+	// POST /instances/:id/dead-letters/purge deletes dead letters; body
+	// {"ids": [...]} or {"all": true}
+	r.POST("/instances/:id/dead-letters/purge", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, ok := mgr.Get(id); !ok {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		sel, ok := bindDeadLetterSelection(c)
+		if !ok {
+			return
+		}
+		n, err := mgr.PurgeDeadLetters(id, sel.IDs, sel.All)
+		if err != nil {
+			sendError(c, deadLetterStatus(err), err.Error())
+			return
+		}
+		sendSuccess(c, map[string]any{"purged": n})
+	})
+}
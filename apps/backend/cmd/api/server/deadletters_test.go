@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+func TestDeadLetterRoutes(t *testing.T) {
+	r, mgr := newTestRouter(t)
+	all := map[string]any{"all": true}
+
+	for _, path := range []string{"/instances/missing/dead-letters", "/instances/missing/dead-letters/replay", "/instances/missing/dead-letters/purge"} {
+		method := http.MethodPost
+		if path == "/instances/missing/dead-letters" {
+			method = http.MethodGet
+		}
+		if w := serveJSON(r, method, path, all); w.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: %d", method, path, w.Code)
+		}
+	}
+
+	inst, err := mgr.CreateFromWorkflowPath(writeWorkflow(t, "broken.json", n8n.N8nWorkflow{
+		ID:       "broken",
+		Nodes:    []n8n.N8nNode{{ID: "n", Name: "N", Type: "test:fail"}},
+		Settings: map[string]any{"queue": map[string]any{"max_attempts": 1}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopInstances(mgr, inst)
+	if _, err := mgr.Enqueue(context.Background(), inst.ID, map[string]model.Items{"n": {{"x": 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	// the start-up run fails as well
+	base := "/instances/" + inst.ID + "/dead-letters"
+	var letters []any
+	for deadline := time.Now().Add(2 * time.Second); len(letters) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		letters, _ = decode(t, serve(r, http.MethodGet, base, nil)).Data["dead_letters"].([]any)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("expected two dead letters, got %v", letters)
+	}
+
+	if w := serveJSON(r, http.MethodPost, base+"/purge", map[string]any{}); w.Code != http.StatusBadRequest {
+		t.Fatalf("purge without a selection: %d", w.Code)
+	}
+	if w := serveJSON(r, http.MethodPost, base+"/replay", map[string]any{"ids": []string{"missing"}}); w.Code != http.StatusNotFound {
+		t.Fatalf("replay of an unknown dead letter: %d", w.Code)
+	}
+	w := serveJSON(r, http.MethodPost, base+"/purge", all)
+	if resp := decode(t, w); w.Code != http.StatusOK || resp.Data["purged"] != float64(2) {
+		t.Fatalf("purge: %d %+v", w.Code, resp)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tsinling0525/rivulet/infra"
+)
+
+// sseKeepAlive is how often an idle stream gets a comment line so proxies
+// don't close it
+const sseKeepAlive = 15 * time.Second
+
+func writeSSE(w io.Writer, ev infra.Event) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+}
+
+// streamEvents writes events as Server-Sent Events until last reports the
+// final event, the client goes away or the subscription closes
+func streamEvents(c *gin.Context, events <-chan infra.Event, last func(infra.Event) bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			writeSSE(w, ev)
+			return !last(ev)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// sendFinalEvent answers a stream request for something that has already
+// finished with a single event
+func sendFinalEvent(c *gin.Context, event string, fields map[string]any) {
+	events := make(chan infra.Event, 1)
+	events <- infra.Event{Type: event, At: time.Now().UTC(), Fields: fields}
+	streamEvents(c, events, func(infra.Event) bool { return true })
+}
+
+func registerEventRoutes(r *gin.Engine, mgr *infra.InstanceManager) {
+	// GET /executions/:id/events follows one execution until it finishes
+	r.GET("/executions/:id/events", func(c *gin.Context) {
+		id := c.Param("id")
+		// subscribe before looking at the status so the final event can't be missed
+		events, cancel := mgr.Events().Subscribe(func(ev infra.Event) bool { return ev.ExecID() == id }, 0)
+		defer cancel()
+		rec, progress, err := mgr.Execution(id)
+		if errors.Is(err, infra.ErrExecutionNotFound) {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// queued executions are followed like running ones
+		if progress == nil && rec.Status != infra.ExecutionQueued {
+			sendFinalEvent(c, "execution_finished", map[string]any{"exec": id, "status": rec.Status, "error": rec.Error})
+			return
+		}
+		streamEvents(c, events, func(ev infra.Event) bool { return ev.Type == "execution_finished" })
+	})
+
+	// GET /instances/:id/events follows every execution of an instance until it stops
+	r.GET("/instances/:id/events", func(c *gin.Context) {
+		id := c.Param("id")
+		events, cancel := mgr.Events().Subscribe(func(ev infra.Event) bool { return ev.InstanceID() == id }, 0)
+		defer cancel()
+		inst, ok := mgr.Get(id)
+		if !ok {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		if inst.Snapshot().State == infra.InstanceStopped {
+			sendFinalEvent(c, "instance_stopped", map[string]any{"instance": id})
+			return
+		}
+		streamEvents(c, events, func(ev infra.Event) bool { return ev.Type == "instance_stopped" })
+	})
+}
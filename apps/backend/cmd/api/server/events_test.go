@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/infra"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+func TestEventRoutes(t *testing.T) {
+	r, mgr := newTestRouter(t)
+
+	if w := serve(r, http.MethodGet, "/executions/missing/events", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("events of an unknown execution: %d", w.Code)
+	}
+	if w := serve(r, http.MethodGet, "/instances/missing/events", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("events of an unknown instance: %d", w.Code)
+	}
+
+	inst, err := mgr.CreateFromWorkflowPath(writeWorkflow(t, "greet.json", n8n.N8nWorkflow{
+		ID:    "greet",
+		Nodes: []n8n.N8nNode{{ID: "a", Name: "A", Type: "echo"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an enqueued execution can be followed as soon as its ID is known,
+	// whether it has started yet or not
+	execID, err := mgr.Enqueue(context.Background(), inst.ID, map[string]model.Items{"a": {{"x": 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(r, http.MethodGet, "/executions/"+execID+"/events", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "event: execution_finished") {
+		t.Fatalf("events of %s: %d %s", execID, w.Code, w.Body)
+	}
+
+	_ = mgr.Stop(inst.ID)
+	for deadline := time.Now().Add(2 * time.Second); inst.Snapshot().State != infra.InstanceStopped && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	w = serve(r, http.MethodGet, "/instances/"+inst.ID+"/events", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "event: instance_stopped") {
+		t.Fatalf("events of a stopped instance: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tsinling0525/rivulet/infra"
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// downloadURL is where the contents of a binary reference can be fetched
+func downloadURL(ref model.BinaryRef) string {
+	return fmt.Sprintf("/workflows/%s/files/%s", url.PathEscape(string(ref.WorkflowID)), url.PathEscape(ref.FileID))
+}
+
+// withDownloadLinks encodes v as JSON, adding a download_url to every
+// binary reference in it. Responses without references are passed as-is.
+func withDownloadLinks(v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil || !bytes.Contains(body, []byte(`"`+model.BinaryKey+`"`)) {
+		return body, err
+	}
+	var generic any
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(addDownloadLinks(generic))
+}
+
+func addDownloadLinks(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		if ref, ok := model.AsBinaryRef(x); ok {
+			x["download_url"] = downloadURL(ref)
+			return x
+		}
+		for k, e := range x {
+			x[k] = addDownloadLinks(e)
+		}
+	case []any:
+		for i, e := range x {
+			x[i] = addDownloadLinks(e)
+		}
+	}
+	return v
+}
+
+// fileOpener is implemented by stores that can stream a file's contents
+type fileOpener interface {
+	Open(ctx context.Context, workflowID, fileID string) (model.FileMeta, *os.File, error)
+}
+
+func fileJSON(workflowID string, m model.FileMeta) map[string]any {
+	return map[string]any{
+		"id":           m.ID,
+		"name":         m.Name,
+		"size":         m.Size,
+		"media_type":   m.MediaType,
+		"created_at":   m.CreatedAt,
+		"download_url": downloadURL(model.BinaryRef{WorkflowID: model.ID(workflowID), FileID: m.ID}),
+	}
+}
+
+func sendFileError(c *gin.Context, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		sendError(c, http.StatusNotFound, "not found")
+		return
+	}
+	sendError(c, http.StatusInternalServerError, err.Error())
+}
+
+func registerFileRoutes(r *gin.Engine, mgr *infra.InstanceManager) {
+	files := mgr.Files()
+
+	// POST /workflows/:id/files stores the multipart "file" field; the
+	// media type comes from the part, or the file extension
+	r.POST("/workflows/:id/files", func(c *gin.Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			sendError(c, http.StatusBadRequest, "multipart field \"file\" is required")
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer f.Close()
+		contents, err := io.ReadAll(f)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		mediaType := c.PostForm("media_type")
+		if mediaType == "" {
+			mediaType = fh.Header.Get("Content-Type")
+		}
+		if mediaType == "" || mediaType == "application/octet-stream" {
+			if byExt := mime.TypeByExtension(filepath.Ext(fh.Filename)); byExt != "" {
+				mediaType = byExt
+			}
+		}
+		ref, err := plugin.StoreBinary(c.Request.Context(), files, model.ID(c.Param("id")), filepath.Base(fh.Filename), contents, mediaType)
+		if err != nil {
+			sendFileError(c, err)
+			return
+		}
+		sendResponse(c, http.StatusCreated, true, map[string]any{"file_id": ref.FileID, "file": ref}, "")
+	})
+
+	r.GET("/workflows/:id/files", func(c *gin.Context) {
+		metas, err := files.List(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			sendFileError(c, err)
+			return
+		}
+		sort.Slice(metas, func(i, j int) bool { return metas[i].CreatedAt.Before(metas[j].CreatedAt) })
+		out := make([]map[string]any, 0, len(metas))
+		for _, m := range metas {
+			out = append(out, fileJSON(c.Param("id"), m))
+		}
+		sendSuccess(c, map[string]any{"files": out})
+	})
+
+	// GET /workflows/:id/files/:fileId streams a stored file with its
+	// media type; range requests are supported when the store can open it
+	r.GET("/workflows/:id/files/:fileId", func(c *gin.Context) {
+		ctx, workflowID, fileID := c.Request.Context(), c.Param("id"), c.Param("fileId")
+		disposition := func(name string) {
+			c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		}
+		if opener, ok := files.(fileOpener); ok {
+			meta, f, err := opener.Open(ctx, workflowID, fileID)
+			if err != nil {
+				sendFileError(c, err)
+				return
+			}
+			defer f.Close()
+			c.Header("Content-Type", mediaTypeOr(meta.MediaType))
+			disposition(meta.Name)
+			http.ServeContent(c.Writer, c.Request, meta.Name, meta.CreatedAt, f)
+			return
+		}
+		name, mediaType, contents, err := files.Get(ctx, workflowID, fileID)
+		if err != nil {
+			sendFileError(c, err)
+			return
+		}
+		disposition(name)
+		c.Data(http.StatusOK, mediaTypeOr(mediaType), contents)
+	})
+
+	r.DELETE("/workflows/:id/files/:fileId", func(c *gin.Context) {
+		ctx, workflowID, fileID := c.Request.Context(), c.Param("id"), c.Param("fileId")
+		if err := files.Delete(ctx, workflowID, fileID); err != nil {
+			sendFileError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"deleted": fileID})
+	})
+}
+
+func mediaTypeOr(mediaType string) string {
+	if mediaType == "" {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
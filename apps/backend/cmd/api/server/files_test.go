@@ -0,0 +1,49 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestFileRoutes(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	if w := serve(r, http.MethodPost, "/workflows/docs/files", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("upload without a file: %d", w.Code)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("hello"))
+	mw.Close()
+	w := serve(r, http.MethodPost, "/workflows/docs/files", &body, "Content-Type", mw.FormDataContentType())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: %d %s", w.Code, w.Body)
+	}
+	id, _ := decode(t, w).Data["file_id"].(string)
+
+	w = serve(r, http.MethodGet, "/workflows/docs/files", nil)
+	if files, _ := decode(t, w).Data["files"].([]any); w.Code != http.StatusOK || len(files) != 1 {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	w = serve(r, http.MethodGet, "/workflows/docs/files/"+id, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("download: %d %q %v", w.Code, w.Body, w.Header())
+	}
+	// files belong to the workflow they were uploaded for
+	if w := serve(r, http.MethodGet, "/workflows/other/files/"+id, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("download from another workflow: %d", w.Code)
+	}
+	if w := serve(r, http.MethodDelete, "/workflows/docs/files/"+id, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := serve(r, http.MethodGet, "/workflows/docs/files/"+id, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("download after delete: %d", w.Code)
+	}
+	if w := serve(r, http.MethodDelete, "/workflows/docs/files/"+id, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("second delete: %d", w.Code)
+	}
+}
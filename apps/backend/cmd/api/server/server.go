@@ -2,10 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,8 +15,8 @@ import (
 	"github.com/Tsinling0525/rivulet/engine"
 	"github.com/Tsinling0525/rivulet/format/n8n"
 	"github.com/Tsinling0525/rivulet/infra"
-	apiinfra "github.com/Tsinling0525/rivulet/infra/api"
 	_ "github.com/Tsinling0525/rivulet/nodes/echo"
+	_ "github.com/Tsinling0525/rivulet/nodes/exec"
 	_ "github.com/Tsinling0525/rivulet/nodes/files"
 	_ "github.com/Tsinling0525/rivulet/nodes/fs"
 	_ "github.com/Tsinling0525/rivulet/nodes/http"
@@ -22,7 +24,8 @@ import (
 	_ "github.com/Tsinling0525/rivulet/nodes/merge"
 	_ "github.com/Tsinling0525/rivulet/nodes/ollama"
 	_ "github.com/Tsinling0525/rivulet/nodes/openai"
-	"github.com/Tsinling0525/rivulet/plugin"
+	_ "github.com/Tsinling0525/rivulet/nodes/python"
+	_ "github.com/Tsinling0525/rivulet/nodes/trigger"
 )
 
 // APIRequest represents the request to start a workflow
@@ -38,7 +41,12 @@ type APIResponse struct {
 // Helper function to send JSON response
 func sendResponse(c *gin.Context, statusCode int, success bool, data map[string]interface{}, errorMsg string) {
 	response := APIResponse{Success: success, Data: data, Error: errorMsg}
-	c.JSON(statusCode, response)
+	body, err := withDownloadLinks(response)
+	if err != nil {
+		c.JSON(statusCode, response)
+		return
+	}
+	c.Data(statusCode, "application/json; charset=utf-8", body)
 }
 
 func sendSuccess(c *gin.Context, data map[string]interface{}) {
@@ -48,27 +56,139 @@ func sendError(c *gin.Context, statusCode int, errorMsg string) {
 	sendResponse(c, statusCode, false, nil, errorMsg)
 }
 
+// sendDiagnostics reports workflow validation problems as a 400
+func sendDiagnostics(c *gin.Context, diags engine.Diagnostics) {
+	sendResponse(c, http.StatusBadRequest, false, map[string]interface{}{"diagnostics": diags}, diags.Err().Error())
+}
+
 // Handlers
 func handleHealth(c *gin.Context) {
 	sendSuccess(c, map[string]interface{}{"status": "healthy", "timestamp": time.Now().Unix(), "version": "1.0.0"})
 }
 
-func handleStartWorkflow(c *gin.Context) {
-	var req APIRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid JSON: "+err.Error())
-		return
+// handleStartWorkflow runs a workflow and answers once it has finished. The
+// run is detached from the request, so a dropped connection does not kill it.
+func handleStartWorkflow(mgr *infra.InstanceManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req APIRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			sendError(c, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		workflow, inputData := n8n.ToRivulet(req)
+		if diags := engine.Validate(workflow); len(diags) > 0 {
+			sendDiagnostics(c, diags)
+			return
+		}
+		executionID := newExecutionID()
+		mgr.Submit(executionID, "", workflow, inputData)
+		rec, err := mgr.Wait(c.Request.Context(), executionID)
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sendSuccess(c, map[string]interface{}{"executionId": executionID, "result": rec.Result, "lineage": rec.Lineage})
 	}
-	workflow, inputData := n8n.ToRivulet(req)
-	deps := plugin.Deps{State: apiinfra.MemState{}, Bus: apiinfra.NullBus{}, Files: infra.NewLocalFiles()}
-	eng := engine.New(deps)
-	executionID := fmt.Sprintf("exec-%d", time.Now().Unix())
-	result, err := eng.Run(c.Request.Context(), executionID, workflow, inputData)
-	if err != nil {
-		sendError(c, http.StatusInternalServerError, err.Error())
-		return
+}
+
+func newExecutionID() string { return fmt.Sprintf("exec-%d", time.Now().UnixNano()) }
+
+// executionRequest is the body of POST /executions: an inline n8n workflow,
+// or a stored workflow by ID and optional version
+type executionRequest struct {
+	APIRequest
+	WorkflowID string `json:"workflow_id"`
+	Version    int    `json:"version"`
+}
+
+// handleSubmitExecution starts an execution and returns its ID right away,
+// or waits for the result with ?wait=true
+func handleSubmitExecution(mgr *infra.InstanceManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req executionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			sendError(c, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		versionID := ""
+		if req.WorkflowID != "" {
+			w, err := mgr.ResolveWorkflow(c.Request.Context(), req.WorkflowID)
+			if err != nil {
+				sendWorkflowError(c, err)
+				return
+			}
+			v, err := mgr.ResolveVersion(c.Request.Context(), w.ID, req.Version)
+			if err != nil {
+				sendWorkflowError(c, err)
+				return
+			}
+			if err := json.Unmarshal(v.Config, &req.Workflow); err != nil {
+				sendError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			versionID = v.ID
+		}
+		workflow, inputData := n8n.ToRivulet(req.APIRequest)
+		if diags := engine.Validate(workflow); len(diags) > 0 {
+			sendDiagnostics(c, diags)
+			return
+		}
+		executionID := newExecutionID()
+		mgr.Submit(executionID, versionID, workflow, inputData)
+		if c.Query("wait") != "true" {
+			sendResponse(c, http.StatusAccepted, true, map[string]any{"execution_id": executionID, "status": infra.ExecutionRunning}, "")
+			return
+		}
+		rec, err := mgr.Wait(c.Request.Context(), executionID)
+		if err != nil && rec.ExecutionID == "" {
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sendSuccess(c, map[string]any{"execution_id": executionID, "execution": rec})
+	}
+}
+
+// parseHistoryQuery reads status, since, until, limit and offset query
+// parameters; times are RFC3339 or unix seconds
+func parseHistoryQuery(c *gin.Context) (infra.HistoryQuery, error) {
+	q := infra.HistoryQuery{Status: infra.ExecutionStatus(c.Query("status")), Limit: 50}
+	parseTime := func(name string) (time.Time, error) {
+		v := c.Query(name)
+		if v == "" {
+			return time.Time{}, nil
+		}
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(secs, 0), nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		return t, nil
+	}
+	var err error
+	if q.Since, err = parseTime("since"); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTime("until"); err != nil {
+		return q, err
 	}
-	sendSuccess(c, map[string]interface{}{"executionId": executionID, "result": result})
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("invalid limit: %q", v)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("invalid offset: %q", v)
+		}
+	}
+	return q, nil
+}
+
+func listExecutions(c *gin.Context, history *infra.ExecutionHistory, q infra.HistoryQuery) {
+	recs, total := history.List(q)
+	sendSuccess(c, map[string]any{"executions": recs, "total": total, "limit": q.Limit, "offset": q.Offset})
 }
 
 func listWorkflowFiles() ([]map[string]any, error) {
@@ -115,14 +235,16 @@ func avgDurationMS(stats infra.InstanceStats) int64 {
 }
 
 // NewRouter builds the Gin router with routes and middleware
-func NewRouter() *gin.Engine {
+func NewRouter() *gin.Engine { return newRouter(infra.NewInstanceManager()) }
+
+func newRouter(mgr *infra.InstanceManager) *gin.Engine {
 	r := gin.Default()
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 	// CORS
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -131,9 +253,9 @@ func NewRouter() *gin.Engine {
 		c.Next()
 	})
 
-	// Routes (start-only API)
+	// Routes
 	r.GET("/health", handleHealth)
-	r.POST("/workflow/start", handleStartWorkflow)
+	r.POST("/workflow/start", handleStartWorkflow(mgr))
 	r.GET("/workflows/files", func(c *gin.Context) {
 		workflows, err := listWorkflowFiles()
 		if err != nil {
@@ -142,9 +264,11 @@ func NewRouter() *gin.Engine {
 		}
 		sendSuccess(c, map[string]any{"workflows": workflows})
 	})
-
-	// Instance Manager
-	mgr := infra.NewInstanceManager()
+	registerWorkflowRoutes(r, mgr)
+	registerFileRoutes(r, mgr)
+	registerEventRoutes(r, mgr)
+	registerWebhookRoutes(r, mgr)
+	registerDeadLetterRoutes(r, mgr)
 
 	frontendDir := infra.FrontendDir()
 	if stat, err := os.Stat(frontendDir); err == nil && stat.IsDir() {
@@ -154,16 +278,34 @@ func NewRouter() *gin.Engine {
 		})
 	}
 
+	// POST /instances runs either a workflow file or a stored workflow,
+	// pinned to "version" or following the latest one when it is omitted
 	r.POST("/instances", func(c *gin.Context) {
 		var payload struct {
 			WorkflowPath string `json:"workflow_path"`
+			WorkflowID   string `json:"workflow_id"`
+			Version      int    `json:"version"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil || (payload.WorkflowPath == "") == (payload.WorkflowID == "") {
+			sendError(c, http.StatusBadRequest, "one of workflow_path or workflow_id is required")
+			return
 		}
-		if err := c.ShouldBindJSON(&payload); err != nil || payload.WorkflowPath == "" {
-			sendError(c, http.StatusBadRequest, "workflow_path is required")
+		if payload.WorkflowID != "" {
+			inst, err := mgr.CreateFromStoredWorkflow(c.Request.Context(), payload.WorkflowID, payload.Version)
+			if err != nil {
+				sendWorkflowError(c, err)
+				return
+			}
+			sendSuccess(c, map[string]interface{}{"id": inst.ID, "state": inst.State, "name": inst.Name, "workflow_id": inst.StoredWorkflowID, "pinned_version": inst.PinnedVersion})
 			return
 		}
 		inst, err := mgr.CreateFromWorkflowPath(payload.WorkflowPath)
 		if err != nil {
+			var verr *engine.ValidationError
+			if errors.As(err, &verr) {
+				sendDiagnostics(c, verr.Diagnostics)
+				return
+			}
 			sendError(c, http.StatusBadRequest, err.Error())
 			return
 		}
@@ -203,13 +345,16 @@ func NewRouter() *gin.Engine {
 			"created_at":    inst.CreatedAt.Unix(),
 			"workflow_path": inst.WorkflowPath,
 			"workflow": map[string]any{
-				"id":         inst.Workflow.ID,
-				"name":       inst.Workflow.Name,
-				"node_count": len(inst.Workflow.Nodes),
-				"edge_count": len(inst.Workflow.Edges),
+				"id":             snapshot.Workflow.ID,
+				"name":           snapshot.Workflow.Name,
+				"stored_id":      inst.StoredWorkflowID,
+				"version":        snapshot.Version,
+				"pinned_version": inst.PinnedVersion,
+				"node_count":     len(snapshot.Workflow.Nodes),
+				"edge_count":     len(snapshot.Workflow.Edges),
 				"nodes": func() []map[string]any {
-					nodes := make([]map[string]any, 0, len(inst.Workflow.Nodes))
-					for _, node := range inst.Workflow.Nodes {
+					nodes := make([]map[string]any, 0, len(snapshot.Workflow.Nodes))
+					for _, node := range snapshot.Workflow.Nodes {
 						nodes = append(nodes, map[string]any{
 							"id":   node.ID,
 							"name": node.Name,
@@ -229,6 +374,9 @@ func NewRouter() *gin.Engine {
 			},
 			"execution_status": snapshot.Active,
 			"last_execution":   snapshot.LastRun,
+			"schedules":        snapshot.Schedules,
+			"webhooks":         snapshot.Webhooks,
+			"watches":          snapshot.Watches,
 		})
 	})
 
@@ -275,16 +423,74 @@ func NewRouter() *gin.Engine {
 					}
 				}
 			}
-			if err := mgr.Enqueue(id, inputs); err != nil {
+			execID, err := mgr.Enqueue(c.Request.Context(), id, inputs)
+			if err != nil {
 				sendError(c, http.StatusBadRequest, err.Error())
 				return
 			}
-			sendSuccess(c, map[string]any{"enqueued": true})
+			sendSuccess(c, map[string]any{"enqueued": true, "execution_id": execID})
 			return
 		}
 		sendError(c, http.StatusBadRequest, "missing data field: expected {data: {...}}")
 	})
 
+	r.GET("/instances/:id/executions", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, ok := mgr.Get(id); !ok {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		q, err := parseHistoryQuery(c)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.InstanceID = id
+		listExecutions(c, mgr.History(), q)
+	})
+
+	r.GET("/executions", func(c *gin.Context) {
+		q, err := parseHistoryQuery(c)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.InstanceID = c.Query("instance_id")
+		listExecutions(c, mgr.History(), q)
+	})
+
+	r.POST("/executions", handleSubmitExecution(mgr))
+
+	r.GET("/executions/:id", func(c *gin.Context) {
+		rec, progress, err := mgr.Execution(c.Param("id"))
+		if errors.Is(err, infra.ErrExecutionNotFound) {
+			sendError(c, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		data := map[string]any{"execution": rec, "status": rec.Status}
+		if progress != nil {
+			data["progress"] = progress
+		}
+		sendSuccess(c, data)
+	})
+
+	r.POST("/executions/:id/cancel", func(c *gin.Context) {
+		switch err := mgr.Cancel(c.Param("id")); {
+		case errors.Is(err, infra.ErrExecutionNotFound):
+			sendError(c, http.StatusNotFound, "not found")
+		case errors.Is(err, infra.ErrExecutionFinished):
+			sendError(c, http.StatusConflict, err.Error())
+		case err != nil:
+			sendError(c, http.StatusInternalServerError, err.Error())
+		default:
+			sendSuccess(c, map[string]any{"cancelled": true})
+		}
+	})
+
 	r.GET("/dashboard/metrics", func(c *gin.Context) {
 		metrics := mgr.DashboardMetrics()
 		sendSuccess(c, map[string]any{"metrics": metrics})
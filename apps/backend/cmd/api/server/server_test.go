@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/infra"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+}
+
+// newTestRouter serves the API from a fresh data directory
+func newTestRouter(t *testing.T) (*gin.Engine, *infra.InstanceManager) {
+	t.Helper()
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	mgr := infra.NewInstanceManager()
+	return newRouter(mgr), mgr
+}
+
+// serve sends one request; header holds name, value pairs
+func serve(r http.Handler, method, path string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(closeNotifier{w}, req)
+	return w
+}
+
+// closeNotifier lets a recorder serve gin streams, which need CloseNotify
+type closeNotifier struct{ *httptest.ResponseRecorder }
+
+func (closeNotifier) CloseNotify() <-chan bool { return make(chan bool) }
+
+func serveJSON(r http.Handler, method, path string, v any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(v)
+	return serve(r, method, path, bytes.NewReader(b), "Content-Type", "application/json")
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) APIResponse {
+	t.Helper()
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+// writeWorkflow stores wf as a workflow file and returns its path
+func writeWorkflow(t *testing.T, name string, wf n8n.N8nWorkflow) string {
+	t.Helper()
+	b, _ := json.Marshal(n8n.N8nRequest{Workflow: wf})
+	if err := os.MkdirAll(infra.WorkflowsDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(infra.WorkflowsDir(), name)
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var echoRequest = APIRequest{Workflow: n8n.N8nWorkflow{
+	ID:    "greet",
+	Nodes: []n8n.N8nNode{{ID: "a", Name: "A", Type: "echo"}},
+}}
+
+func TestExecutionRoutes(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	if w := serve(r, http.MethodGet, "/executions/missing", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown execution: %d", w.Code)
+	}
+	if w := serve(r, http.MethodPost, "/executions/missing/cancel", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("cancel of an unknown execution: %d", w.Code)
+	}
+	if w := serve(r, http.MethodPost, "/executions", bytes.NewBufferString("{"), "Content-Type", "application/json"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid body: %d", w.Code)
+	}
+
+	w := serveJSON(r, http.MethodPost, "/executions?wait=true", echoRequest)
+	if w.Code != http.StatusOK {
+		t.Fatalf("submit: %d %s", w.Code, w.Body)
+	}
+	id, _ := decode(t, w).Data["execution_id"].(string)
+	w = serve(r, http.MethodGet, "/executions/"+id, nil)
+	if resp := decode(t, w); w.Code != http.StatusOK || resp.Data["status"] != string(infra.ExecutionSucceeded) {
+		t.Fatalf("status of %s: %d %+v", id, w.Code, resp)
+	}
+	if w := serve(r, http.MethodPost, "/executions/"+id+"/cancel", nil); w.Code != http.StatusConflict {
+		t.Fatalf("cancel of a finished execution: %d", w.Code)
+	}
+}
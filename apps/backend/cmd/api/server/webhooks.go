@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tsinling0525/rivulet/infra"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// maxWebhookBody caps the request bodies webhooks accept
+const maxWebhookBody = 10 << 20
+
+// webhookItem turns a request into the item a trigger:webhook node emits.
+// JSON and form bodies are decoded, anything else is kept as text.
+func webhookItem(c *gin.Context, params map[string]string) (model.Item, error) {
+	raw, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		return nil, err
+	}
+	var body any
+	if len(raw) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			if err := json.Unmarshal(raw, &body); err != nil {
+				return nil, err
+			}
+		case mediaType == "application/x-www-form-urlencoded":
+			form, err := url.ParseQuery(string(raw))
+			if err != nil {
+				return nil, err
+			}
+			body = firstValues(form)
+		default:
+			body = string(raw)
+		}
+	}
+	headers := map[string]any{}
+	for k, v := range c.Request.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ", ")
+	}
+	p := map[string]any{}
+	for k, v := range params {
+		p[k] = v
+	}
+	return model.Item{
+		"method":  c.Request.Method,
+		"path":    strings.Trim(c.Param("path"), "/"),
+		"params":  p,
+		"query":   firstValues(c.Request.URL.Query()),
+		"headers": headers,
+		"body":    body,
+	}, nil
+}
+
+// firstValues flattens form values, keeping lists only for repeated keys
+func firstValues(values url.Values) map[string]any {
+	out := make(map[string]any, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			out[k] = v[0]
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func registerWebhookRoutes(r *gin.Engine, mgr *infra.InstanceManager) {
+	// /webhook/<path> serves the trigger:webhook nodes of running instances
+	r.Any("/webhook/*path", func(c *gin.Context) {
+		hook, params, err := mgr.MatchWebhook(c.Request.Method, c.Param("path"))
+		switch {
+		case errors.Is(err, infra.ErrWebhookMethod):
+			sendError(c, http.StatusMethodNotAllowed, err.Error())
+			return
+		case err != nil:
+			sendError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		if !hook.Authorize(c.Request) {
+			if hook.Auth.Type == "basic" {
+				c.Header("WWW-Authenticate", `Basic realm="webhook"`)
+			}
+			sendError(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		item, err := webhookItem(c, params)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		execID, resp, err := mgr.TriggerWebhook(c.Request.Context(), hook, item)
+		switch {
+		case errors.Is(err, infra.ErrWebhookTimeout):
+			sendResponse(c, http.StatusGatewayTimeout, false, map[string]any{"execution_id": execID}, err.Error())
+			return
+		case errors.Is(err, context.Canceled):
+			return
+		case err != nil && execID == "":
+			sendError(c, http.StatusServiceUnavailable, err.Error())
+			return
+		case err != nil:
+			sendResponse(c, http.StatusInternalServerError, false, map[string]any{"execution_id": execID}, err.Error())
+			return
+		case resp == nil:
+			sendResponse(c, http.StatusAccepted, true, map[string]any{"execution_id": execID}, "")
+			return
+		}
+		for k, v := range resp.Headers {
+			c.Header(k, v)
+		}
+		c.Header("X-Execution-Id", execID)
+		c.Status(resp.Status)
+		_, _ = c.Writer.Write(resp.Body)
+	})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/infra"
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// blockNode holds its execution until it is cancelled
+type blockNode struct{}
+
+func (blockNode) Init(context.Context, plugin.Deps) error { return nil }
+func (blockNode) Process(ctx context.Context, _ model.Workflow, _ model.Node, _ model.Items) (model.Items, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// failNode fails every execution
+type failNode struct{}
+
+func (failNode) Init(context.Context, plugin.Deps) error { return nil }
+func (failNode) Process(context.Context, model.Workflow, model.Node, model.Items) (model.Items, error) {
+	return nil, errors.New("broken")
+}
+
+func init() {
+	plugin.Register("test:block", func() plugin.NodeHandler { return blockNode{} })
+	plugin.Register("test:fail", func() plugin.NodeHandler { return failNode{} })
+}
+
+// hookWorkflow is a webhook trigger on path followed by a node of type next
+func hookWorkflow(path string, hook map[string]any, next string, settings map[string]any) n8n.N8nWorkflow {
+	hook["path"] = path
+	return n8n.N8nWorkflow{
+		ID: path,
+		Nodes: []n8n.N8nNode{
+			{ID: "hook", Name: "Hook", Type: "trigger:webhook", Parameters: hook},
+			{ID: "next", Name: "Next", Type: next},
+		},
+		Connections: map[string]n8n.N8nConnections{"hook": {Main: [][]n8n.N8nConnection{{{Node: "next", Type: "main"}}}}},
+		Settings:    settings,
+	}
+}
+
+// stopInstances stops the instances and waits until their queues are closed
+func stopInstances(mgr *infra.InstanceManager, insts ...*infra.Instance) {
+	for _, inst := range insts {
+		_ = mgr.Stop(inst.ID)
+	}
+	for _, inst := range insts {
+		for deadline := time.Now().Add(2 * time.Second); inst.Snapshot().State != infra.InstanceStopped && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestWebhookStatusCodes(t *testing.T) {
+	r, mgr := newTestRouter(t)
+	var insts []*infra.Instance
+	for name, wf := range map[string]n8n.N8nWorkflow{
+		"sync.json": hookWorkflow("sync", map[string]any{
+			"response_mode": "last_node",
+			"auth":          map[string]any{"type": "basic", "username": "u", "password": "p"},
+		}, "echo", nil),
+		"async.json":  hookWorkflow("async", map[string]any{}, "test:block", map[string]any{"queue": map[string]any{"capacity": 1, "overflow": "reject"}}),
+		"slow.json":   hookWorkflow("slow", map[string]any{"response_mode": "last_node", "response_timeout": "50ms"}, "test:block", nil),
+		"broken.json": hookWorkflow("broken", map[string]any{"response_mode": "last_node"}, "test:fail", nil),
+	} {
+		inst, err := mgr.CreateFromWorkflowPath(writeWorkflow(t, name, wf))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		insts = append(insts, inst)
+	}
+	defer stopInstances(mgr, insts...)
+
+	post := func(path, body string, header ...string) (int, APIResponse, http.Header) {
+		w := serve(r, http.MethodPost, path, bytes.NewBufferString(body), header...)
+		// answered executions send their own body
+		var resp APIResponse
+		if w.Code != http.StatusOK {
+			resp = decode(t, w)
+		}
+		return w.Code, resp, w.Header()
+	}
+	auth := []string{"Authorization", "Basic dTpw", "Content-Type", "application/json"}
+
+	if code, _, _ := post("/webhook/missing", ""); code != http.StatusNotFound {
+		t.Errorf("unknown path: %d", code)
+	}
+	if w := serve(r, http.MethodGet, "/webhook/sync", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong method: %d", w.Code)
+	}
+	if code, _, header := post("/webhook/sync", "{}"); code != http.StatusUnauthorized || header.Get("WWW-Authenticate") == "" {
+		t.Errorf("missing credentials: %d %v", code, header)
+	}
+	if code, _, _ := post("/webhook/sync", "{", auth...); code != http.StatusBadRequest {
+		t.Errorf("invalid JSON body: %d", code)
+	}
+	if code, _, header := post("/webhook/sync", `{"x": 1}`, auth...); code != http.StatusOK || header.Get("X-Execution-Id") == "" {
+		t.Errorf("answered webhook: %d %v", code, header)
+	}
+
+	// the first job holds the only place in the queue
+	if code, resp, _ := post("/webhook/async", ""); code != http.StatusAccepted || resp.Data["execution_id"] == nil {
+		t.Errorf("queued webhook: %d %+v", code, resp)
+	}
+	if code, resp, _ := post("/webhook/async", ""); code != http.StatusServiceUnavailable || resp.Data["execution_id"] != nil {
+		t.Errorf("full queue: %d %+v", code, resp)
+	}
+
+	if code, resp, _ := post("/webhook/slow", ""); code != http.StatusGatewayTimeout || resp.Data["execution_id"] == nil {
+		t.Errorf("timed out webhook: %d %+v", code, resp)
+	}
+	if code, resp, _ := post("/webhook/broken", ""); code != http.StatusInternalServerError || resp.Data["execution_id"] == nil {
+		t.Errorf("failed execution: %d %+v", code, resp)
+	}
+}
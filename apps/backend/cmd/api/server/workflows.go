@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/infra"
+	"github.com/Tsinling0525/rivulet/infra/repository"
+)
+
+// workflowPayload is the body of POST /workflows and PUT /workflows/:id
+type workflowPayload struct {
+	Workflow    n8n.N8nWorkflow `json:"workflow"`
+	Description string          `json:"description"`
+	Changelog   string          `json:"changelog"`
+}
+
+// sendWorkflowError maps stored-workflow errors to status codes
+func sendWorkflowError(c *gin.Context, err error) {
+	var verr *engine.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		sendDiagnostics(c, verr.Diagnostics)
+	case errors.Is(err, infra.ErrNoDatabase):
+		sendError(c, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		sendError(c, http.StatusNotFound, "not found")
+	case errors.Is(err, infra.ErrWorkflowExists):
+		sendError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, infra.ErrReservedWorkflowID):
+		sendError(c, http.StatusBadRequest, err.Error())
+	default:
+		sendError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// registerWorkflowRoutes adds the stored workflow CRUD API. Workflows are
+// addressed by their definition ID or database ID; every create or update
+// stores a new immutable version.
+func registerWorkflowRoutes(r *gin.Engine, mgr *infra.InstanceManager) {
+	r.POST("/workflows", func(c *gin.Context) {
+		var p workflowPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			sendError(c, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		w, v, err := mgr.CreateWorkflow(c.Request.Context(), p.Workflow, p.Description, p.Changelog)
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendResponse(c, http.StatusCreated, true, map[string]any{"workflow": w, "version": v}, "")
+	})
+
+	r.GET("/workflows", func(c *gin.Context) {
+		repo := mgr.Repository()
+		if repo == nil {
+			sendWorkflowError(c, infra.ErrNoDatabase)
+			return
+		}
+		list, err := repo.ListWorkflows(c.Request.Context())
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"workflows": list})
+	})
+
+	// GET /workflows/:id returns the latest version, or ?version=n
+	r.GET("/workflows/:id", func(c *gin.Context) {
+		n, err := strconv.Atoi(c.DefaultQuery("version", "0"))
+		if err != nil || n < 0 {
+			sendError(c, http.StatusBadRequest, "invalid version")
+			return
+		}
+		w, err := mgr.ResolveWorkflow(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		v, err := mgr.ResolveVersion(c.Request.Context(), w.ID, n)
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"workflow": w, "version": v})
+	})
+
+	r.PUT("/workflows/:id", func(c *gin.Context) {
+		var p workflowPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			sendError(c, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		w, v, err := mgr.UpdateWorkflow(c.Request.Context(), c.Param("id"), p.Workflow, p.Description, p.Changelog)
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"workflow": w, "version": v})
+	})
+
+	r.DELETE("/workflows/:id", func(c *gin.Context) {
+		if err := mgr.DeleteWorkflow(c.Request.Context(), c.Param("id")); err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"deleted": true})
+	})
+
+	r.GET("/workflows/:id/versions", func(c *gin.Context) {
+		w, err := mgr.ResolveWorkflow(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		versions, err := mgr.Repository().ListVersions(c.Request.Context(), w.ID)
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"workflow": w, "versions": versions})
+	})
+
+	r.GET("/workflows/:id/versions/:version", func(c *gin.Context) {
+		n, err := strconv.Atoi(c.Param("version"))
+		if err != nil || n < 1 {
+			sendError(c, http.StatusBadRequest, "invalid version")
+			return
+		}
+		w, err := mgr.ResolveWorkflow(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		v, err := mgr.ResolveVersion(c.Request.Context(), w.ID, n)
+		if err != nil {
+			sendWorkflowError(c, err)
+			return
+		}
+		sendSuccess(c, map[string]any{"workflow": w, "version": v})
+	})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+)
+
+func TestWorkflowRoutes(t *testing.T) {
+	r, _ := newTestRouter(t)
+	greet := workflowPayload{Workflow: echoRequest.Workflow}
+
+	if w := serveJSON(r, http.MethodPost, "/workflows", greet); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	if w := serveJSON(r, http.MethodPost, "/workflows", greet); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate create: %d", w.Code)
+	}
+	reserved := workflowPayload{Workflow: n8n.N8nWorkflow{ID: "file:greet", Nodes: greet.Workflow.Nodes}}
+	if w := serveJSON(r, http.MethodPost, "/workflows", reserved); w.Code != http.StatusBadRequest {
+		t.Fatalf("create with a reserved ID: %d", w.Code)
+	}
+	invalid := workflowPayload{Workflow: n8n.N8nWorkflow{ID: "bad", Nodes: []n8n.N8nNode{{ID: "a", Name: "A", Type: "no-such-type"}}}}
+	if w := serveJSON(r, http.MethodPost, "/workflows", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("create of an invalid workflow: %d", w.Code)
+	}
+
+	if w := serveJSON(r, http.MethodPut, "/workflows/greet", workflowPayload{Workflow: greet.Workflow, Changelog: "again"}); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	w := serve(r, http.MethodGet, "/workflows/greet/versions", nil)
+	if versions, _ := decode(t, w).Data["versions"].([]any); w.Code != http.StatusOK || len(versions) != 2 {
+		t.Fatalf("versions: %d %s", w.Code, w.Body)
+	}
+	if w := serve(r, http.MethodGet, "/workflows/greet/versions/1", nil); w.Code != http.StatusOK {
+		t.Fatalf("version 1: %d", w.Code)
+	}
+	for path, code := range map[string]int{
+		"/workflows/greet/versions/0":   http.StatusBadRequest,
+		"/workflows/greet/versions/9":   http.StatusNotFound,
+		"/workflows/greet?version=-1":   http.StatusBadRequest,
+		"/workflows/missing":            http.StatusNotFound,
+		"/workflows/missing/versions":   http.StatusNotFound,
+		"/workflows/missing/versions/1": http.StatusNotFound,
+	} {
+		if w := serve(r, http.MethodGet, path, nil); w.Code != code {
+			t.Fatalf("GET %s: %d, want %d", path, w.Code, code)
+		}
+	}
+
+	if w := serve(r, http.MethodDelete, "/workflows/greet", nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := serve(r, http.MethodDelete, "/workflows/greet", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("second delete: %d", w.Code)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -19,6 +23,7 @@ import (
 
 	"github.com/Tsinling0525/rivulet/cmd/api/server"
 	_ "github.com/Tsinling0525/rivulet/nodes/echo"
+	_ "github.com/Tsinling0525/rivulet/nodes/exec"
 	_ "github.com/Tsinling0525/rivulet/nodes/files"
 	_ "github.com/Tsinling0525/rivulet/nodes/fs"
 	_ "github.com/Tsinling0525/rivulet/nodes/http"
@@ -26,6 +31,8 @@ import (
 	_ "github.com/Tsinling0525/rivulet/nodes/merge"
 	_ "github.com/Tsinling0525/rivulet/nodes/ollama"
 	_ "github.com/Tsinling0525/rivulet/nodes/openai"
+	_ "github.com/Tsinling0525/rivulet/nodes/python"
+	_ "github.com/Tsinling0525/rivulet/nodes/trigger"
 )
 
 func runServer() error {
@@ -76,18 +83,36 @@ func main() {
 	case "run":
 		fs := flag.NewFlagSet("run", flag.ExitOnError)
 		file := fs.String("file", "", "Path to n8n workflow JSON")
+		resume := fs.String("resume", "", "Execution ID to resume from its checkpoints")
 		_ = fs.Parse(os.Args[2:])
 		if *file == "" {
 			fmt.Println("--file is required")
 			os.Exit(2)
 		}
-		if err := runFlowFromFile(*file); err != nil {
+		if err := runFlowFromFile(*file, *resume); err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+	case "events":
+		fs := flag.NewFlagSet("events", flag.ExitOnError)
+		execID := fs.String("exec", "", "Execution ID to follow")
+		instID := fs.String("instance", "", "Instance ID to follow")
+		_ = fs.Parse(os.Args[2:])
+		if (*execID == "") == (*instID == "") {
+			fmt.Println("one of --exec or --instance is required")
+			os.Exit(2)
+		}
+		path := "/executions/" + *execID + "/events"
+		if *instID != "" {
+			path = "/instances/" + *instID + "/events"
+		}
+		if err := followEvents(path); err != nil {
 			fmt.Println("error:", err)
 			os.Exit(1)
 		}
 	case "inst":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: rivulet inst <create|ps|stop|logs|enqueue> [args]")
+			fmt.Println("Usage: rivulet inst <create|ps|stop|logs|enqueue|dead-letters|replay|purge> [args]")
 			os.Exit(2)
 		}
 		sub2 := os.Args[2]
@@ -95,12 +120,14 @@ func main() {
 		case "create":
 			fs := flag.NewFlagSet("inst create", flag.ExitOnError)
 			wf := fs.String("workflow", "", "Path to workflow JSON")
+			wfID := fs.String("workflow-id", "", "Stored workflow ID")
+			version := fs.Int("version", 0, "Pin a stored workflow version (default: follow latest)")
 			_ = fs.Parse(os.Args[3:])
-			if *wf == "" {
-				fmt.Println("--workflow is required")
+			if (*wf == "") == (*wfID == "") {
+				fmt.Println("one of --workflow or --workflow-id is required")
 				os.Exit(2)
 			}
-			if err := instCreate(*wf); err != nil {
+			if err := instCreate(*wf, *wfID, *version); err != nil {
 				fmt.Println("error:", err)
 				os.Exit(1)
 			}
@@ -146,10 +173,86 @@ func main() {
 				fmt.Println("error:", err)
 				os.Exit(1)
 			}
+		case "dead-letters":
+			fs := flag.NewFlagSet("inst dead-letters", flag.ExitOnError)
+			id := fs.String("id", "", "Instance ID")
+			_ = fs.Parse(os.Args[3:])
+			if *id == "" {
+				fmt.Println("--id is required")
+				os.Exit(2)
+			}
+			if err := instDeadLetters(*id); err != nil {
+				fmt.Println("error:", err)
+				os.Exit(1)
+			}
+		case "replay", "purge":
+			fs := flag.NewFlagSet("inst "+sub2, flag.ExitOnError)
+			id := fs.String("id", "", "Instance ID")
+			letters := fs.String("letter", "", "Comma-separated dead letter IDs")
+			all := fs.Bool("all", false, "All dead letters of the instance")
+			_ = fs.Parse(os.Args[3:])
+			if *id == "" || (*letters == "") == !*all {
+				fmt.Println("--id and one of --letter or --all are required")
+				os.Exit(2)
+			}
+			if err := instDeadLetterAction(sub2, *id, *letters, *all); err != nil {
+				fmt.Println("error:", err)
+				os.Exit(1)
+			}
+		default:
+			fmt.Println("Usage: rivulet inst <create|ps|stop|logs|enqueue|dead-letters|replay|purge> [args]")
+			os.Exit(2)
+		}
+	case "files":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: rivulet files <put|ls|get|rm> --workflow id [args]")
+			os.Exit(2)
+		}
+		sub2 := os.Args[2]
+		fs := flag.NewFlagSet("files "+sub2, flag.ExitOnError)
+		wfID := fs.String("workflow", "", "Workflow ID the files belong to")
+		var err error
+		switch sub2 {
+		case "put":
+			mediaType := fs.String("media-type", "", "Media type (default: from the file extension)")
+			_ = fs.Parse(os.Args[3:])
+			if *wfID == "" || fs.NArg() == 0 {
+				fmt.Println("Usage: rivulet files put --workflow id [--media-type type] path...")
+				os.Exit(2)
+			}
+			err = filesPut(*wfID, *mediaType, fs.Args())
+		case "ls":
+			_ = fs.Parse(os.Args[3:])
+			if *wfID == "" {
+				fmt.Println("--workflow is required")
+				os.Exit(2)
+			}
+			err = filesLs(*wfID)
+		case "get":
+			id := fs.String("id", "", "File ID")
+			out := fs.String("out", "", "Output path, - for stdout (default: the stored file name)")
+			_ = fs.Parse(os.Args[3:])
+			if *wfID == "" || *id == "" {
+				fmt.Println("--workflow and --id are required")
+				os.Exit(2)
+			}
+			err = filesGet(*wfID, *id, *out)
+		case "rm":
+			id := fs.String("id", "", "File ID")
+			_ = fs.Parse(os.Args[3:])
+			if *wfID == "" || *id == "" {
+				fmt.Println("--workflow and --id are required")
+				os.Exit(2)
+			}
+			err = filesRm(*wfID, *id)
 		default:
-			fmt.Println("Usage: rivulet inst <create|ps|stop|logs|enqueue> [args]")
+			fmt.Println("Usage: rivulet files <put|ls|get|rm> --workflow id [args]")
 			os.Exit(2)
 		}
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
 	default:
 		fmt.Println("Usage:")
 		fmt.Println("  rivulet server             # start API server (foreground)")
@@ -157,7 +260,10 @@ func main() {
 		fmt.Println("  rivulet stop               # stop background daemon")
 		fmt.Println("  rivulet status             # show daemon status")
 		fmt.Println("  rivulet run --file path    # run workflow JSON once")
+		fmt.Println("  rivulet run --file path --resume exec-id  # resume a failed run")
 		fmt.Println("  rivulet inst ...           # manage workflow instances")
+		fmt.Println("  rivulet files ...          # upload, list, download and delete workflow files")
+		fmt.Println("  rivulet events --exec id | --instance id  # follow live events")
 	}
 }
 
@@ -349,6 +455,40 @@ func apiBase() string {
 	return "http://127.0.0.1:" + port
 }
 
+// followEvents prints a Server-Sent Events stream, one line per event,
+// until the server ends it
+func followEvents(path string) error {
+	resp, err := http.Get(apiBase() + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var ev struct {
+			Type   string         `json:"type"`
+			At     time.Time      `json:"at"`
+			Fields map[string]any `json:"fields"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+			continue
+		}
+		delete(ev.Fields, "instance")
+		b, _ := json.Marshal(ev.Fields)
+		fmt.Printf("%s %-20s %s\n", ev.At.Local().Format("15:04:05.000"), ev.Type, b)
+	}
+	return sc.Err()
+}
+
 func httpJSON(method, path string, payload any) (map[string]any, error) {
 	var body *bytes.Reader
 	if payload != nil {
@@ -366,6 +506,12 @@ func httpJSON(method, path string, payload any) (map[string]any, error) {
 	if err != nil {
 		return nil, err
 	}
+	return decodeAPIResponse(resp)
+}
+
+// decodeAPIResponse reads an API envelope and returns its data, or its
+// error message as an error
+func decodeAPIResponse(resp *http.Response) (map[string]any, error) {
 	defer resp.Body.Close()
 	var out map[string]any
 	dec := json.NewDecoder(resp.Body)
@@ -384,8 +530,12 @@ func httpJSON(method, path string, payload any) (map[string]any, error) {
 	return out, nil
 }
 
-func instCreate(path string) error {
-	data, err := httpJSON("POST", "/instances", map[string]string{"workflow_path": path})
+func instCreate(path, workflowID string, version int) error {
+	payload := map[string]any{"workflow_path": path}
+	if workflowID != "" {
+		payload = map[string]any{"workflow_id": workflowID, "version": version}
+	}
+	data, err := httpJSON("POST", "/instances", payload)
 	if err != nil {
 		return err
 	}
@@ -439,3 +589,130 @@ func instEnqueue(id, path string) error {
 	_, err = httpJSON("POST", "/instances/"+id+"/enqueue", payload)
 	return err
 }
+
+func instDeadLetters(id string) error {
+	data, err := httpJSON("GET", "/instances/"+id+"/dead-letters", nil)
+	if err != nil {
+		return err
+	}
+	letters, _ := data["dead_letters"].([]any)
+	for _, it := range letters {
+		m := it.(map[string]any)
+		fmt.Printf("%s\t%s\t%v\t%s\t%s\n", m["id"], m["execution_id"], m["attempts"], m["failed_at"], m["error"])
+	}
+	return nil
+}
+
+// instDeadLetterAction replays or purges the given dead letters, or all
+func instDeadLetterAction(action, id, letters string, all bool) error {
+	payload := map[string]any{"all": all}
+	if !all {
+		payload["ids"] = strings.Split(letters, ",")
+	}
+	data, err := httpJSON("POST", "/instances/"+id+"/dead-letters/"+action, payload)
+	if err != nil {
+		return err
+	}
+	if action == "purge" {
+		fmt.Printf("purged %v dead letter(s)\n", data["purged"])
+		return nil
+	}
+	replayed, _ := data["replayed"].(map[string]any)
+	for letter, execID := range replayed {
+		fmt.Printf("%s\t%s\n", letter, execID)
+	}
+	return nil
+}
+
+// --- File CLI helpers ---
+
+func filesPath(workflowID string) string {
+	return "/workflows/" + url.PathEscape(workflowID) + "/files"
+}
+
+func filesPut(workflowID, mediaType string, paths []string) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(fw, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if mediaType != "" {
+			_ = mw.WriteField("media_type", mediaType)
+		}
+		_ = mw.Close()
+		resp, err := http.Post(apiBase()+filesPath(workflowID), mw.FormDataContentType(), &body)
+		if err != nil {
+			return err
+		}
+		data, err := decodeAPIResponse(resp)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("%s\t%s\n", data["file_id"], path)
+	}
+	return nil
+}
+
+func filesLs(workflowID string) error {
+	data, err := httpJSON("GET", filesPath(workflowID), nil)
+	if err != nil {
+		return err
+	}
+	files, _ := data["files"].([]any)
+	for _, it := range files {
+		m := it.(map[string]any)
+		fmt.Printf("%s\t%v\t%s\t%s\n", m["id"], m["size"], m["media_type"], m["name"])
+	}
+	return nil
+}
+
+func filesGet(workflowID, fileID, out string) error {
+	resp, err := http.Get(apiBase() + filesPath(workflowID) + "/" + url.PathEscape(fileID))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, err := decodeAPIResponse(resp)
+		return err
+	}
+	defer resp.Body.Close()
+	if out == "-" {
+		_, err = io.Copy(os.Stdout, resp.Body)
+		return err
+	}
+	if out == "" {
+		_, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		out = filepath.Base(params["filename"])
+		if out == "" || out == "." || out == string(filepath.Separator) {
+			out = fileID
+		}
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+func filesRm(workflowID, fileID string) error {
+	_, err := httpJSON("DELETE", filesPath(workflowID)+"/"+url.PathEscape(fileID), nil)
+	return err
+}
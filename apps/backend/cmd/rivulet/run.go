@@ -16,7 +16,7 @@ import (
 	"github.com/Tsinling0525/rivulet/plugin"
 )
 
-func runFlowFromFile(path string) error {
+func runFlowFromFile(path, resumeID string) error {
 	f, err := os.ReadFile(path)
 	if err != nil {
 		return err
@@ -29,16 +29,22 @@ func runFlowFromFile(path string) error {
 	deps := pluginDeps()
 	eng := engine.New(deps)
 	execID := fmt.Sprintf("exec-%d", time.Now().UnixNano())
-	res, err := eng.Run(context.Background(), execID, wf, inputs)
+	var res map[model.ID]model.Items
+	if resumeID != "" {
+		execID = resumeID
+		res, err = eng.Resume(context.Background(), execID, wf)
+	} else {
+		res, err = eng.Run(context.Background(), execID, wf, inputs)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("execution %s: %w", execID, err)
 	}
 	fmt.Printf("✅ Execution %s result: %+v\n", execID, res)
 	return nil
 }
 
 func pluginDeps() plugin.Deps {
-	return plugin.Deps{State: apiinfra.MemState{}, Bus: apiinfra.NullBus{}, Files: infra.NewLocalFiles()}
+	return plugin.Deps{State: infra.NewDefaultFileState(), Bus: apiinfra.NullBus{}, Files: infra.NewLocalFiles()}
 }
 
 func runEchoSample() error {
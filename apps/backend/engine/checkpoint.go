@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// Checkpoints live in the StateStore next to node state, under reserved
+// node keys so they can't collide with what nodes save themselves.
+const checkpointPrefix = "_checkpoint/"
+
+var checkpointInputsKey = model.ID(checkpointPrefix + "_inputs")
+
+func checkpointKey(id model.ID) model.ID { return model.ID(checkpointPrefix + string(id)) }
+
+// saveInputs records the execution inputs so Resume can rebuild the run
+func (e *Engine) saveInputs(ctx context.Context, execID string, inputs map[model.ID]model.Items) error {
+	if e.Deps.State == nil {
+		return nil
+	}
+	enc := make(map[string]any, len(inputs))
+	for id, items := range inputs {
+		enc[string(id)] = items
+	}
+	if err := e.Deps.State.SaveNodeState(ctx, execID, checkpointInputsKey, map[string]any{"inputs": enc}); err != nil {
+		return fmt.Errorf("checkpoint inputs: %w", err)
+	}
+	return nil
+}
+
+// saveCheckpoint records a completed node's output on every port
+func (e *Engine) saveCheckpoint(ctx context.Context, execID string, id model.ID, out map[model.Port]model.Items) error {
+	if e.Deps.State == nil {
+		return nil
+	}
+	ports := make(map[string]any, len(out))
+	for p, items := range out {
+		ports[string(p)] = items
+	}
+	state := map[string]any{"completed": true, "outputs": ports}
+	if err := e.Deps.State.SaveNodeState(ctx, execID, checkpointKey(id), state); err != nil {
+		return fmt.Errorf("checkpoint %s: %w", id, err)
+	}
+	return nil
+}
+
+// loadCheckpoints returns the saved inputs and the outputs of every node
+// that completed in a previous attempt of execID
+func (e *Engine) loadCheckpoints(ctx context.Context, execID string, wf model.Workflow) (map[model.ID]model.Items, map[model.ID]map[model.Port]model.Items, error) {
+	if e.Deps.State == nil {
+		return nil, nil, fmt.Errorf("resume %s: no state store configured", execID)
+	}
+	st, err := e.Deps.State.LoadNodeState(ctx, execID, checkpointInputsKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, ok := st["inputs"].(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("resume %s: no checkpoint found", execID)
+	}
+	inputs := make(map[model.ID]model.Items, len(raw))
+	for id, v := range raw {
+		inputs[model.ID(id)] = itemsFromAny(v)
+	}
+
+	done := map[model.ID]map[model.Port]model.Items{}
+	for _, n := range wf.Nodes {
+		st, err := e.Deps.State.LoadNodeState(ctx, execID, checkpointKey(n.ID))
+		if err != nil {
+			return nil, nil, err
+		}
+		if completed, _ := st["completed"].(bool); !completed {
+			continue
+		}
+		ports, _ := st["outputs"].(map[string]any)
+		out := make(map[model.Port]model.Items, len(ports))
+		for p, v := range ports {
+			out[model.Port(p)] = itemsFromAny(v)
+		}
+		done[n.ID] = out
+	}
+	return inputs, done, nil
+}
+
+// itemsFromAny accepts items as stored in memory or decoded from JSON
+func itemsFromAny(v any) model.Items {
+	switch vv := v.(type) {
+	case model.Items:
+		return vv
+	case []any:
+		out := make(model.Items, 0, len(vv))
+		for _, it := range vv {
+			m, _ := it.(map[string]any)
+			out = append(out, m)
+		}
+		return out
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/infra/api"
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+type testState struct {
+	mu sync.Mutex
+	m  map[string]map[model.ID]map[string]any
+}
+
+func (s *testState) SaveNodeState(_ context.Context, execID string, nodeID model.ID, state map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = map[string]map[model.ID]map[string]any{}
+	}
+	if s.m[execID] == nil {
+		s.m[execID] = map[model.ID]map[string]any{}
+	}
+	s.m[execID][nodeID] = state
+	return nil
+}
+
+func (s *testState) LoadNodeState(_ context.Context, execID string, nodeID model.ID) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.m[execID][nodeID]; ok {
+		return st, nil
+	}
+	return map[string]any{}, nil
+}
+
+var (
+	billedCalls int32
+	flakyFail   atomic.Bool
+)
+
+type billedNode struct{}
+
+func (billedNode) Init(context.Context, plugin.Deps) error { return nil }
+func (billedNode) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	atomic.AddInt32(&billedCalls, 1)
+	return model.Items{{"billed": len(in)}}, nil
+}
+
+type flakyNode struct{}
+
+func (flakyNode) Init(context.Context, plugin.Deps) error { return nil }
+func (flakyNode) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	if flakyFail.Load() {
+		return nil, errors.New("crashed")
+	}
+	return in, nil
+}
+
+func init() {
+	plugin.Register("test:billed", func() plugin.NodeHandler { return billedNode{} })
+	plugin.Register("test:flaky", func() plugin.NodeHandler { return flakyNode{} })
+}
+
+func TestResumeSkipsCompletedNodes(t *testing.T) {
+	wf := model.Workflow{
+		ID:    "wf_resume",
+		Nodes: []model.Node{{ID: "llm", Type: "test:billed"}, {ID: "save", Type: "test:flaky"}},
+		Edges: []model.Edge{{FromNode: "llm", FromPort: model.PortMain, ToNode: "save", ToPort: model.PortMain}},
+	}
+	eng := New(plugin.Deps{State: &testState{}, Bus: api.NullBus{}})
+
+	flakyFail.Store(true)
+	if _, err := eng.Run(context.Background(), "exec-r1", wf, map[model.ID]model.Items{"llm": {{"q": 1}}}); err == nil {
+		t.Fatalf("expected first attempt to fail")
+	}
+	if billedCalls != 1 {
+		t.Fatalf("expected one billed call, got %d", billedCalls)
+	}
+
+	flakyFail.Store(false)
+	res, err := eng.Resume(context.Background(), "exec-r1", wf)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if billedCalls != 1 {
+		t.Fatalf("resume re-ran a completed node: %d calls", billedCalls)
+	}
+	if len(res["save"]) != 1 || res["save"][0]["billed"] != 1 {
+		t.Fatalf("unexpected resumed output: %v", res)
+	}
+
+	if _, err := eng.Resume(context.Background(), "exec-unknown", wf); err == nil {
+		t.Fatalf("expected resume without checkpoint to fail")
+	}
+}
+
+func TestResumeStreamingRestartsFromInputs(t *testing.T) {
+	wf := model.Workflow{
+		ID:       "wf_resume_stream",
+		Nodes:    []model.Node{{ID: "src", Type: "test:pass"}, {ID: "save", Type: "test:flaky"}},
+		Edges:    []model.Edge{{FromNode: "src", FromPort: model.PortMain, ToNode: "save", ToPort: model.PortMain}},
+		Settings: map[string]any{"execution_mode": ModeStreaming},
+	}
+	eng := New(plugin.Deps{State: &testState{}, Bus: api.NullBus{}})
+
+	flakyFail.Store(true)
+	if _, err := eng.Run(context.Background(), "exec-rs1", wf, map[model.ID]model.Items{"src": {{"q": 1}, {"q": 2}}}); err == nil {
+		t.Fatalf("expected first attempt to fail")
+	}
+	flakyFail.Store(false)
+	res, err := eng.Resume(context.Background(), "exec-rs1", wf)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(res["save"]) != 2 {
+		t.Fatalf("unexpected resumed output: %v", res)
+	}
+}
@@ -13,6 +13,11 @@ import (
 type Engine struct {
 	Deps    plugin.Deps
 	Options map[model.ID]NodeRuntimeOptions
+	// MaxParallel caps how many nodes run at once; the workflow's
+	// max_parallelism setting takes precedence. 0 = unbounded
+	MaxParallel int
+	// OnNodeRun, when set, is called after every node finishes
+	OnNodeRun func(NodeRun)
 }
 
 func New(deps plugin.Deps) *Engine {
@@ -24,15 +29,16 @@ type FanInStrategy string
 
 const (
 	FanInConcat  FanInStrategy = "concat"   // concatenate all incoming items
-	FanInLatest  FanInStrategy = "latest"   // use the last predecessor only
-	FanInWaitAll FanInStrategy = "wait_all" // require all predecessors, then concat
+	FanInLatest  FanInStrategy = "latest"   // use the predecessor that completed last
+	FanInWaitAll FanInStrategy = "wait_all" // require output from every predecessor, then concat
+	FanInFirst   FanInStrategy = "first"    // run as soon as the first predecessor delivers, with its items only
 )
 
 // Per-node runtime knobs
 type NodeRuntimeOptions struct {
 	Workers   int
 	FanIn     FanInStrategy
-	QueueSize int
+	QueueSize int // input buffer in streaming mode; 0 = defaultQueueSize
 	Retry     RetryPolicy
 }
 
@@ -42,23 +48,6 @@ type portedProcessor interface {
 	ProcessPorted(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (map[model.Port]model.Items, error)
 }
 
-// Internal helper
-func successorsWithPorts(wf model.Workflow) map[model.ID][]model.Edge {
-	succ := make(map[model.ID][]model.Edge)
-	for _, e := range wf.Edges {
-		succ[e.FromNode] = append(succ[e.FromNode], e)
-	}
-	return succ
-}
-
-func predecessorsWithPorts(wf model.Workflow) map[model.ID][]model.Edge {
-	pred := make(map[model.ID][]model.Edge)
-	for _, e := range wf.Edges {
-		pred[e.ToNode] = append(pred[e.ToNode], e)
-	}
-	return pred
-}
-
 // chunk splits items into n nearly equal chunks
 func chunk(items model.Items, n int) []model.Items {
 	if n <= 1 || len(items) == 0 {
@@ -80,173 +69,376 @@ func chunk(items model.Items, n int) []model.Items {
 }
 
 func (e *Engine) Run(ctx context.Context, execID string, wf model.Workflow, inputs map[model.ID]model.Items) (map[model.ID]model.Items, error) {
-	order, _, _ := topo(wf)
-	succ := successorsWithPorts(wf)
-	pred := predecessorsWithPorts(wf)
+	if err := Validate(wf).Err(); err != nil {
+		return nil, err
+	}
+	ctx = plugin.WithExecution(ctx, execID)
+	if err := e.saveInputs(ctx, execID, inputs); err != nil {
+		return nil, err
+	}
+	if streamingEnabled(wf) {
+		return e.runStreaming(ctx, execID, wf, inputs)
+	}
+	return e.run(ctx, execID, wf, inputs, nil)
+}
+
+// Resume continues execID from its checkpoints: nodes that completed in an
+// earlier attempt are not run again, their saved outputs are routed as-is.
+// Streaming workflows don't checkpoint individual nodes, so they restart
+// from the saved inputs.
+func (e *Engine) Resume(ctx context.Context, execID string, wf model.Workflow) (map[model.ID]model.Items, error) {
+	if err := Validate(wf).Err(); err != nil {
+		return nil, err
+	}
+	ctx = plugin.WithExecution(ctx, execID)
+	inputs, done, err := e.loadCheckpoints(ctx, execID, wf)
+	if err != nil {
+		return nil, err
+	}
+	if streamingEnabled(wf) {
+		return e.runStreaming(ctx, execID, wf, inputs)
+	}
+	return e.run(ctx, execID, wf, inputs, done)
+}
+
+// run schedules the DAG; nodes present in restored are completed from their
+// checkpoint instead of executing
+func (e *Engine) run(ctx context.Context, execID string, wf model.Workflow, inputs map[model.ID]model.Items, restored map[model.ID]map[model.Port]model.Items) (map[model.ID]model.Items, error) {
+	order, indeg, _ := topo(wf)
+
+	nodes := make(map[model.ID]model.Node, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		nodes[n.ID] = n
+	}
+	rank := make(map[model.ID]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+	// Edges are addressed by index so fan-in concatenates in declaration
+	// order no matter which predecessor finishes first
+	inEdges := make(map[model.ID][]int)
+	outEdges := make(map[model.ID][]int)
+	for i, edge := range wf.Edges {
+		inEdges[edge.ToNode] = append(inEdges[edge.ToNode], i)
+		outEdges[edge.FromNode] = append(outEdges[edge.FromNode], i)
+	}
+	delivered := make([]edgeDelivery, len(wf.Edges))
+	completed := 0
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// inbound buffers per node/port
-	inbound := make(map[model.ID]map[model.Port]model.Items)
-	for id := range inputs {
-		if inbound[id] == nil {
-			inbound[id] = make(map[model.Port]model.Items)
+	type completion struct {
+		id  model.ID
+		out map[model.Port]model.Items
+		err error
+	}
+	done := make(chan completion)
+	limit := e.maxParallel(wf)
+
+	pending := make(map[model.ID]int, len(indeg))
+	queued := make(map[model.ID]bool, len(indeg))
+	ready := []model.ID{}
+	for _, id := range order {
+		pending[id] = indeg[id]
+		if indeg[id] == 0 {
+			ready = append(ready, id)
+			queued[id] = true
 		}
-		inbound[id][model.PortMain] = append(inbound[id][model.PortMain], inputs[id]...)
 	}
 
 	results := map[model.ID]model.Items{}
+	running := 0
+	var firstErr error
+
+	for {
+		for firstErr == nil && len(ready) > 0 && running < limit {
+			nodeID := ready[0]
+			ready = ready[1:]
+			node := nodes[nodeID]
 
-	for _, nodeID := range order {
-		var node model.Node
-		for _, n := range wf.Nodes {
-			if n.ID == nodeID {
-				node = n
-				break
+			if out, ok := restored[nodeID]; ok {
+				running++
+				go func() {
+					e.Deps.Bus.Emit(ctx, "node_restored", map[string]any{"exec": execID, "node": node.ID})
+					now := time.Now()
+					e.report(NodeRun{ExecID: execID, NodeID: node.ID, Status: NodeRestored, StartedAt: now, FinishedAt: now, Output: out})
+					done <- completion{id: node.ID, out: out}
+				}()
+				continue
 			}
+
+			// Direct inputs first (on main), then the items of the edges the
+			// fan-in strategy selects, per ToPort in edge order. Items are
+			// copied since sibling branches run at the same time and nodes
+			// like echo modify their input in place.
+			in := map[model.Port]model.Items{model.PortMain: appendCloned(nil, inputs[nodeID])}
+			refs := map[model.Port][]model.ItemSource{model.PortMain: sourcesOf(nodeID, "", len(inputs[nodeID]))}
+			edges, fanErr := fanIn(e.fanInStrategy(node), wf, inEdges[nodeID], delivered)
+			for _, idx := range edges {
+				edge := wf.Edges[idx]
+				port := portOrMain(edge.ToPort)
+				in[port] = appendCloned(in[port], delivered[idx].items)
+				refs[port] = append(refs[port], sourcesOf(edge.FromNode, portOrMain(edge.FromPort), len(delivered[idx].items))...)
+			}
+			src := flattenPorts(in)
+
+			running++
+			go func() {
+				started := time.Now()
+				var (
+					out      map[model.Port]model.Items
+					lineage  map[model.Port]model.Lineage
+					itemErrs int
+					err      = fanErr
+				)
+				if err == nil {
+					out, lineage, itemErrs, err = e.runNode(runCtx, execID, wf, node, in, refs)
+				}
+				if err == nil {
+					err = e.saveCheckpoint(runCtx, execID, node.ID, out)
+				}
+				run := NodeRun{ExecID: execID, NodeID: node.ID, Status: NodeSucceeded, StartedAt: started, FinishedAt: time.Now(), Input: src, Output: out, Lineage: lineage, ItemErrors: itemErrs, Err: err}
+				if err != nil {
+					run.Status = NodeFailed
+					e.Deps.Bus.Emit(ctx, "node_failed", map[string]any{"exec": execID, "node": node.ID, "error": err.Error()})
+				}
+				e.report(run)
+				done <- completion{id: node.ID, out: out, err: err}
+			}()
 		}
-		handler, ok := plugin.New(node.Type)
-		if !ok {
-			return nil, fmt.Errorf("unknown node type: %s", node.Type)
-		}
-		if err := handler.Init(ctx, e.Deps); err != nil {
-			return nil, err
+		if running == 0 {
+			break
 		}
 
-		// Build input with fan-in strategy on PortMain
-		opts := e.Options[nodeID]
-		if opts.FanIn == "" {
-			opts.FanIn = FanInConcat
-		}
-		workers := node.Concurrency
-		if workers <= 0 {
-			workers = opts.Workers
+		c := <-done
+		running--
+		if c.err != nil {
+			if firstErr == nil {
+				firstErr = c.err
+				cancel()
+			}
+			continue
 		}
-		if workers <= 0 {
-			workers = 1
+		if firstErr != nil {
+			continue
 		}
 
-		// Collect predecessor provided items on ToPort=main
-		var in model.Items
-		if inbound[nodeID] != nil {
-			src := inbound[nodeID][model.PortMain]
-			switch opts.FanIn {
-			case FanInConcat, FanInWaitAll:
-				// For WaitAll, ensure all predecessors sent something (if there are predecessors)
-				if opts.FanIn == FanInWaitAll {
-					if len(pred[nodeID]) > 0 && len(src) == 0 {
-						return nil, fmt.Errorf("wait_all: missing inputs for node %s", nodeID)
-					}
-				}
-				in = append(in, src...)
-			case FanInLatest:
-				if len(src) > 0 {
-					in = append(in, src...)
-				}
-			default:
-				in = append(in, src...)
+		// Record flat results for convenience (main port)
+		results[c.id] = append(results[c.id], c.out[model.PortMain]...)
+
+		// Route to successors by ports. A port missing from the output was
+		// skipped, which fan-in tells apart from a port with zero items.
+		completed++
+		for _, idx := range outEdges[c.id] {
+			edge := wf.Edges[idx]
+			items, arrived := c.out[edge.FromPort]
+			delivered[idx] = edgeDelivery{items: items, arrived: arrived, seq: completed}
+			pending[edge.ToNode]--
+			first := arrived && e.fanInStrategy(nodes[edge.ToNode]) == FanInFirst
+			if !queued[edge.ToNode] && (pending[edge.ToNode] == 0 || first) {
+				queued[edge.ToNode] = true
+				ready = insertByRank(ready, edge.ToNode, rank)
 			}
 		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
 
-		runCtx := ctx
-		if node.Timeout > 0 {
-			var cancel context.CancelFunc
-			runCtx, cancel = context.WithTimeout(ctx, node.Timeout)
-			defer cancel()
-		}
-
-		e.Deps.Bus.Emit(ctx, "node_started", map[string]any{"exec": execID, "node": node.ID})
-
-		// Per-node worker pool over chunks
-		chunks := chunk(in, workers)
-		outByPortTotal := make(map[model.Port]model.Items)
-		var mu sync.Mutex
-		wg := sync.WaitGroup{}
-		var procErr error
-		for _, ch := range chunks {
-			wg.Add(1)
-			go func(batch model.Items) {
-				defer wg.Done()
-				// Check for ported processor
-				if pp, ok := handler.(portedProcessor); ok {
-					pout, err := func() (map[model.Port]model.Items, error) {
-						pol := opts.Retry.normalized()
-						for attempt := 0; ; attempt++ {
-							if err := runCtx.Err(); err != nil {
-								return nil, err
-							}
-							res, err := pp.ProcessPorted(runCtx, wf, node, batch)
-							if err == nil || attempt >= pol.MaxRetries {
-								return res, err
-							}
-							time.Sleep(backoff(attempt, pol.BaseDelay, pol.MaxDelay, pol.Jitter))
-						}
-					}()
-					if err != nil {
-						mu.Lock()
-						if procErr == nil {
-							procErr = err
-						}
-						mu.Unlock()
-						return
-					}
-					mu.Lock()
-					for p, items := range pout {
-						outByPortTotal[p] = append(outByPortTotal[p], items...)
-					}
-					mu.Unlock()
-					return
-				}
-				// Fallback single-port with retry
-				out, err := func() (model.Items, error) {
-					pol := opts.Retry.normalized()
-					for attempt := 0; ; attempt++ {
-						if err := runCtx.Err(); err != nil {
-							return nil, err
-						}
-						o, err := handler.Process(runCtx, wf, node, batch)
-						if err == nil || attempt >= pol.MaxRetries {
-							return o, err
-						}
-						time.Sleep(backoff(attempt, pol.BaseDelay, pol.MaxDelay, pol.Jitter))
-					}
-				}()
-				if err != nil {
-					mu.Lock()
-					if procErr == nil {
-						procErr = err
-					}
-					mu.Unlock()
-					return
-				}
-				mu.Lock()
-				outByPortTotal[model.PortMain] = append(outByPortTotal[model.PortMain], out...)
-				mu.Unlock()
-			}(ch)
+	e.Deps.Bus.Emit(ctx, "execution_completed", map[string]any{"exec": execID, "at": time.Now().UTC()})
+	return results, nil
+}
+
+// maxParallel resolves how many nodes may run at once: the workflow's
+// max_parallelism setting, then Engine.MaxParallel, otherwise unbounded.
+func (e *Engine) maxParallel(wf model.Workflow) int {
+	if n, ok := intSetting(wf.Settings, "max_parallelism"); ok && n > 0 {
+		return n
+	}
+	if e.MaxParallel > 0 {
+		return e.MaxParallel
+	}
+	if len(wf.Nodes) > 0 {
+		return len(wf.Nodes)
+	}
+	return 1
+}
+
+func intSetting(settings map[string]any, key string) (int, bool) {
+	switch v := settings[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// appendCloned appends shallow copies of items to dst
+func appendCloned(dst, items model.Items) model.Items {
+	for _, it := range items {
+		if it == nil {
+			dst = append(dst, nil)
+			continue
 		}
-		wg.Wait()
-		if procErr != nil {
-			return nil, procErr
+		c := make(model.Item, len(it))
+		for k, v := range it {
+			c[k] = v
 		}
+		dst = append(dst, c)
+	}
+	return dst
+}
 
-		// Emit event counts for main port
-		mainCount := len(outByPortTotal[model.PortMain])
-		e.Deps.Bus.Emit(ctx, "node_completed", map[string]any{"exec": execID, "node": node.ID, "count": mainCount})
+// insertByRank keeps the ready queue in topological order so dispatch is
+// deterministic when parallelism is limited
+func insertByRank(ready []model.ID, id model.ID, rank map[model.ID]int) []model.ID {
+	i := len(ready)
+	for i > 0 && rank[ready[i-1]] > rank[id] {
+		i--
+	}
+	ready = append(ready, "")
+	copy(ready[i+1:], ready[i:])
+	ready[i] = id
+	return ready
+}
 
-		// Record flat results for convenience (main port)
-		results[node.ID] = append(results[node.ID], outByPortTotal[model.PortMain]...)
+// runNode executes one node over its collected input using the per-node
+// worker pool, retry policy and on_error mode. refs are the sources of the
+// input items; it returns the output's lineage and how many items failed
+// without failing the node.
+func (e *Engine) runNode(ctx context.Context, execID string, wf model.Workflow, node model.Node, inputs map[model.Port]model.Items, refs map[model.Port][]model.ItemSource) (map[model.Port]model.Items, map[model.Port]model.Lineage, int, error) {
+	handler, ok := plugin.New(node.Type)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("unknown node type: %s", node.Type)
+	}
+	if err := handler.Init(ctx, e.Deps); err != nil {
+		return nil, nil, 0, err
+	}
 
-		// Route to successors by ports
-		for _, edge := range succ[node.ID] {
-			items := outByPortTotal[edge.FromPort]
-			if len(items) == 0 {
-				continue
+	opts := e.Options[node.ID]
+	workers := node.Concurrency
+	if workers <= 0 {
+		workers = opts.Workers
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	ip, perPort := handler.(inputPortProcessor)
+	in := inputs[model.PortMain]
+
+	runCtx := ctx
+	if node.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, node.Timeout)
+		defer cancel()
+	}
+
+	e.Deps.Bus.Emit(ctx, "node_started", map[string]any{"exec": execID, "node": node.ID})
+
+	if perPort {
+		// ports are processed together, so the node runs as one batch
+		out, err := e.retrying(runCtx, opts.Retry, func() (map[model.Port]model.Items, error) {
+			return ip.ProcessInputs(runCtx, wf, node, inputs)
+		})
+		src, srcRefs := flattenPorts(inputs), flattenRefs(refs)
+		itemErrs := 0
+		if err != nil {
+			if onErrorMode(node) == model.OnErrorFail || ctx.Err() != nil {
+				return nil, nil, 0, err
 			}
-			if inbound[edge.ToNode] == nil {
-				inbound[edge.ToNode] = make(map[model.Port]model.Items)
+			out, itemErrs = failAll(node, src, err), len(src)
+		}
+		lineage := lineageOf(out, srcRefs, len(src))
+		fields := map[string]any{"exec": execID, "node": node.ID, "count": len(out[model.PortMain])}
+		if itemErrs > 0 {
+			fields["item_errors"] = itemErrs
+		}
+		e.Deps.Bus.Emit(ctx, "node_completed", fields)
+		return out, lineage, itemErrs, nil
+	}
+
+	// Per-node worker pool over chunks; outputs are stitched back together in
+	// chunk order so results don't depend on goroutine scheduling
+	chunks := chunk(in, workers)
+	outs := make([]map[model.Port]model.Items, len(chunks))
+	lineages := make([]map[model.Port]model.Lineage, len(chunks))
+	failed := make([]int, len(chunks))
+	errs := make([]error, len(chunks))
+	isolate := onErrorMode(node) != model.OnErrorFail
+	wg := sync.WaitGroup{}
+	offset := 0
+	for i, ch := range chunks {
+		batchRefs := refs[model.PortMain][offset : offset+len(ch)]
+		offset += len(ch)
+		wg.Add(1)
+		go func(i int, batch model.Items) {
+			defer wg.Done()
+			if isolate {
+				outs[i], lineages[i], failed[i], errs[i] = e.processItems(ctx, runCtx, handler, wf, node, batch, batchRefs, opts.Retry)
+				return
 			}
-			inbound[edge.ToNode][edge.ToPort] = append(inbound[edge.ToNode][edge.ToPort], items...)
+			outs[i], errs[i] = e.processBatch(runCtx, handler, wf, node, batch, opts.Retry)
+			lineages[i] = lineageOf(outs[i], batchRefs, len(batch))
+		}(i, ch)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	itemErrs := 0
+	outByPortTotal := make(map[model.Port]model.Items)
+	lineage := make(map[model.Port]model.Lineage)
+	for i, pout := range outs {
+		itemErrs += failed[i]
+		for p, items := range pout {
+			outByPortTotal[p] = append(outByPortTotal[p], items...)
+			lineage[p] = append(lineage[p], lineages[i][p]...)
 		}
 	}
 
-	e.Deps.Bus.Emit(ctx, "execution_completed", map[string]any{"exec": execID, "at": time.Now().UTC()})
-	return results, nil
+	// Emit event counts for main port
+	mainCount := len(outByPortTotal[model.PortMain])
+	fields := map[string]any{"exec": execID, "node": node.ID, "count": mainCount}
+	if itemErrs > 0 {
+		fields["item_errors"] = itemErrs
+	}
+	e.Deps.Bus.Emit(ctx, "node_completed", fields)
+	return outByPortTotal, lineage, itemErrs, nil
+}
+
+// processBatch runs a handler over one chunk with retry
+func (e *Engine) processBatch(ctx context.Context, handler plugin.NodeHandler, wf model.Workflow, node model.Node, batch model.Items, retry RetryPolicy) (map[model.Port]model.Items, error) {
+	return e.retrying(ctx, retry, func() (map[model.Port]model.Items, error) {
+		// Check for ported processor, fallback to single-port
+		if pp, ok := handler.(portedProcessor); ok {
+			return pp.ProcessPorted(ctx, wf, node, batch)
+		}
+		out, err := handler.Process(ctx, wf, node, batch)
+		if err != nil {
+			return nil, err
+		}
+		return map[model.Port]model.Items{model.PortMain: out}, nil
+	})
+}
+
+// retrying calls process until it succeeds or the retry policy gives up
+func (e *Engine) retrying(ctx context.Context, retry RetryPolicy, process func() (map[model.Port]model.Items, error)) (map[model.Port]model.Items, error) {
+	pol := retry.normalized()
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res, err := process()
+		if err == nil || attempt >= pol.MaxRetries {
+			return res, err
+		}
+		time.Sleep(backoff(attempt, pol.BaseDelay, pol.MaxDelay, pol.Jitter))
+	}
 }
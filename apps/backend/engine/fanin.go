@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// edgeDelivery is what one inbound edge carried
+type edgeDelivery struct {
+	items   model.Items
+	arrived bool // the source emitted on the edge's port, possibly zero items
+	seq     int  // completion order of the source, from 1; 0 while it hasn't run
+}
+
+func (e *Engine) fanInStrategy(node model.Node) FanInStrategy {
+	if s := e.Options[node.ID].FanIn; s != "" {
+		return s
+	}
+	return FanInConcat
+}
+
+// fanIn selects, in edge order, the inbound edges whose items a node
+// reads. latest and first keep the edges of the predecessor that completed
+// last or first among those that delivered; wait_all fails when a
+// predecessor skipped the edge's port.
+func fanIn(strategy FanInStrategy, wf model.Workflow, edges []int, got []edgeDelivery) ([]int, error) {
+	switch strategy {
+	case FanInLatest, FanInFirst:
+		pick := 0
+		for _, idx := range edges {
+			d := got[idx]
+			if !d.arrived {
+				continue
+			}
+			if pick == 0 || (strategy == FanInLatest && d.seq > pick) || (strategy == FanInFirst && d.seq < pick) {
+				pick = d.seq
+			}
+		}
+		var out []int
+		for _, idx := range edges {
+			if got[idx].arrived && got[idx].seq == pick {
+				out = append(out, idx)
+			}
+		}
+		return out, nil
+	case FanInWaitAll:
+		for _, idx := range edges {
+			if !got[idx].arrived {
+				edge := wf.Edges[idx]
+				return nil, fmt.Errorf("wait_all: %s produced no output on port %s for node %s", edge.FromNode, portOrMain(edge.FromPort), edge.ToNode)
+			}
+		}
+		return edges, nil
+	default:
+		return edges, nil
+	}
+}
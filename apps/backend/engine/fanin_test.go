@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// mainOnly is a ported node that never emits on any port but main
+type mainOnly struct{ passNode }
+
+func (mainOnly) ProcessPorted(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (map[model.Port]model.Items, error) {
+	return map[model.Port]model.Items{model.PortMain: in}, nil
+}
+
+func init() {
+	plugin.Register("test:main_only", func() plugin.NodeHandler { return mainOnly{} })
+}
+
+// raceWorkflow feeds join from a fast and a slow branch
+func raceWorkflow() model.Workflow {
+	return model.Workflow{
+		Nodes: []model.Node{
+			{ID: "fast", Type: "test:pass"},
+			{ID: "slow", Type: "test:slow"},
+			{ID: "join", Type: "test:pass"},
+		},
+		Edges: []model.Edge{
+			{FromNode: "slow", FromPort: model.PortMain, ToNode: "join", ToPort: model.PortMain},
+			{FromNode: "fast", FromPort: model.PortMain, ToNode: "join", ToPort: model.PortMain},
+		},
+	}
+}
+
+func runJoin(t *testing.T, strategy FanInStrategy) model.Items {
+	t.Helper()
+	eng := New(testDeps())
+	eng.Options["join"] = NodeRuntimeOptions{FanIn: strategy}
+	inputs := map[model.ID]model.Items{"fast": {{"from": "fast"}}, "slow": {{"from": "slow"}}}
+	res, err := eng.Run(context.Background(), "exec", raceWorkflow(), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res["join"]
+}
+
+func TestFanInStrategies(t *testing.T) {
+	if got := runJoin(t, FanInConcat); len(got) != 2 || got[0]["from"] != "slow" {
+		t.Fatalf("concat should keep edge order: %v", got)
+	}
+	if got := runJoin(t, FanInLatest); len(got) != 1 || got[0]["from"] != "slow" {
+		t.Fatalf("latest should keep the last predecessor: %v", got)
+	}
+	if got := runJoin(t, FanInFirst); len(got) != 1 || got[0]["from"] != "fast" {
+		t.Fatalf("first should keep the first predecessor: %v", got)
+	}
+}
+
+func TestFanInWaitAllTellsSkippedFromEmpty(t *testing.T) {
+	wf := model.Workflow{
+		Nodes: []model.Node{
+			{ID: "empty", Type: "test:pass"},
+			{ID: "branch", Type: "test:main_only"},
+			{ID: "join", Type: "test:pass"},
+		},
+		Edges: []model.Edge{
+			{FromNode: "empty", FromPort: model.PortMain, ToNode: "join", ToPort: model.PortMain},
+			{FromNode: "branch", FromPort: model.PortMain, ToNode: "join", ToPort: model.PortMain},
+		},
+	}
+	eng := New(testDeps())
+	eng.Options["join"] = NodeRuntimeOptions{FanIn: FanInWaitAll}
+	inputs := map[model.ID]model.Items{"branch": {{"n": 1}}}
+	res, err := eng.Run(context.Background(), "exec", wf, inputs)
+	if err != nil || len(res["join"]) != 1 {
+		t.Fatalf("a predecessor with zero items still delivered: %v %v", res, err)
+	}
+
+	wf.Edges[1].FromPort = "other"
+	_, err = eng.Run(context.Background(), "exec-2", wf, inputs)
+	if err == nil || !strings.Contains(err.Error(), "branch produced no output on port other") {
+		t.Fatalf("expected the skipped predecessor to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// Optional: nodes that read their inputs per input port (edge ToPort)
+// instead of as one list. Direct inputs arrive on PortMain. The node is
+// called once with all of its inputs, without per-node workers.
+// Nodes can implement this without importing engine.
+type inputPortProcessor interface {
+	ProcessInputs(ctx context.Context, wf model.Workflow, node model.Node, in map[model.Port]model.Items) (map[model.Port]model.Items, error)
+}
+
+// Optional: input-port nodes declare the ports they read so edges into
+// other ports can be rejected up front. PortMain is always accepted.
+type inputPortDeclarer interface {
+	InputPorts(node model.Node) []model.Port
+}
+
+// flattenPorts concatenates per-port items, main first and then by port name
+func flattenPorts(in map[model.Port]model.Items) model.Items {
+	ports := make([]model.Port, 0, len(in))
+	for p := range in {
+		if p != model.PortMain {
+			ports = append(ports, p)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	out := append(model.Items{}, in[model.PortMain]...)
+	for _, p := range ports {
+		out = append(out, in[p]...)
+	}
+	return out
+}
+
+// failAll routes every input item with err attached, for an input-port
+// node that continues or routes on error
+func failAll(node model.Node, items model.Items, err error) map[model.Port]model.Items {
+	port := model.PortMain
+	if onErrorMode(node) == model.OnErrorRoute {
+		port = model.PortError
+	}
+	out := make(model.Items, 0, len(items))
+	for _, it := range items {
+		out = append(out, errorItem(node, it, err))
+	}
+	return map[model.Port]model.Items{port: out}
+}
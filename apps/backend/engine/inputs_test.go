@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// portsNode outputs one item per input port with its item count
+type portsNode struct{}
+
+func (portsNode) Init(context.Context, plugin.Deps) error { return nil }
+func (portsNode) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	return in, nil
+}
+func (portsNode) ProcessInputs(_ context.Context, _ model.Workflow, _ model.Node, in map[model.Port]model.Items) (map[model.Port]model.Items, error) {
+	out := model.Items{}
+	for _, p := range []model.Port{model.PortMain, "left", "right"} {
+		out = append(out, model.Item{"port": string(p), "count": len(in[p])})
+	}
+	return map[model.Port]model.Items{model.PortMain: out}, nil
+}
+func (portsNode) InputPorts(model.Node) []model.Port { return []model.Port{"left", "right"} }
+
+func init() {
+	plugin.Register("test:ports", func() plugin.NodeHandler { return portsNode{} })
+}
+
+func TestInputPortsAreDeliveredSeparately(t *testing.T) {
+	wf := model.Workflow{
+		Nodes: []model.Node{
+			{ID: "a", Type: "test:pass"},
+			{ID: "b", Type: "test:pass"},
+			{ID: "join", Type: "test:ports"},
+		},
+		Edges: []model.Edge{
+			{FromNode: "a", FromPort: model.PortMain, ToNode: "join", ToPort: "left"},
+			{FromNode: "b", FromPort: model.PortMain, ToNode: "join", ToPort: "right"},
+		},
+	}
+	inputs := map[model.ID]model.Items{"a": {{"n": 1}, {"n": 2}}, "b": {{"n": 3}}, "join": {{"direct": true}}}
+	res, err := New(testDeps()).Run(context.Background(), "exec", wf, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := res["join"]
+	if len(got) != 3 || got[0]["count"] != 1 || got[1]["count"] != 2 || got[2]["count"] != 1 {
+		t.Fatalf("per-port counts: %v", got)
+	}
+
+	wf.Edges[1].ToPort = "other"
+	if codes(Validate(wf))[DiagUnknownPort] != 1 {
+		t.Fatal("an undeclared input port should be rejected")
+	}
+	wf.Edges[1].ToPort = "right"
+	wf.Edges = append(wf.Edges, model.Edge{FromNode: "a", FromPort: model.PortMain, ToNode: "b", ToPort: "side"})
+	if codes(Validate(wf))[DiagUnknownPort] != 1 {
+		t.Fatal("plain nodes only read main")
+	}
+}
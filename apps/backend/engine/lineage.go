@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// sourcesOf lists the first n items of a node's output on port
+func sourcesOf(node model.ID, port model.Port, n int) []model.ItemSource {
+	refs := make([]model.ItemSource, n)
+	for i := range refs {
+		refs[i] = model.ItemSource{Node: node, Port: port, Index: i}
+	}
+	return refs
+}
+
+// flattenRefs orders per-port sources the same way flattenPorts orders items
+func flattenRefs(refs map[model.Port][]model.ItemSource) []model.ItemSource {
+	ports := make([]model.Port, 0, len(refs))
+	for p := range refs {
+		if p != model.PortMain {
+			ports = append(ports, p)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	out := append([]model.ItemSource{}, refs[model.PortMain]...)
+	for _, p := range ports {
+		out = append(out, refs[p]...)
+	}
+	return out
+}
+
+// lineageOf strips the paired declarations from a node's output and maps
+// them onto refs, the sources of the batch of n items it was called with.
+// Items without a declaration are paired by position when the port has
+// as many items as the batch, or with the only input of a single-item
+// batch. With nil refs the declarations are only stripped.
+func lineageOf(out map[model.Port]model.Items, refs []model.ItemSource, n int) map[model.Port]model.Lineage {
+	// read everything before deleting: ports may share item maps
+	declared := make(map[model.Port][][]int, len(out))
+	for p, items := range out {
+		idx := make([][]int, len(items))
+		for i, it := range items {
+			if v, ok := it[plugin.PairedKey]; ok {
+				idx[i] = pairedIndexes(v)
+				if idx[i] == nil {
+					idx[i] = []int{}
+				}
+			}
+		}
+		declared[p] = idx
+	}
+	for _, items := range out {
+		for _, it := range items {
+			delete(it, plugin.PairedKey)
+		}
+	}
+	if refs == nil {
+		return nil
+	}
+	lineage := make(map[model.Port]model.Lineage, len(out))
+	for p, items := range out {
+		l := make(model.Lineage, len(items))
+		for i := range items {
+			idx := declared[p][i]
+			switch {
+			case idx != nil:
+			case len(items) == n:
+				idx = []int{i}
+			case n == 1:
+				idx = []int{0}
+			}
+			for _, k := range idx {
+				if k >= 0 && k < len(refs) {
+					l[i] = append(l[i], refs[k])
+				}
+			}
+		}
+		lineage[p] = l
+	}
+	return lineage
+}
+
+// pairedIndexes accepts the forms a declaration takes in Go or after a
+// round trip through JSON
+func pairedIndexes(v any) []int {
+	switch x := v.(type) {
+	case []int:
+		return x
+	case int:
+		return []int{x}
+	case float64:
+		return []int{int(x)}
+	case []any:
+		var idx []int
+		for _, e := range x {
+			switch n := e.(type) {
+			case int:
+				idx = append(idx, n)
+			case float64:
+				idx = append(idx, int(n))
+			}
+		}
+		return idx
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// summer emits one item summing n over its batch, paired with every input
+type summer struct{}
+
+func (summer) Init(context.Context, plugin.Deps) error { return nil }
+func (summer) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	total, idx := 0, []int{}
+	for i, it := range in {
+		n, _ := it["n"].(int)
+		total += n
+		idx = append(idx, i)
+	}
+	return model.Items{plugin.Pair(model.Item{"n": total}, idx...)}, nil
+}
+
+func init() {
+	plugin.Register("test:sum", func() plugin.NodeHandler { return summer{} })
+}
+
+func TestLineageFollowsItemsAcrossNodes(t *testing.T) {
+	wf := model.Workflow{
+		Nodes: []model.Node{
+			{ID: "start", Type: "test:pass", Concurrency: 2},
+			{ID: "sum", Type: "test:sum"},
+		},
+		Edges: []model.Edge{{FromNode: "start", FromPort: model.PortMain, ToNode: "sum", ToPort: model.PortMain}},
+	}
+	var mu sync.Mutex
+	runs := map[model.ID]NodeRun{}
+	eng := New(testDeps())
+	eng.OnNodeRun = func(r NodeRun) {
+		mu.Lock()
+		defer mu.Unlock()
+		runs[r.NodeID] = r
+	}
+	res, err := eng.Run(context.Background(), "exec-lineage", wf, map[model.ID]model.Items{"start": {{"n": 1}, {"n": 2}, {"n": 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res["sum"][0][plugin.PairedKey]; ok || res["sum"][0]["n"] != 6 {
+		t.Fatalf("sum output %v", res["sum"])
+	}
+
+	start := runs["start"].Lineage[model.PortMain]
+	want := model.Lineage{
+		{{Node: "start", Index: 0}},
+		{{Node: "start", Index: 1}},
+		{{Node: "start", Index: 2}},
+	}
+	if !reflect.DeepEqual(start, want) {
+		t.Fatalf("start lineage %v", start)
+	}
+	sum := runs["sum"].Lineage[model.PortMain]
+	want = model.Lineage{{
+		{Node: "start", Port: model.PortMain, Index: 0},
+		{Node: "start", Port: model.PortMain, Index: 1},
+		{Node: "start", Port: model.PortMain, Index: 2},
+	}}
+	if !reflect.DeepEqual(sum, want) {
+		t.Fatalf("sum lineage %v", sum)
+	}
+}
+
+func TestLineageOfDefaultsAndStripping(t *testing.T) {
+	refs := sourcesOf("a", model.PortMain, 2)
+	shared := model.Item{"x": 1, plugin.PairedKey: []any{float64(1)}}
+	out := map[model.Port]model.Items{"left": {shared}, "right": {shared}, model.PortMain: {{}, {}}}
+	got := lineageOf(out, refs, 2)
+	if !reflect.DeepEqual(got["left"], model.Lineage{{refs[1]}}) || !reflect.DeepEqual(got["right"], got["left"]) {
+		t.Fatalf("shared item lineage %v", got)
+	}
+	if !reflect.DeepEqual(got[model.PortMain], model.Lineage{{refs[0]}, {refs[1]}}) {
+		t.Fatalf("positional lineage %v", got[model.PortMain])
+	}
+	if _, ok := shared[plugin.PairedKey]; ok {
+		t.Fatal("declaration was not stripped")
+	}
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// Node run statuses reported to Engine.OnNodeRun
+const (
+	NodeSucceeded = "succeeded"
+	NodeFailed    = "failed"
+	NodeRestored  = "restored" // completed in an earlier attempt, see Resume
+)
+
+// NodeRun describes one finished node execution. Input and Output are
+// left empty in streaming mode where items are not retained.
+type NodeRun struct {
+	ExecID     string
+	NodeID     model.ID
+	Status     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Input      model.Items
+	Output     map[model.Port]model.Items
+	Lineage    map[model.Port]model.Lineage // sources of each output item, per port
+	ItemErrors int                          // items that failed on a node that continues or routes on error
+	Err        error
+}
+
+// report hands a node run to the observer, if any. It may be called from
+// several goroutines at once.
+func (e *Engine) report(run NodeRun) {
+	if e.OnNodeRun != nil {
+		e.OnNodeRun(run)
+	}
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// onErrorMode normalises node.OnError; empty means fail
+func onErrorMode(node model.Node) string {
+	if node.OnError == "" {
+		return model.OnErrorFail
+	}
+	return node.OnError
+}
+
+// errorItem copies a failed input item and attaches the error details
+func errorItem(node model.Node, it model.Item, err error) model.Item {
+	out := make(model.Item, len(it)+1)
+	for k, v := range it {
+		out[k] = v
+	}
+	out["error"] = map[string]any{"message": err.Error(), "node": string(node.ID)}
+	return out
+}
+
+// processItems runs a batch for a node that continues or routes on error.
+// The batch is processed as a whole first; only when that fails are its
+// items retried one at a time, so a failure only affects its own item,
+// which goes to main (continue) or PortError (route) with the error
+// attached. It returns the output's lineage and the number of failed
+// items; errors caused by the execution being cancelled (abort done) are
+// returned instead.
+func (e *Engine) processItems(abort, ctx context.Context, handler plugin.NodeHandler, wf model.Workflow, node model.Node, batch model.Items, refs []model.ItemSource, retry RetryPolicy) (map[model.Port]model.Items, map[model.Port]model.Lineage, int, error) {
+	port := model.PortMain
+	if onErrorMode(node) == model.OnErrorRoute {
+		port = model.PortError
+	}
+	// both ports count as emitted even when empty, so fan-in doesn't take
+	// them for skipped
+	out := map[model.Port]model.Items{model.PortMain: {}, port: {}}
+	lineage := map[model.Port]model.Lineage{}
+	collect := func(res map[model.Port]model.Items, resLineage map[model.Port]model.Lineage) {
+		for p, items := range res {
+			out[p] = append(out[p], items...)
+			lineage[p] = append(lineage[p], resLineage[p]...)
+		}
+	}
+	failed := 0
+	res, err := e.processBatch(ctx, handler, wf, node, batch, retry)
+	switch {
+	case err == nil:
+		collect(res, lineageOf(res, refs, len(batch)))
+	case abort.Err() != nil:
+		return nil, nil, failed, abort.Err()
+	case len(batch) == 1:
+		failed++
+		out[port] = append(out[port], errorItem(node, batch[0], err))
+		lineage[port] = append(lineage[port], refs)
+	default:
+		for i, it := range batch {
+			var itemRefs []model.ItemSource
+			if refs != nil {
+				itemRefs = refs[i : i+1]
+			}
+			res, err := e.processBatch(ctx, handler, wf, node, model.Items{it}, retry)
+			if err != nil {
+				if abort.Err() != nil {
+					return nil, nil, failed, abort.Err()
+				}
+				failed++
+				out[port] = append(out[port], errorItem(node, it, err))
+				lineage[port] = append(lineage[port], itemRefs)
+				continue
+			}
+			collect(res, lineageOf(res, itemRefs, 1))
+		}
+	}
+	if refs == nil {
+		lineage = nil
+	}
+	return out, lineage, failed, nil
+}
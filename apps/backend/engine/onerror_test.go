@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// pickyNode fails on any batch containing an item with bad=true
+type pickyNode struct{}
+
+func (pickyNode) Init(context.Context, plugin.Deps) error { return nil }
+func (pickyNode) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	for _, it := range in {
+		if bad, _ := it["bad"].(bool); bad {
+			return nil, errors.New("bad item")
+		}
+	}
+	return in, nil
+}
+
+func init() {
+	plugin.Register("test:picky", func() plugin.NodeHandler { return pickyNode{} })
+}
+
+func pickyWorkflow(onError string) model.Workflow {
+	return model.Workflow{
+		Nodes: []model.Node{
+			{ID: "check", Type: "test:picky", OnError: onError, Concurrency: 2},
+			{ID: "ok", Type: "test:pass"},
+			{ID: "failed", Type: "test:pass"},
+		},
+		Edges: []model.Edge{
+			{FromNode: "check", FromPort: model.PortMain, ToNode: "ok", ToPort: model.PortMain},
+			{FromNode: "check", FromPort: model.PortError, ToNode: "failed", ToPort: model.PortMain},
+		},
+	}
+}
+
+var pickyInput = map[model.ID]model.Items{"check": {{"n": 1}, {"n": 2, "bad": true}, {"n": 3}}}
+
+func TestOnErrorRouteSendsFailingItemsToErrorPort(t *testing.T) {
+	res, err := New(testDeps()).Run(context.Background(), "exec", pickyWorkflow(model.OnErrorRoute), pickyInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res["ok"]) != 2 || res["ok"][0]["n"] != 1 || res["ok"][1]["n"] != 3 {
+		t.Fatalf("main port got %v", res["ok"])
+	}
+	if len(res["failed"]) != 1 || res["failed"][0]["n"] != 2 {
+		t.Fatalf("error port got %v", res["failed"])
+	}
+	details, _ := res["failed"][0]["error"].(map[string]any)
+	if details["message"] != "bad item" || details["node"] != "check" {
+		t.Fatalf("error details %v", details)
+	}
+}
+
+func TestOnErrorContinueKeepsFailingItemsOnMain(t *testing.T) {
+	wf := pickyWorkflow(model.OnErrorContinue)
+	wf.Edges = wf.Edges[:1]
+	res, err := New(testDeps()).Run(context.Background(), "exec", wf, pickyInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res["ok"]) != 3 || res["ok"][1]["error"] == nil {
+		t.Fatalf("main port got %v", res["ok"])
+	}
+}
+
+func TestOnErrorFailAbortsAndErrorPortNeedsRoute(t *testing.T) {
+	wf := pickyWorkflow("")
+	if got := codes(Validate(wf)); got[DiagUnknownPort] != 1 {
+		t.Fatalf("error edge without route should be rejected, got %v", got)
+	}
+	wf.Edges = wf.Edges[:1]
+	if _, err := New(testDeps()).Run(context.Background(), "exec", wf, pickyInput); err == nil {
+		t.Fatal("expected the execution to fail")
+	}
+	wf.Nodes[0].OnError = "ignore"
+	if got := codes(Validate(wf)); got[DiagInvalidOnError] != 1 {
+		t.Fatalf("expected invalid_on_error, got %v", got)
+	}
+}
+
+func TestOnErrorKeepsBatchWhenNothingFails(t *testing.T) {
+	wf := model.Workflow{Nodes: []model.Node{{ID: "sum", Type: "test:sum", OnError: model.OnErrorContinue}}}
+	res, err := New(testDeps()).Run(context.Background(), "exec", wf, map[model.ID]model.Items{"sum": {{"n": 1}, {"n": 2}, {"n": 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res["sum"]) != 1 || res["sum"][0]["n"] != 6 {
+		t.Fatalf("expected one sum over the whole batch, got %v", res["sum"])
+	}
+}
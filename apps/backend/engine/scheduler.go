@@ -13,11 +13,15 @@ func topo(wf model.Workflow) (order []model.ID, indeg map[model.ID]int, out map[
 		out[e.FromNode] = append(out[e.FromNode], e.ToNode)
 		indeg[e.ToNode]++
 	}
-	// Kahn
-	q := []model.ID{}
+	// Kahn, seeded in declaration order so the result is deterministic
+	remaining := make(map[model.ID]int, len(indeg))
 	for id, d := range indeg {
-		if d == 0 {
-			q = append(q, id)
+		remaining[id] = d
+	}
+	q := []model.ID{}
+	for _, n := range wf.Nodes {
+		if remaining[n.ID] == 0 {
+			q = append(q, n.ID)
 		}
 	}
 	for len(q) > 0 {
@@ -25,11 +29,23 @@ func topo(wf model.Workflow) (order []model.ID, indeg map[model.ID]int, out map[
 		q = q[1:]
 		order = append(order, v)
 		for _, u := range out[v] {
-			indeg[u]--
-			if indeg[u] == 0 {
+			remaining[u]--
+			if remaining[u] == 0 {
 				q = append(q, u)
 			}
 		}
 	}
 	return
 }
+
+// Roots returns the nodes without incoming edges, in declaration order
+func Roots(wf model.Workflow) []model.ID {
+	_, indeg, _ := topo(wf)
+	var roots []model.ID
+	for _, n := range wf.Nodes {
+		if indeg[n.ID] == 0 {
+			roots = append(roots, n.ID)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,289 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// ModeStreaming is the workflow "execution_mode" setting that pipelines
+// items between nodes instead of running each node over its whole batch.
+const ModeStreaming = "streaming"
+
+// defaultQueueSize bounds each node's input channel when
+// NodeRuntimeOptions.QueueSize is unset
+const defaultQueueSize = 64
+
+// StreamProcessor is an optional node interface used in streaming mode.
+// The node reads items from in until it is closed and hands each result to
+// emit, which blocks while the downstream queue is full.
+// Nodes can implement this without importing engine.
+type StreamProcessor interface {
+	ProcessStream(ctx context.Context, wf model.Workflow, node model.Node, in <-chan model.Item, emit func(model.Port, model.Item) error) error
+}
+
+func streamingEnabled(wf model.Workflow) bool {
+	mode, _ := wf.Settings["execution_mode"].(string)
+	return mode == ModeStreaming
+}
+
+// runStreaming starts every node at once and connects them with bounded
+// channels. Nodes without StreamProcessor are fed one item per call through
+// their worker pool. To keep memory flat only the outputs of sink nodes
+// (no outgoing edges) are collected into the result map.
+func (e *Engine) runStreaming(ctx context.Context, execID string, wf model.Workflow, inputs map[model.ID]model.Items) (map[model.ID]model.Items, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outEdges := make(map[model.ID][]model.Edge)
+	writers := make(map[model.ID]int)
+	for _, edge := range wf.Edges {
+		outEdges[edge.FromNode] = append(outEdges[edge.FromNode], edge)
+		if portOrMain(edge.ToPort) == model.PortMain {
+			writers[edge.ToNode]++
+		}
+	}
+
+	queues := make(map[model.ID]chan model.Item, len(wf.Nodes))
+	open := make(map[model.ID]*sync.WaitGroup, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		size := e.Options[n.ID].QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		queues[n.ID] = make(chan model.Item, size)
+		wg := &sync.WaitGroup{}
+		wg.Add(writers[n.ID])
+		if len(inputs[n.ID]) > 0 {
+			wg.Add(1)
+		}
+		open[n.ID] = wg
+		// close the queue once every upstream writer is finished
+		go func(q chan model.Item, wg *sync.WaitGroup) {
+			wg.Wait()
+			close(q)
+		}(queues[n.ID], wg)
+	}
+
+	send := func(q chan model.Item, it model.Item) error {
+		select {
+		case q <- it:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// feed direct inputs
+	for _, n := range wf.Nodes {
+		items := inputs[n.ID]
+		if len(items) == 0 {
+			continue
+		}
+		go func(id model.ID, items model.Items) {
+			defer open[id].Done()
+			for _, it := range appendCloned(nil, items) {
+				if send(queues[id], it) != nil {
+					return
+				}
+			}
+		}(n.ID, items)
+	}
+
+	var (
+		mu       sync.Mutex
+		results  = map[model.ID]model.Items{}
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+
+	var nodesWG sync.WaitGroup
+	for _, n := range wf.Nodes {
+		nodesWG.Add(1)
+		go func(node model.Node) {
+			defer nodesWG.Done()
+			edges := outEdges[node.ID]
+			// release downstream queues when this node is done, whatever happens
+			defer func() {
+				for _, edge := range edges {
+					if portOrMain(edge.ToPort) == model.PortMain {
+						open[edge.ToNode].Done()
+					}
+				}
+			}()
+
+			var count int
+			emit := func(port model.Port, it model.Item) error {
+				port = portOrMain(port)
+				mu.Lock()
+				if port == model.PortMain {
+					count++
+				}
+				if len(edges) == 0 && port == model.PortMain {
+					results[node.ID] = append(results[node.ID], it)
+				}
+				mu.Unlock()
+				for _, edge := range edges {
+					if portOrMain(edge.FromPort) != port || portOrMain(edge.ToPort) != model.PortMain {
+						continue
+					}
+					if err := send(queues[edge.ToNode], appendCloned(nil, model.Items{it})[0]); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			e.Deps.Bus.Emit(ctx, "node_started", map[string]any{"exec": execID, "node": node.ID, "mode": ModeStreaming})
+			started := time.Now()
+			// like in batch mode, a node fed by nothing runs once on no items
+			source := writers[node.ID] == 0 && len(inputs[node.ID]) == 0
+			err := e.streamNode(ctx, wf, node, queues[node.ID], source, emit)
+			run := NodeRun{ExecID: execID, NodeID: node.ID, Status: NodeSucceeded, StartedAt: started, FinishedAt: time.Now(), Err: err}
+			if err != nil {
+				run.Status = NodeFailed
+				e.Deps.Bus.Emit(ctx, "node_failed", map[string]any{"exec": execID, "node": node.ID, "error": err.Error(), "mode": ModeStreaming})
+				e.report(run)
+				// stop upstream stages before draining what they sent
+				fail(err)
+			}
+			// drain so upstream writers never block on a finished stage
+			for range queues[node.ID] {
+			}
+			if err != nil {
+				return
+			}
+			e.report(run)
+			mu.Lock()
+			c := count
+			mu.Unlock()
+			e.Deps.Bus.Emit(ctx, "node_completed", map[string]any{"exec": execID, "node": node.ID, "count": c, "mode": ModeStreaming})
+		}(n)
+	}
+	nodesWG.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	e.Deps.Bus.Emit(ctx, "execution_completed", map[string]any{"exec": execID, "at": time.Now().UTC()})
+	return results, nil
+}
+
+// streamNode runs a single node in streaming mode until its input closes.
+// A source node, without inputs or upstream nodes, is called once with an
+// empty batch unless it streams.
+func (e *Engine) streamNode(ctx context.Context, wf model.Workflow, node model.Node, in chan model.Item, source bool, emit func(model.Port, model.Item) error) error {
+	handler, ok := plugin.New(node.Type)
+	if !ok {
+		return fmt.Errorf("unknown node type: %s", node.Type)
+	}
+	if err := handler.Init(ctx, e.Deps); err != nil {
+		return err
+	}
+	if sp, ok := handler.(StreamProcessor); ok {
+		return sp.ProcessStream(ctx, wf, node, in, emit)
+	}
+
+	opts := e.Options[node.ID]
+	workers := node.Concurrency
+	if workers <= 0 {
+		workers = opts.Workers
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// node.Timeout applies to each item call rather than the whole stage
+	call := func(items model.Items) error {
+		itemCtx := ctx
+		var cancel context.CancelFunc = func() {}
+		if node.Timeout > 0 {
+			itemCtx, cancel = context.WithTimeout(ctx, node.Timeout)
+		}
+		defer cancel()
+		var (
+			out map[model.Port]model.Items
+			err error
+		)
+		// lineage isn't tracked in streaming mode, paired declarations
+		// are only stripped
+		if onErrorMode(node) == model.OnErrorFail {
+			out, err = e.processBatch(itemCtx, handler, wf, node, items, opts.Retry)
+			lineageOf(out, nil, len(items))
+		} else {
+			out, _, _, err = e.processItems(ctx, itemCtx, handler, wf, node, items, nil, opts.Retry)
+		}
+		if err != nil {
+			return err
+		}
+		return emitPorts(out, emit)
+	}
+	if source {
+		return call(model.Items{})
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr != nil
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// stop reading on the first failure; the stage's caller
+			// drains what is left once the run is cancelled
+			for it := range in {
+				if failed() {
+					return
+				}
+				if err := call(model.Items{it}); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// emitPorts forwards a batch result item by item, main port first
+func emitPorts(out map[model.Port]model.Items, emit func(model.Port, model.Item) error) error {
+	for _, it := range out[model.PortMain] {
+		if err := emit(model.PortMain, it); err != nil {
+			return err
+		}
+	}
+	for port, items := range out {
+		if port == model.PortMain {
+			continue
+		}
+		for _, it := range items {
+			if err := emit(port, it); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// doubler emits every incoming item twice using the streaming interface
+type doubler struct{}
+
+func (doubler) Init(context.Context, plugin.Deps) error { return nil }
+func (doubler) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	return append(append(model.Items{}, in...), in...), nil
+}
+func (doubler) ProcessStream(_ context.Context, _ model.Workflow, _ model.Node, in <-chan model.Item, emit func(model.Port, model.Item) error) error {
+	for it := range in {
+		for i := 0; i < 2; i++ {
+			if err := emit(model.PortMain, it); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	plugin.Register("test:doubler", func() plugin.NodeHandler { return doubler{} })
+}
+
+func TestRunStreamingPipelinesItems(t *testing.T) {
+	wf := model.Workflow{
+		ID: "wf_stream",
+		Nodes: []model.Node{
+			{ID: "src", Type: "test:pass"},
+			{ID: "dbl", Type: "test:doubler"},
+			{ID: "sink", Type: "test:pass", Concurrency: 4},
+		},
+		Edges: []model.Edge{
+			{FromNode: "src", FromPort: model.PortMain, ToNode: "dbl", ToPort: model.PortMain},
+			{FromNode: "dbl", FromPort: model.PortMain, ToNode: "sink", ToPort: model.PortMain},
+		},
+		Settings: map[string]any{"execution_mode": ModeStreaming},
+	}
+	in := make(model.Items, 500)
+	for i := range in {
+		in[i] = model.Item{"i": i}
+	}
+
+	eng := New(testDeps())
+	eng.Options["dbl"] = NodeRuntimeOptions{QueueSize: 1}
+	eng.Options["sink"] = NodeRuntimeOptions{QueueSize: 1}
+	res, err := eng.Run(context.Background(), "exec-stream", wf, map[model.ID]model.Items{"src": in})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := len(res["sink"]); got != 1000 {
+		t.Fatalf("expected 1000 sink items, got %d", got)
+	}
+	if _, ok := res["src"]; ok {
+		t.Fatalf("intermediate outputs should not be retained in streaming mode")
+	}
+}
+
+// generator emits two items whatever it is given
+type generator struct{}
+
+func (generator) Init(context.Context, plugin.Deps) error { return nil }
+func (generator) Process(context.Context, model.Workflow, model.Node, model.Items) (model.Items, error) {
+	return model.Items{{"n": 1}, {"n": 2}}, nil
+}
+
+func init() {
+	plugin.Register("test:generator", func() plugin.NodeHandler { return generator{} })
+}
+
+func TestRunStreamingRunsSourcesOnce(t *testing.T) {
+	wf := model.Workflow{
+		ID: "wf_stream_source",
+		Nodes: []model.Node{
+			{ID: "gen", Type: "test:generator"},
+			{ID: "sink", Type: "test:pass"},
+		},
+		Edges:    []model.Edge{{FromNode: "gen", FromPort: model.PortMain, ToNode: "sink", ToPort: model.PortMain}},
+		Settings: map[string]any{"execution_mode": ModeStreaming},
+	}
+	res, err := New(testDeps()).Run(context.Background(), "exec-stream-source", wf, nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := len(res["sink"]); got != 2 {
+		t.Fatalf("expected the source to run once and emit 2 items, got %d", got)
+	}
+}
+
+var streamCounted int32
+
+// counter counts the items it passes on
+type counter struct{}
+
+func (counter) Init(context.Context, plugin.Deps) error { return nil }
+func (counter) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	atomic.AddInt32(&streamCounted, int32(len(in)))
+	return in, nil
+}
+
+// broken fails on every call
+type broken struct{}
+
+func (broken) Init(context.Context, plugin.Deps) error { return nil }
+func (broken) Process(context.Context, model.Workflow, model.Node, model.Items) (model.Items, error) {
+	return nil, errors.New("broken")
+}
+
+func init() {
+	plugin.Register("test:counter", func() plugin.NodeHandler { return counter{} })
+	plugin.Register("test:broken", func() plugin.NodeHandler { return broken{} })
+}
+
+func TestRunStreamingStopsUpstreamOnFailure(t *testing.T) {
+	wf := model.Workflow{
+		ID: "wf_stream_fail",
+		Nodes: []model.Node{
+			{ID: "count", Type: "test:counter"},
+			{ID: "sink", Type: "test:broken"},
+		},
+		Edges:    []model.Edge{{FromNode: "count", FromPort: model.PortMain, ToNode: "sink", ToPort: model.PortMain}},
+		Settings: map[string]any{"execution_mode": ModeStreaming},
+	}
+	in := make(model.Items, 500)
+	for i := range in {
+		in[i] = model.Item{"i": i}
+	}
+	eng := New(testDeps())
+	eng.Options["sink"] = NodeRuntimeOptions{QueueSize: 1}
+	if _, err := eng.Run(context.Background(), "exec-stream-fail", wf, map[model.ID]model.Items{"count": in}); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	if n := atomic.LoadInt32(&streamCounted); n >= int32(len(in)) {
+		t.Fatalf("upstream kept processing after the failure: %d items", n)
+	}
+}
+
+func TestRunStreamingDefaultsEmptyPorts(t *testing.T) {
+	wf := model.Workflow{
+		ID: "wf_stream_ports",
+		Nodes: []model.Node{
+			{ID: "src", Type: "test:pass"},
+			{ID: "sink", Type: "test:pass"},
+		},
+		Edges:    []model.Edge{{FromNode: "src", ToNode: "sink"}},
+		Settings: map[string]any{"execution_mode": ModeStreaming},
+	}
+	res, err := New(testDeps()).Run(context.Background(), "exec-stream-ports", wf, map[model.ID]model.Items{"src": {{"n": 1}, {"n": 2}}})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := len(res["sink"]); got != 2 {
+		t.Fatalf("expected 2 items through the unnamed ports, got %d", got)
+	}
+}
@@ -0,0 +1,271 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// Diagnostic codes reported by Validate
+const (
+	DiagDuplicateNode  = "duplicate_node"
+	DiagUnknownNode    = "unknown_node"
+	DiagUnknownType    = "unknown_type"
+	DiagUnknownPort    = "unknown_port"
+	DiagCycle          = "cycle"
+	DiagInvalidOnError = "invalid_on_error"
+	DiagInvalidTimeout = "invalid_timeout"
+	DiagUnsupported    = "unsupported"
+)
+
+// Diagnostic describes a single problem found in a workflow definition
+type Diagnostic struct {
+	Code    string     `json:"code"`
+	Message string     `json:"message"`
+	Node    model.ID   `json:"node,omitempty"`
+	Path    []model.ID `json:"path,omitempty"`
+}
+
+// Diagnostics is the result of validating a workflow
+type Diagnostics []Diagnostic
+
+// Err returns nil when there are no diagnostics, otherwise a *ValidationError
+func (d Diagnostics) Err() error {
+	if len(d) == 0 {
+		return nil
+	}
+	return &ValidationError{Diagnostics: d}
+}
+
+// ValidationError is returned by Run when a workflow fails validation
+type ValidationError struct {
+	Diagnostics Diagnostics
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		msgs = append(msgs, d.Message)
+	}
+	return "invalid workflow: " + strings.Join(msgs, "; ")
+}
+
+// Optional: ported nodes declare which ports they can emit so edges from
+// other ports can be rejected up front. Plain nodes only emit on PortMain.
+type portDeclarer interface {
+	OutputPorts(node model.Node) []model.Port
+}
+
+// Validate checks a workflow for structural problems before anything runs:
+// duplicate node IDs, edges to unknown nodes, unregistered node types,
+// unknown on_error modes, edges from ports a node never emits or into ports
+// it never reads, and cycles.
+func Validate(wf model.Workflow) Diagnostics {
+	var diags Diagnostics
+
+	nodes := make(map[model.ID]model.Node, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		if _, dup := nodes[n.ID]; dup {
+			diags = append(diags, Diagnostic{
+				Code:    DiagDuplicateNode,
+				Message: fmt.Sprintf("duplicate node id %q", n.ID),
+				Node:    n.ID,
+			})
+			continue
+		}
+		nodes[n.ID] = n
+	}
+
+	// Resolve emitted and read ports per node type once
+	ports := make(map[model.ID]map[model.Port]bool, len(nodes))
+	inPorts := make(map[model.ID]map[model.Port]bool, len(nodes))
+	for _, n := range wf.Nodes {
+		if _, seen := ports[n.ID]; seen {
+			continue
+		}
+		handler, ok := plugin.New(n.Type)
+		if !ok {
+			diags = append(diags, Diagnostic{
+				Code:    DiagUnknownType,
+				Message: fmt.Sprintf("node %q has unregistered type %q", n.ID, n.Type),
+				Node:    n.ID,
+			})
+			ports[n.ID] = nil
+			continue
+		}
+		ports[n.ID] = emittedPorts(handler, n)
+		inPorts[n.ID] = readPorts(handler, n)
+		if _, ok := handler.(inputPortProcessor); ok && streamingEnabled(wf) {
+			diags = append(diags, Diagnostic{
+				Code:    DiagUnsupported,
+				Message: fmt.Sprintf("node %q (%s) reads several input ports, which streaming mode does not support", n.ID, n.Type),
+				Node:    n.ID,
+			})
+		}
+		if n.Timeout < 0 {
+			diags = append(diags, Diagnostic{
+				Code:    DiagInvalidTimeout,
+				Message: fmt.Sprintf("node %q has an invalid timeout; expected a non-negative duration such as \"10m\"", n.ID),
+				Node:    n.ID,
+			})
+		}
+		switch onErrorMode(n) {
+		case model.OnErrorFail, model.OnErrorContinue:
+		case model.OnErrorRoute:
+			if ports[n.ID] != nil {
+				ports[n.ID][model.PortError] = true
+			}
+		default:
+			diags = append(diags, Diagnostic{
+				Code:    DiagInvalidOnError,
+				Message: fmt.Sprintf("node %q has unknown on_error mode %q", n.ID, n.OnError),
+				Node:    n.ID,
+			})
+		}
+	}
+
+	for _, e := range wf.Edges {
+		from, okFrom := nodes[e.FromNode]
+		if !okFrom {
+			diags = append(diags, Diagnostic{
+				Code:    DiagUnknownNode,
+				Message: fmt.Sprintf("edge %s -> %s references unknown node %q", e.FromNode, e.ToNode, e.FromNode),
+				Node:    e.FromNode,
+			})
+		}
+		if to, ok := nodes[e.ToNode]; !ok {
+			diags = append(diags, Diagnostic{
+				Code:    DiagUnknownNode,
+				Message: fmt.Sprintf("edge %s -> %s references unknown node %q", e.FromNode, e.ToNode, e.ToNode),
+				Node:    e.ToNode,
+			})
+		} else if read := inPorts[to.ID]; read != nil && !read[portOrMain(e.ToPort)] {
+			diags = append(diags, Diagnostic{
+				Code:    DiagUnknownPort,
+				Message: fmt.Sprintf("node %q (%s) has no input port %q", to.ID, to.Type, e.ToPort),
+				Node:    to.ID,
+			})
+		}
+		if !okFrom {
+			continue
+		}
+		// nil means "unknown": either the type is unregistered (already
+		// reported) or the node did not declare its ports
+		if emitted := ports[from.ID]; emitted != nil && !emitted[portOrMain(e.FromPort)] {
+			diags = append(diags, Diagnostic{
+				Code:    DiagUnknownPort,
+				Message: fmt.Sprintf("node %q (%s) never emits on port %q", from.ID, from.Type, e.FromPort),
+				Node:    from.ID,
+			})
+		}
+	}
+
+	for _, path := range findCycles(wf, nodes) {
+		parts := make([]string, len(path))
+		for i, id := range path {
+			parts[i] = string(id)
+		}
+		diags = append(diags, Diagnostic{
+			Code:    DiagCycle,
+			Message: "cycle detected: " + strings.Join(parts, " -> "),
+			Node:    path[0],
+			Path:    path,
+		})
+	}
+
+	return diags
+}
+
+func emittedPorts(handler plugin.NodeHandler, node model.Node) map[model.Port]bool {
+	if pd, ok := handler.(portDeclarer); ok {
+		out := map[model.Port]bool{}
+		for _, p := range pd.OutputPorts(node) {
+			out[p] = true
+		}
+		return out
+	}
+	if _, ok := handler.(portedProcessor); ok {
+		// ported but undeclared: can't tell statically
+		return nil
+	}
+	return map[model.Port]bool{model.PortMain: true}
+}
+
+// readPorts is like emittedPorts for input ports: plain nodes only read
+// PortMain, input-port nodes read what they declare, or anything
+func readPorts(handler plugin.NodeHandler, node model.Node) map[model.Port]bool {
+	if _, ok := handler.(inputPortProcessor); !ok {
+		return map[model.Port]bool{model.PortMain: true}
+	}
+	pd, ok := handler.(inputPortDeclarer)
+	if !ok {
+		return nil
+	}
+	in := map[model.Port]bool{model.PortMain: true}
+	for _, p := range pd.InputPorts(node) {
+		in[p] = true
+	}
+	return in
+}
+
+func portOrMain(p model.Port) model.Port {
+	if p == "" {
+		return model.PortMain
+	}
+	return p
+}
+
+// findCycles runs a DFS over known nodes in declaration order and returns
+// one path per back edge found, closed with the repeated node.
+func findCycles(wf model.Workflow, nodes map[model.ID]model.Node) [][]model.ID {
+	out := map[model.ID][]model.ID{}
+	for _, e := range wf.Edges {
+		if _, ok := nodes[e.FromNode]; !ok {
+			continue
+		}
+		if _, ok := nodes[e.ToNode]; !ok {
+			continue
+		}
+		out[e.FromNode] = append(out[e.FromNode], e.ToNode)
+	}
+
+	const (
+		white = iota
+		grey
+		black
+	)
+	color := map[model.ID]int{}
+	var stack []model.ID
+	var cycles [][]model.ID
+
+	var visit func(v model.ID)
+	visit = func(v model.ID) {
+		color[v] = grey
+		stack = append(stack, v)
+		for _, u := range out[v] {
+			switch color[u] {
+			case white:
+				visit(u)
+			case grey:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == u {
+						path := append([]model.ID{}, stack[i:]...)
+						cycles = append(cycles, append(path, u))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[v] = black
+	}
+
+	for _, n := range wf.Nodes {
+		if color[n.ID] == white {
+			visit(n.ID)
+		}
+	}
+	return cycles
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+type passNode struct{}
+
+func (passNode) Init(context.Context, plugin.Deps) error { return nil }
+func (passNode) Process(_ context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	return in, nil
+}
+
+func init() {
+	plugin.Register("test:pass", func() plugin.NodeHandler { return passNode{} })
+}
+
+func codes(diags Diagnostics) map[string]int {
+	out := map[string]int{}
+	for _, d := range diags {
+		out[d.Code]++
+	}
+	return out
+}
+
+func TestValidateAcceptsDAG(t *testing.T) {
+	wf := model.Workflow{
+		Nodes: []model.Node{{ID: "a", Type: "test:pass"}, {ID: "b", Type: "test:pass"}},
+		Edges: []model.Edge{{FromNode: "a", FromPort: model.PortMain, ToNode: "b", ToPort: model.PortMain}},
+	}
+	if diags := Validate(wf); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+}
+
+func TestValidateReportsCycleWithPath(t *testing.T) {
+	wf := model.Workflow{
+		Nodes: []model.Node{{ID: "a", Type: "test:pass"}, {ID: "b", Type: "test:pass"}, {ID: "c", Type: "test:pass"}},
+		Edges: []model.Edge{
+			{FromNode: "a", FromPort: model.PortMain, ToNode: "b", ToPort: model.PortMain},
+			{FromNode: "b", FromPort: model.PortMain, ToNode: "c", ToPort: model.PortMain},
+			{FromNode: "c", FromPort: model.PortMain, ToNode: "b", ToPort: model.PortMain},
+		},
+	}
+	diags := Validate(wf)
+	if len(diags) != 1 || diags[0].Code != DiagCycle {
+		t.Fatalf("expected one cycle diagnostic, got %+v", diags)
+	}
+	want := []model.ID{"b", "c", "b"}
+	if len(diags[0].Path) != len(want) {
+		t.Fatalf("expected path %v, got %v", want, diags[0].Path)
+	}
+	for i := range want {
+		if diags[0].Path[i] != want[i] {
+			t.Fatalf("expected path %v, got %v", want, diags[0].Path)
+		}
+	}
+
+	_, err := New(plugin.Deps{}).Run(context.Background(), "exec-cycle", wf, nil)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected Run to fail validation, got %v", err)
+	}
+}
+
+func TestValidateReportsStructuralProblems(t *testing.T) {
+	wf := model.Workflow{
+		Nodes: []model.Node{
+			{ID: "a", Type: "test:pass"},
+			{ID: "a", Type: "test:pass"},
+			{ID: "b", Type: "test:missing"},
+		},
+		Edges: []model.Edge{
+			{FromNode: "a", FromPort: model.PortMain, ToNode: "ghost", ToPort: model.PortMain},
+			{FromNode: "a", FromPort: "true", ToNode: "b", ToPort: model.PortMain},
+		},
+	}
+	got := codes(Validate(wf))
+	want := map[string]int{DiagDuplicateNode: 1, DiagUnknownType: 1, DiagUnknownNode: 1, DiagUnknownPort: 1}
+	for code, n := range want {
+		if got[code] != n {
+			t.Errorf("expected %d %s diagnostics, got %d (all: %v)", n, code, got[code], got)
+		}
+	}
+}
+
+func TestValidateReportsInvalidTimeout(t *testing.T) {
+	wf := model.Workflow{Nodes: []model.Node{{ID: "a", Type: "test:pass", Timeout: -1}}}
+	diags := Validate(wf)
+	if len(diags) != 1 || diags[0].Code != DiagInvalidTimeout || diags[0].Node != "a" {
+		t.Fatalf("expected an invalid timeout diagnostic, got %+v", diags)
+	}
+}
@@ -1,6 +1,8 @@
 package n8n
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/Tsinling0525/rivulet/model"
@@ -25,18 +27,33 @@ type N8nNode struct {
 	Position    []float64              `json:"position"`
 	Parameters  map[string]interface{} `json:"parameters"`
 	Credentials map[string]interface{} `json:"credentials"`
+	// OnError is "fail", "continue" or "route"; n8n's stopWorkflow,
+	// continueRegularOutput and continueErrorOutput are accepted too
+	OnError string `json:"onError,omitempty"`
+	// Timeout bounds one run of the node as a Go duration ("5m"); "0"
+	// disables it. Defaults to DefaultNodeTimeout.
+	Timeout string `json:"timeout,omitempty"`
 }
 
+// DefaultNodeTimeout applies to nodes that don't set a timeout
+const DefaultNodeTimeout = 30 * time.Second
+
 // N8nConnections represents n8n node connections
 type N8nConnections struct {
 	Main [][]N8nConnection `json:"main"`
 }
 
-// N8nConnection represents a single connection
+// N8nConnection represents a single connection. FromPort names the source
+// port when it is not main; without it the second output of a node that
+// routes errors is its error port, as in n8n. ToPort names the target's
+// input port; without it input Index n > 0 is port "input<n+1>", so n8n's
+// second merge input is input2.
 type N8nConnection struct {
-	Node  string `json:"node"`
-	Type  string `json:"type"`
-	Index int    `json:"index"`
+	Node     string `json:"node"`
+	Type     string `json:"type"`
+	Index    int    `json:"index"`
+	FromPort string `json:"fromPort,omitempty"`
+	ToPort   string `json:"toPort,omitempty"`
 }
 
 // N8nRequest represents the full n8n API request
@@ -58,8 +75,9 @@ func ParseWorkflow(n8nWF N8nWorkflow) model.Workflow {
 			Type:        n8nNode.Type,
 			Name:        n8nNode.Name,
 			Config:      n8nNode.Parameters,
-			Timeout:     30 * time.Second, // Default timeout
-			Concurrency: 1,                // Default concurrency
+			Timeout:     parseTimeout(n8nNode.Timeout),
+			Concurrency: 1, // Default concurrency
+			OnError:     parseOnError(n8nNode.OnError),
 		}
 
 		// Handle credentials if present
@@ -76,17 +94,41 @@ func ParseWorkflow(n8nWF N8nWorkflow) model.Workflow {
 		nodes[i].Config["_n8n_position"] = n8nNode.Position
 	}
 
-	// Convert connections to edges
-	for fromNodeID, connections := range n8nWF.Connections {
-		mainConns := connections.Main
+	onError := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		onError[string(n.ID)] = n.OnError
+	}
+
+	// Convert connections to edges (sorted so edge order is stable)
+	fromIDs := make([]string, 0, len(n8nWF.Connections))
+	for fromNodeID := range n8nWF.Connections {
+		fromIDs = append(fromIDs, fromNodeID)
+	}
+	sort.Strings(fromIDs)
+	for _, fromNodeID := range fromIDs {
+		mainConns := n8nWF.Connections[fromNodeID].Main
 		if len(mainConns) > 0 {
-			for _, connGroup := range mainConns {
+			for output, connGroup := range mainConns {
 				for _, conn := range connGroup {
+					fromPort := model.PortMain
+					switch {
+					case conn.FromPort != "":
+						fromPort = model.Port(conn.FromPort)
+					case output == 1 && onError[fromNodeID] == model.OnErrorRoute:
+						fromPort = model.PortError
+					}
+					toPort := model.PortMain
+					switch {
+					case conn.ToPort != "":
+						toPort = model.Port(conn.ToPort)
+					case conn.Index > 0:
+						toPort = model.Port(fmt.Sprintf("input%d", conn.Index+1))
+					}
 					edges = append(edges, model.Edge{
 						FromNode: model.ID(fromNodeID),
-						FromPort: model.PortMain,
+						FromPort: fromPort,
 						ToNode:   model.ID(conn.Node),
-						ToPort:   model.PortMain,
+						ToPort:   toPort,
 					})
 				}
 			}
@@ -94,10 +136,26 @@ func ParseWorkflow(n8nWF N8nWorkflow) model.Workflow {
 	}
 
 	return model.Workflow{
-		ID:    model.ID(n8nWF.ID),
-		Name:  n8nWF.Name,
-		Nodes: nodes,
-		Edges: edges,
+		ID:       model.ID(n8nWF.ID),
+		Name:     n8nWF.Name,
+		Nodes:    nodes,
+		Edges:    edges,
+		Settings: n8nWF.Settings,
+	}
+}
+
+// parseOnError maps n8n's onError values onto Rivulet's modes; anything
+// else is kept so validation can report it
+func parseOnError(v string) string {
+	switch v {
+	case "stopWorkflow":
+		return model.OnErrorFail
+	case "continueRegularOutput":
+		return model.OnErrorContinue
+	case "continueErrorOutput":
+		return model.OnErrorRoute
+	default:
+		return v
 	}
 }
 
@@ -150,3 +208,73 @@ func GetN8nMetadata(node model.Node) (typeVersion float64, position []float64, c
 	}
 	return typeVersion, position, credentials
 }
+
+// FromRivulet converts a Rivulet workflow back to the n8n format, restoring
+// the n8n metadata ParseWorkflow keeps in node config
+func FromRivulet(wf model.Workflow) N8nWorkflow {
+	out := N8nWorkflow{
+		ID:          string(wf.ID),
+		Name:        wf.Name,
+		Nodes:       make([]N8nNode, 0, len(wf.Nodes)),
+		Connections: map[string]N8nConnections{},
+		Settings:    wf.Settings,
+	}
+	for _, node := range wf.Nodes {
+		typeVersion, position, credentials := GetN8nMetadata(node)
+		params := make(map[string]interface{}, len(node.Config))
+		for k, v := range node.Config {
+			switch k {
+			case "_n8n_typeVersion", "_n8n_position", "_credentials":
+				continue
+			}
+			params[k] = v
+		}
+		out.Nodes = append(out.Nodes, N8nNode{
+			ID:          string(node.ID),
+			Name:        node.Name,
+			Type:        node.Type,
+			TypeVersion: typeVersion,
+			Position:    position,
+			Parameters:  params,
+			Credentials: credentials,
+			OnError:     node.OnError,
+			Timeout:     formatTimeout(node.Timeout),
+		})
+	}
+	for _, edge := range wf.Edges {
+		conns := out.Connections[string(edge.FromNode)]
+		if len(conns.Main) == 0 {
+			conns.Main = [][]N8nConnection{{}}
+		}
+		conn := N8nConnection{Node: string(edge.ToNode), Type: "main", Index: 0}
+		if edge.FromPort != "" && edge.FromPort != model.PortMain {
+			conn.FromPort = string(edge.FromPort)
+		}
+		if edge.ToPort != "" && edge.ToPort != model.PortMain {
+			conn.ToPort = string(edge.ToPort)
+		}
+		conns.Main[0] = append(conns.Main[0], conn)
+		out.Connections[string(edge.FromNode)] = conns
+	}
+	return out
+}
+
+// parseTimeout reads a node timeout. An invalid one becomes negative so
+// engine.Validate reports it instead of the default silently applying.
+func parseTimeout(s string) time.Duration {
+	if s == "" {
+		return DefaultNodeTimeout
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return -1
+	}
+	return d
+}
+
+func formatTimeout(d time.Duration) string {
+	if d == DefaultNodeTimeout {
+		return ""
+	}
+	return d.String()
+}
@@ -2,6 +2,7 @@ package n8n
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Tsinling0525/rivulet/model"
 )
@@ -190,3 +191,75 @@ func TestGetN8nMetadata(t *testing.T) {
 		t.Errorf("Expected credentials to be extracted")
 	}
 }
+
+func TestFromRivuletRoundTrip(t *testing.T) {
+	n8nWF := N8nWorkflow{
+		ID:   "wf",
+		Name: "Round Trip",
+		Nodes: []N8nNode{
+			{ID: "a", Name: "A", Type: "echo", TypeVersion: 2, Position: []float64{1, 2}, Parameters: map[string]interface{}{"label": "x"}},
+			{ID: "b", Name: "B", Type: "echo", Parameters: map[string]interface{}{}},
+		},
+		Connections: map[string]N8nConnections{
+			"a": {Main: [][]N8nConnection{{{Node: "b", Type: "main", Index: 0}}}},
+		},
+		Settings: map[string]interface{}{"max_parallelism": 2},
+	}
+
+	back := FromRivulet(ParseWorkflow(n8nWF))
+
+	if back.ID != "wf" || len(back.Nodes) != 2 || back.Settings["max_parallelism"] != 2 {
+		t.Fatalf("unexpected workflow: %+v", back)
+	}
+	if _, ok := back.Nodes[0].Parameters["_n8n_typeVersion"]; ok {
+		t.Errorf("n8n metadata leaked into parameters: %v", back.Nodes[0].Parameters)
+	}
+	if back.Nodes[0].TypeVersion != 2 || len(back.Nodes[0].Position) != 2 {
+		t.Errorf("metadata not restored: %+v", back.Nodes[0])
+	}
+	conns := back.Connections["a"].Main
+	if len(conns) != 1 || len(conns[0]) != 1 || conns[0][0].Node != "b" {
+		t.Errorf("unexpected connections: %+v", back.Connections)
+	}
+}
+
+func TestParseWorkflowErrorOutput(t *testing.T) {
+	wf := ParseWorkflow(N8nWorkflow{
+		Nodes: []N8nNode{
+			{ID: "call", Type: "http", OnError: "continueErrorOutput", Parameters: map[string]interface{}{}},
+			{ID: "ok", Type: "echo", Parameters: map[string]interface{}{}},
+			{ID: "alert", Type: "echo", Parameters: map[string]interface{}{}},
+		},
+		Connections: map[string]N8nConnections{
+			"call": {Main: [][]N8nConnection{
+				{{Node: "ok", Type: "main"}},
+				{{Node: "alert", Type: "main"}},
+			}},
+		},
+	})
+	if wf.Nodes[0].OnError != model.OnErrorRoute {
+		t.Fatalf("onError = %q", wf.Nodes[0].OnError)
+	}
+	if len(wf.Edges) != 2 || wf.Edges[0].FromPort != model.PortMain || wf.Edges[1].FromPort != model.PortError {
+		t.Fatalf("edges = %+v", wf.Edges)
+	}
+	back := FromRivulet(wf)
+	if back.Nodes[0].OnError != model.OnErrorRoute || back.Connections["call"].Main[0][1].FromPort != "error" {
+		t.Fatalf("round trip lost error routing: %+v", back)
+	}
+}
+
+func TestParseWorkflowInvalidTimeout(t *testing.T) {
+	wf := ParseWorkflow(N8nWorkflow{Nodes: []N8nNode{
+		{ID: "slow", Type: "echo", Timeout: "10m", Parameters: map[string]interface{}{}},
+		{ID: "typo", Type: "echo", Timeout: "10 minutes", Parameters: map[string]interface{}{}},
+		{ID: "neg", Type: "echo", Timeout: "-1s", Parameters: map[string]interface{}{}},
+		{ID: "none", Type: "echo", Parameters: map[string]interface{}{}},
+	}})
+	if wf.Nodes[0].Timeout != 10*time.Minute || wf.Nodes[3].Timeout != DefaultNodeTimeout {
+		t.Fatalf("timeouts %v %v", wf.Nodes[0].Timeout, wf.Nodes[3].Timeout)
+	}
+	if wf.Nodes[1].Timeout >= 0 || wf.Nodes[2].Timeout >= 0 {
+		t.Fatalf("invalid timeouts not flagged: %v %v", wf.Nodes[1].Timeout, wf.Nodes[2].Timeout)
+	}
+}
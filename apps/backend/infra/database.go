@@ -0,0 +1,116 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Tsinling0525/rivulet/infra/repository"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// OpenDefaultRepository opens the database from DatabaseConfig and applies
+// pending migrations. It returns nil without error when the database is disabled.
+func OpenDefaultRepository(ctx context.Context) (*repository.Repository, error) {
+	driver, dsn := DatabaseConfig()
+	if driver == "none" {
+		return nil, nil
+	}
+	if driver == "sqlite" {
+		if err := ensureDir(DataDir()); err != nil {
+			return nil, err
+		}
+	}
+	repo, err := repository.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.Migrate(ctx); err != nil {
+		repo.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// fileRunSlugPrefix marks the stored workflows that record workflow file
+// runs; stored workflows can't be created with it
+const fileRunSlugPrefix = "file:"
+
+// fileRunSlug is the slug runs of the workflow file with ID id are
+// recorded under
+func fileRunSlug(id model.ID) string { return fileRunSlugPrefix + string(id) }
+
+// beginRun records the start of an execution as a workflow run and
+// returns the run ID with the version number it ran. Executions of a stored
+// version are recorded against it. Others, run from a workflow file, are
+// only recorded when RecordFileRuns is on, creating the workflow and a
+// version of their definition when needed. They are kept under
+// fileRunSlug, apart from stored workflows of the same ID. The run ID is
+// "" when the run isn't recorded.
+func (m *InstanceManager) beginRun(ctx context.Context, execID string, wf model.Workflow, opts execOptions) (string, int) {
+	versionID := opts.versionID
+	if m.repo == nil || (versionID == "" && (wf.ID == "" || !m.recordFileRuns)) {
+		return "", 0
+	}
+	var (
+		v   repository.Version
+		err error
+	)
+	if versionID != "" {
+		v, err = m.repo.GetVersion(ctx, versionID)
+	} else {
+		var config json.RawMessage
+		if config, err = canonicalConfig(wf); err == nil {
+			_, v, err = m.repo.EnsureVersion(ctx, fileRunSlug(wf.ID), wf, config, "recorded from execution")
+		}
+	}
+	if err != nil {
+		m.warnf("record run %s: %v", execID, err)
+		return "", 0
+	}
+	nodes, err := m.repo.NodeIDs(ctx, v.ID)
+	if err != nil {
+		m.warnf("record run %s: %v", execID, err)
+		return "", 0
+	}
+	trigger := "api"
+	switch {
+	case opts.parent != "":
+		trigger = "workflow"
+	case opts.triggeredBy != "":
+		trigger = "error"
+	case opts.instanceID != "":
+		trigger = "instance"
+	}
+	runCtx, _ := json.Marshal(map[string]string{
+		"execution_id":        execID,
+		"instance_id":         opts.instanceID,
+		"parent_execution_id": opts.parent,
+		"triggered_by":        opts.triggeredBy,
+	})
+	run, err := m.repo.CreateRun(ctx, repository.Run{WorkflowID: v.WorkflowID, VersionID: v.ID, Trigger: trigger, Context: runCtx})
+	if err != nil {
+		m.warnf("record run %s: %v", execID, err)
+		return "", 0
+	}
+	m.events.Track(execID, run.ID, nodes)
+	return run.ID, v.Number
+}
+
+// finishRun stores the outcome of a run started by beginRun
+func (m *InstanceManager) finishRun(runID string, rec ExecutionRecord) {
+	if runID == "" {
+		return
+	}
+	m.events.Untrack(rec.ExecutionID)
+	metrics := map[string]any{"duration_ms": rec.DurationMS, "nodes": len(rec.Nodes)}
+	err := m.repo.FinishRun(context.Background(), runID, repository.RunStatus(rec.Status), metrics, rec.Error)
+	if err != nil {
+		m.warnf("finish run %s: %v", runID, err)
+	}
+}
+
+func (m *InstanceManager) warnf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", a...)
+}
@@ -0,0 +1,272 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// DeadLetter is the input of a queued execution that failed on its last
+// attempt, kept until it is replayed or purged
+type DeadLetter struct {
+	ID          string                   `json:"id"` // the job ID
+	InstanceID  string                   `json:"instance_id"`
+	WorkflowID  model.ID                 `json:"workflow_id"`
+	ExecutionID string                   `json:"execution_id"` // of the last attempt
+	Inputs      map[model.ID]model.Items `json:"inputs,omitempty"`
+	Error       string                   `json:"error"`
+	Attempts    int                      `json:"attempts"`
+	EnqueuedAt  time.Time                `json:"enqueued_at"`
+	FailedAt    time.Time                `json:"failed_at"`
+}
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetterStore keeps dead letters as one JSON file each in a directory
+type DeadLetterStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewDeadLetterStore(dir string) *DeadLetterStore { return &DeadLetterStore{dir: dir} }
+
+func (s *DeadLetterStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+// Add stores a dead letter, replacing one with the same ID
+func (s *DeadLetterStore) Add(dl DeadLetter) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ensureDir(s.dir); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(dl.ID), b)
+}
+
+// List returns the dead letters, oldest failure first. Unreadable files
+// are skipped.
+func (s *DeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []DeadLetter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(b, &dl); err != nil {
+			continue
+		}
+		out = append(out, dl)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FailedAt.Before(out[j].FailedAt) })
+	return out, nil
+}
+
+// Get loads one dead letter
+func (s *DeadLetterStore) Get(id string) (DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var dl DeadLetter
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return dl, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return dl, err
+	}
+	return dl, json.Unmarshal(b, &dl)
+}
+
+// Delete removes a dead letter
+func (s *DeadLetterStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrDeadLetterNotFound
+	}
+	return err
+}
+
+// adoptDeadLetters moves the dead letters under dir that no running
+// instance holds into store; m.queuesMu must be held
+func (m *InstanceManager) adoptDeadLetters(store *DeadLetterStore, dir, self string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == self {
+			continue
+		}
+		if _, open := m.queues[e.Name()]; open {
+			continue
+		}
+		orphan := filepath.Join(dir, e.Name())
+		files, err := os.ReadDir(orphan)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			if err := ensureDir(store.dir); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+				continue
+			}
+			if err := os.Rename(filepath.Join(orphan, f.Name()), filepath.Join(store.dir, f.Name())); err != nil {
+				return err
+			}
+		}
+		if err := os.RemoveAll(orphan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadLetter moves the input of a job whose last attempt failed to the
+// dead letters of inst
+func (m *InstanceManager) deadLetter(inst *Instance, job Job, rec ExecutionRecord) {
+	dl := DeadLetter{
+		ID:          job.ID,
+		InstanceID:  inst.ID,
+		WorkflowID:  rec.WorkflowID,
+		ExecutionID: rec.ExecutionID,
+		Inputs:      job.Inputs,
+		Error:       rec.Error,
+		Attempts:    job.Attempts,
+		EnqueuedAt:  job.EnqueuedAt,
+		FailedAt:    rec.FinishedAt,
+	}
+	if err := inst.deadLetters.Add(dl); err != nil {
+		// keep the job queued rather than lose its input; it is delivered
+		// again once its lease runs out
+		inst.logf("job %s not dead-lettered: %v", job.ID, err)
+		return
+	}
+	inst.logf("job %s dead-lettered after %d attempt(s)", job.ID, job.Attempts)
+	m.deps.Bus.Emit(context.Background(), "job_dead_lettered", map[string]any{"instance": inst.ID, "exec": rec.ExecutionID, "job": job.ID, "error": rec.Error})
+	if err := inst.q.Ack(job.ID); err != nil {
+		inst.logf("job %s not acked: %v", job.ID, err)
+	}
+}
+
+func (m *InstanceManager) instance(id string) (*Instance, error) {
+	m.mu.Lock()
+	inst, ok := m.items[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("instance not found")
+	}
+	return inst, nil
+}
+
+// DeadLetters lists the dead letters of the instance
+func (m *InstanceManager) DeadLetters(id string) ([]DeadLetter, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+	return inst.deadLetters.List()
+}
+
+// selectDeadLetters loads the letters named by ids, or all of them
+func selectDeadLetters(store *DeadLetterStore, ids []string, all bool) ([]DeadLetter, error) {
+	if all {
+		return store.List()
+	}
+	out := make([]DeadLetter, 0, len(ids))
+	for _, lid := range ids {
+		dl, err := store.Get(lid)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lid, err)
+		}
+		out = append(out, dl)
+	}
+	return out, nil
+}
+
+// ReplayDeadLetters queues the inputs of the named dead letters (or all of
+// them) again as new executions and removes the letters. It returns the
+// new execution IDs by letter ID; on error the letters replayed so far are
+// still returned.
+func (m *InstanceManager) ReplayDeadLetters(ctx context.Context, id string, ids []string, all bool) (map[string]string, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+	letters, err := selectDeadLetters(inst.deadLetters, ids, all)
+	if err != nil {
+		return nil, err
+	}
+	replayed := make(map[string]string, len(letters))
+	for _, dl := range letters {
+		execID := newExecID()
+		if err := m.enqueue(ctx, inst, execID, dl.Inputs); err != nil {
+			return replayed, fmt.Errorf("%s: %w", dl.ID, err)
+		}
+		if err := inst.deadLetters.Delete(dl.ID); err != nil && !errors.Is(err, ErrDeadLetterNotFound) {
+			inst.logf("dead letter %s replayed but not removed: %v", dl.ID, err)
+		}
+		replayed[dl.ID] = execID
+		inst.logf("dead letter %s replayed as %s", dl.ID, execID)
+		m.deps.Bus.Emit(ctx, "dead_letter_replayed", map[string]any{"instance": inst.ID, "job": dl.ID, "exec": execID})
+	}
+	return replayed, nil
+}
+
+// PurgeDeadLetters deletes the named dead letters, or all of them, and
+// returns how many were deleted
+func (m *InstanceManager) PurgeDeadLetters(id string, ids []string, all bool) (int, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return 0, err
+	}
+	letters, err := selectDeadLetters(inst.deadLetters, ids, all)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, dl := range letters {
+		if err := inst.deadLetters.Delete(dl.ID); err != nil && !errors.Is(err, ErrDeadLetterNotFound) {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		inst.logf("purged %d dead letter(s)", n)
+	}
+	return n, nil
+}
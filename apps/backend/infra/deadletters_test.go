@@ -0,0 +1,98 @@
+package infra
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+func TestFailedJobsAreDeadLettered(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	writeWorkflowFile(t, "on_error.json", n8n.N8nWorkflow{
+		ID:    "on-error",
+		Nodes: []n8n.N8nNode{{ID: "alert", Name: "Alert", Type: "echo"}},
+	})
+	writeWorkflowFile(t, "flaky.json", n8n.N8nWorkflow{
+		ID:    "flaky",
+		Nodes: []n8n.N8nNode{{ID: "n", Name: "N", Type: "test:fail"}},
+		Settings: map[string]interface{}{
+			"queue":              map[string]any{"max_attempts": 2, "retry_delay": "10ms"},
+			ErrorWorkflowSetting: "on_error.json",
+		},
+	})
+	path := filepath.Join(WorkflowsDir(), "flaky.json")
+	m := NewInstanceManager()
+	inst, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sibling, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		m.Stop(inst.ID)
+		t.Fatal(err)
+	}
+	defer stopAndRelease(m, inst.ID, sibling.ID)
+	waitLetters := func(n int) []DeadLetter {
+		t.Helper()
+		var letters []DeadLetter
+		for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if letters, _ = m.DeadLetters(inst.ID); len(letters) == n && inst.Snapshot().QueueLength == 0 {
+				break
+			}
+		}
+		if len(letters) != n {
+			t.Fatalf("expected %d dead letters, got %d", n, len(letters))
+		}
+		return letters
+	}
+	byExec := func(letters []DeadLetter, execID string) DeadLetter {
+		t.Helper()
+		for _, dl := range letters {
+			if dl.ExecutionID == execID {
+				return dl
+			}
+		}
+		t.Fatalf("no dead letter for %s in %+v", execID, letters)
+		return DeadLetter{}
+	}
+	// the workflow's default manual input fails as well
+	execID, err := m.Enqueue(context.Background(), inst.ID, map[string]model.Items{"n": {{"x": 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := byExec(waitLetters(2), execID+"-2")
+	if dl.Attempts != 2 || dl.ExecutionID != execID+"-2" || dl.Error == "" || dl.Inputs["n"][0]["x"] != float64(1) {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	// only the last attempt starts the error workflow
+	first, _, _ := m.History().Get(execID)
+	last, _, _ := m.History().Get(execID + "-2")
+	if first.Status != ExecutionFailed || first.ErrorExecutionID != "" || last.Status != ExecutionFailed || last.ErrorExecutionID == "" {
+		t.Fatalf("unexpected attempts %+v / %+v", first, last)
+	}
+	siblingLetters, _ := m.DeadLetters(sibling.ID)
+	for _, other := range siblingLetters {
+		if other.InstanceID != sibling.ID {
+			t.Fatalf("sibling lists a letter of %s", other.InstanceID)
+		}
+	}
+
+	replayed, err := m.ReplayDeadLetters(context.Background(), inst.ID, []string{dl.ID}, false)
+	if err != nil || replayed[dl.ID] == "" {
+		t.Fatalf("replay: %v %v", replayed, err)
+	}
+	// the replay fails too and comes back as a new letter
+	again := byExec(waitLetters(2), replayed[dl.ID]+"-2")
+	if again.ID == dl.ID || again.Inputs["n"][0]["x"] != float64(1) {
+		t.Fatalf("unexpected replayed letter %+v", again)
+	}
+	if n, err := m.PurgeDeadLetters(inst.ID, nil, true); err != nil || n != 2 {
+		t.Fatalf("purge: %d %v", n, err)
+	}
+	waitLetters(0)
+}
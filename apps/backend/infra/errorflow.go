@@ -0,0 +1,77 @@
+package infra
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// ErrorWorkflowSetting names the workflow run when an execution fails: a
+// .json file under WorkflowsDir or a stored workflow ID
+const ErrorWorkflowSetting = "error_workflow"
+
+// startErrorWorkflow submits the error workflow configured on wf for the
+// failed execution rec and returns its execution ID, or "" when none is
+// configured or it cannot be loaded.
+func (m *InstanceManager) startErrorWorkflow(ctx context.Context, wf model.Workflow, rec ExecutionRecord) string {
+	ref, _ := wf.Settings[ErrorWorkflowSetting].(string)
+	if ref == "" {
+		return ""
+	}
+	handler, versionID, err := m.LoadWorkflow(ctx, ref)
+	if err != nil {
+		m.warnf("error workflow for %s: %v", rec.ExecutionID, err)
+		return ""
+	}
+
+	item := failureItem(rec)
+	inputs := map[model.ID]model.Items{}
+	for _, id := range engine.Roots(handler) {
+		inputs[id] = model.Items{item}
+	}
+	execID := newExecID()
+	m.submit(execID, handler, inputs, execOptions{instanceID: rec.InstanceID, versionID: versionID, triggeredBy: rec.ExecutionID})
+	return execID
+}
+
+// failureItem describes a failed execution to its error workflow. The
+// failing node is the first one to fail; errors outside any node, such as
+// validation, leave it empty and report the execution's input instead.
+func failureItem(rec ExecutionRecord) model.Item {
+	item := model.Item{
+		"execution_id":  rec.ExecutionID,
+		"instance_id":   rec.InstanceID,
+		"workflow_id":   string(rec.WorkflowID),
+		"workflow_name": rec.WorkflowName,
+		"error":         rec.Error,
+		"node":          "",
+		"failed_at":     rec.FinishedAt.UTC().Format(time.RFC3339Nano),
+	}
+	var failed *NodeExecution
+	for i := range rec.Nodes {
+		n := &rec.Nodes[i]
+		if n.Status == engine.NodeFailed && (failed == nil || n.FinishedAt.Before(failed.FinishedAt)) {
+			failed = n
+		}
+	}
+	if failed == nil {
+		ids := make([]string, 0, len(rec.Input))
+		for id := range rec.Input {
+			ids = append(ids, string(id))
+		}
+		sort.Strings(ids)
+		var input model.Items
+		for _, id := range ids {
+			input = append(input, rec.Input[model.ID(id)]...)
+		}
+		item["input"] = input
+		return item
+	}
+	item["node"] = string(failed.NodeID)
+	item["node_error"] = failed.Error
+	item["input"] = failed.Input
+	return item
+}
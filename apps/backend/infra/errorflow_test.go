@@ -0,0 +1,75 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// failNode fails every batch
+type failNode struct{}
+
+func (failNode) Init(context.Context, plugin.Deps) error { return nil }
+func (failNode) Process(context.Context, model.Workflow, model.Node, model.Items) (model.Items, error) {
+	return nil, errors.New("boom")
+}
+
+func init() { plugin.Register("test:fail", func() plugin.NodeHandler { return failNode{} }) }
+
+func TestErrorWorkflowRunsOnFailure(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	handler := n8n.N8nRequest{Workflow: n8n.N8nWorkflow{
+		ID:    "on-error",
+		Nodes: []n8n.N8nNode{{ID: "alert", Name: "Alert", Type: "echo"}},
+	}}
+	b, _ := json.Marshal(handler)
+	if err := os.MkdirAll(WorkflowsDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(WorkflowsDir(), "on_error.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewInstanceManager()
+	wf := model.Workflow{
+		ID:       "fragile",
+		Settings: map[string]any{ErrorWorkflowSetting: "on_error.json"},
+		Nodes:    []model.Node{{ID: "a", Type: "echo"}, {ID: "b", Type: "test:fail"}},
+		Edges:    []model.Edge{{FromNode: "a", FromPort: model.PortMain, ToNode: "b", ToPort: model.PortMain}},
+	}
+	m.Submit("exec-1", "", wf, map[model.ID]model.Items{"a": {{"x": 1}}})
+	rec, err := m.Wait(context.Background(), "exec-1")
+	if err == nil || rec.ErrorExecutionID == "" {
+		t.Fatalf("expected a failure with an error workflow run, got %v / %+v", err, rec)
+	}
+
+	handled, err := m.Wait(context.Background(), rec.ErrorExecutionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handled.TriggeredBy != "exec-1" {
+		t.Fatalf("triggered_by = %q", handled.TriggeredBy)
+	}
+	out := handled.Result["alert"]
+	if len(out) != 1 || out[0]["execution_id"] != "exec-1" || out[0]["node"] != "b" {
+		t.Fatalf("unexpected error workflow result: %v", out)
+	}
+	// the record may come back from history, where items went through JSON
+	if input := fmt.Sprint(out[0]["input"]); !strings.Contains(input, "x:1") {
+		t.Fatalf("failing node input not passed: %v", out[0]["input"])
+	}
+
+	if _, _, err := m.LoadWorkflow(context.Background(), "../outside.json"); err == nil {
+		t.Fatal("expected paths outside the workflows dir to be refused")
+	}
+}
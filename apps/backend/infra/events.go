@@ -0,0 +1,112 @@
+package infra
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// Event is an engine or manager event as delivered to subscribers
+type Event struct {
+	Seq    uint64         `json:"seq"`
+	Type   string         `json:"type"`
+	At     time.Time      `json:"at"`
+	Fields map[string]any `json:"fields"`
+}
+
+// ExecID returns the execution the event belongs to, if any
+func (e Event) ExecID() string { s, _ := e.Fields["exec"].(string); return s }
+
+// InstanceID returns the instance the event belongs to, if any
+func (e Event) InstanceID() string { s, _ := e.Fields["instance"].(string); return s }
+
+// EventHub is an in-process pub/sub plugin.EventBus. Delivery never blocks
+// the emitter: a subscriber whose buffer is full misses events, which
+// Event.Seq gaps make visible.
+type EventHub struct {
+	mu     sync.Mutex
+	seq    uint64
+	nextID int
+	subs   map[int]*subscriber
+}
+
+type subscriber struct {
+	match func(Event) bool
+	ch    chan Event
+}
+
+func NewEventHub() *EventHub { return &EventHub{subs: map[int]*subscriber{}} }
+
+func (h *EventHub) Emit(ctx context.Context, event string, fields map[string]any) error {
+	copied := make(map[string]any, len(fields))
+	for k, v := range fields {
+		copied[k] = v
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := Event{Seq: h.seq, Type: event, At: time.Now().UTC(), Fields: copied}
+	for _, s := range h.subs {
+		if s.match != nil && !s.match(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe delivers matching events (all when match is nil) until the
+// returned cancel func is called, which also closes the channel.
+func (h *EventHub) Subscribe(match func(Event) bool, buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = 256
+	}
+	s := &subscriber{match: match, ch: make(chan Event, buffer)}
+	h.mu.Lock()
+	id := h.nextID
+	h.nextID++
+	h.subs[id] = s
+	h.mu.Unlock()
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, id)
+			h.mu.Unlock()
+			close(s.ch)
+		})
+	}
+}
+
+// instanceBus adds the instance ID to events of executions run by an
+// instance before passing them on
+type instanceBus struct {
+	m    *InstanceManager
+	next plugin.EventBus
+}
+
+func (b instanceBus) Emit(ctx context.Context, event string, fields map[string]any) error {
+	if _, tagged := fields["instance"]; !tagged {
+		if execID, ok := fields["exec"].(string); ok {
+			if run, ok := b.m.inflight(execID); ok && run.start.InstanceID != "" {
+				tagged := make(map[string]any, len(fields)+1)
+				for k, v := range fields {
+					tagged[k] = v
+				}
+				tagged["instance"] = run.start.InstanceID
+				fields = tagged
+			}
+		}
+	}
+	return b.next.Emit(ctx, event, fields)
+}
+
+var (
+	_ plugin.EventBus = (*EventHub)(nil)
+	_ plugin.EventBus = instanceBus{}
+)
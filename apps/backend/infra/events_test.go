@@ -0,0 +1,33 @@
+package infra
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventHubFiltersAndDropsForSlowSubscribers(t *testing.T) {
+	h := NewEventHub()
+	ctx := context.Background()
+	mine, cancelMine := h.Subscribe(func(ev Event) bool { return ev.ExecID() == "a" }, 2)
+	defer cancelMine()
+
+	for i := 0; i < 3; i++ {
+		_ = h.Emit(ctx, "node_completed", map[string]any{"exec": "a", "n": i})
+	}
+	_ = h.Emit(ctx, "node_completed", map[string]any{"exec": "b"})
+
+	first, second := <-mine, <-mine
+	if first.Fields["n"] != 0 || second.Fields["n"] != 1 || second.Seq != first.Seq+1 {
+		t.Fatalf("unexpected events: %+v %+v", first, second)
+	}
+	select {
+	case ev := <-mine:
+		t.Fatalf("expected overflow and filtered events to be dropped, got %+v", ev)
+	default:
+	}
+
+	cancelMine()
+	if _, ok := <-mine; ok {
+		t.Fatal("channel should be closed after cancel")
+	}
+}
@@ -0,0 +1,171 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+var (
+	ErrExecutionNotFound = errors.New("execution not found")
+	// ErrExecutionFinished is returned when cancelling an execution that is no longer running
+	ErrExecutionFinished = errors.New("execution is not running")
+)
+
+// ExecutionProgress reports how far an in-flight execution has got
+type ExecutionProgress struct {
+	NodesTotal     int `json:"nodes_total"`
+	NodesCompleted int `json:"nodes_completed"`
+	NodesFailed    int `json:"nodes_failed"`
+	Percent        int `json:"percent"`
+}
+
+// inflight is an execution that is currently running in this process
+type inflight struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	start    ExecutionRecord // shown until the first history write
+	progress ExecutionProgress
+	rec      ExecutionRecord // final record, valid once done is closed
+	err      error
+}
+
+// track registers execID as in flight, or returns the existing registration
+func (m *InstanceManager) track(parent context.Context, execID, instanceID string, wf model.Workflow) *inflight {
+	m.runsMu.Lock()
+	defer m.runsMu.Unlock()
+	if run, ok := m.runs[execID]; ok {
+		return run
+	}
+	ctx, cancel := context.WithCancel(parent)
+	run := &inflight{
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		start:    ExecutionRecord{ExecutionID: execID, InstanceID: instanceID, WorkflowID: wf.ID, WorkflowName: wf.Name, Status: ExecutionRunning},
+		progress: ExecutionProgress{NodesTotal: len(wf.Nodes)},
+	}
+	m.runs[execID] = run
+	return run
+}
+
+// finish publishes the final record to waiters and forgets the execution
+func (m *InstanceManager) finish(execID string, run *inflight, rec ExecutionRecord, err error) {
+	run.mu.Lock()
+	run.rec, run.err = rec, err
+	run.mu.Unlock()
+	m.runsMu.Lock()
+	delete(m.runs, execID)
+	m.runsMu.Unlock()
+	run.cancel()
+	close(run.done)
+}
+
+func (m *InstanceManager) inflight(execID string) (*inflight, bool) {
+	m.runsMu.Lock()
+	defer m.runsMu.Unlock()
+	run, ok := m.runs[execID]
+	return run, ok
+}
+
+// observeNode feeds node completions to the history recorder and progress
+func (m *InstanceManager) observeNode(run engine.NodeRun) {
+	m.recorder.observe(run)
+	if r, ok := m.inflight(run.ExecID); ok {
+		r.mu.Lock()
+		switch run.Status {
+		case engine.NodeFailed:
+			r.progress.NodesFailed++
+		default:
+			r.progress.NodesCompleted++
+		}
+		if r.progress.NodesTotal > 0 {
+			r.progress.Percent = 100 * r.progress.NodesCompleted / r.progress.NodesTotal
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Submit starts an execution in the background and returns once it is
+// registered, so it can be polled and cancelled immediately. The run is
+// detached from ctx; only Cancel stops it.
+func (m *InstanceManager) Submit(execID, versionID string, wf model.Workflow, inputs map[model.ID]model.Items) {
+	m.submit(execID, wf, inputs, execOptions{versionID: versionID})
+}
+
+func (m *InstanceManager) submit(execID string, wf model.Workflow, inputs map[model.ID]model.Items, opts execOptions) {
+	m.track(context.Background(), execID, opts.instanceID, wf)
+	go func() {
+		_, _ = m.execute(context.Background(), m.newEngine(), execID, wf, inputs, opts)
+	}()
+}
+
+// Wait blocks until execID finishes or ctx is done and returns its record
+// and run error
+func (m *InstanceManager) Wait(ctx context.Context, execID string) (ExecutionRecord, error) {
+	run, ok := m.inflight(execID)
+	if !ok {
+		rec, found, err := m.history.Get(execID)
+		if err != nil {
+			return ExecutionRecord{}, err
+		}
+		if !found {
+			return ExecutionRecord{}, ErrExecutionNotFound
+		}
+		if rec.Error != "" {
+			return rec, errors.New(rec.Error)
+		}
+		return rec, nil
+	}
+	select {
+	case <-run.done:
+	case <-ctx.Done():
+		return ExecutionRecord{}, ctx.Err()
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.rec, run.err
+}
+
+// Cancel cancels the context of a running execution
+func (m *InstanceManager) Cancel(execID string) error {
+	if run, ok := m.inflight(execID); ok {
+		run.cancel()
+		return nil
+	}
+	if _, found, err := m.history.Get(execID); err != nil {
+		return err
+	} else if found {
+		return ErrExecutionFinished
+	}
+	return ErrExecutionNotFound
+}
+
+// Execution returns the recorded execution and, while it is running in
+// this process, its progress
+func (m *InstanceManager) Execution(execID string) (ExecutionRecord, *ExecutionProgress, error) {
+	run, running := m.inflight(execID)
+	rec, found, err := m.history.Get(execID)
+	if err != nil {
+		return ExecutionRecord{}, nil, err
+	}
+	if !running {
+		if !found {
+			return ExecutionRecord{}, nil, ErrExecutionNotFound
+		}
+		return rec, nil, nil
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if !found {
+		rec = run.start
+	}
+	p := run.progress
+	return rec, &p, nil
+}
@@ -0,0 +1,69 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// blockNode waits until its context is cancelled
+type blockNode struct{}
+
+func (blockNode) Init(context.Context, plugin.Deps) error { return nil }
+func (blockNode) Process(ctx context.Context, _ model.Workflow, _ model.Node, in model.Items) (model.Items, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() { plugin.Register("test:block", func() plugin.NodeHandler { return blockNode{} }) }
+
+func TestSubmitAndCancel(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	m := NewInstanceManager()
+	wf := model.Workflow{
+		ID: "slow",
+		Nodes: []model.Node{
+			{ID: "a", Type: "echo"},
+			{ID: "b", Type: "test:block"},
+		},
+		Edges: []model.Edge{{FromNode: "a", FromPort: model.PortMain, ToNode: "b", ToPort: model.PortMain}},
+	}
+	m.Submit("exec-1", "", wf, map[model.ID]model.Items{"a": {{"x": 1}}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec, progress, err := m.Execution("exec-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Status != ExecutionRunning || progress == nil {
+			t.Fatalf("expected a running execution, got %s", rec.Status)
+		}
+		if progress.NodesCompleted == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no progress: %+v", progress)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := m.Cancel("exec-1"); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := m.Wait(context.Background(), "exec-1")
+	if err == nil || rec.Status != ExecutionCancelled {
+		t.Fatalf("status %s, err %v", rec.Status, err)
+	}
+	if err := m.Cancel("exec-1"); !errors.Is(err, ErrExecutionFinished) {
+		t.Fatalf("cancel finished execution: %v", err)
+	}
+	if _, _, err := m.Execution("nope"); !errors.Is(err, ErrExecutionNotFound) {
+		t.Fatalf("unknown execution: %v", err)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Tsinling0525/rivulet/model"
@@ -18,12 +20,27 @@ type LocalFiles struct{}
 // NewLocalFiles returns a new LocalFiles store.
 func NewLocalFiles() *LocalFiles { return &LocalFiles{} }
 
+// errBadFileID is returned for IDs that would leave the files directory
+var errBadFileID = fmt.Errorf("invalid workflow or file ID: %w", fs.ErrNotExist)
+
+func validFileID(ids ...string) bool {
+	for _, id := range ids {
+		if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+			return false
+		}
+	}
+	return true
+}
+
 func (l *LocalFiles) Put(ctx context.Context, workflowID, filename string, contents []byte, mediaType string) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
 	default:
 	}
+	if !validFileID(workflowID) {
+		return "", errBadFileID
+	}
 	dir := FilesDir(workflowID)
 	if err := ensureDir(dir); err != nil {
 		return "", err
@@ -50,28 +67,70 @@ func (l *LocalFiles) Get(ctx context.Context, workflowID, fileID string) (string
 		return "", "", nil, ctx.Err()
 	default:
 	}
-	dir := FilesDir(workflowID)
-	metaBytes, err := os.ReadFile(filepath.Join(dir, fileID+".json"))
-	if err != nil {
-		return "", "", nil, err
+	if !validFileID(workflowID, fileID) {
+		return "", "", nil, errBadFileID
 	}
-	var meta model.FileMeta
-	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+	meta, err := readFileMeta(workflowID, fileID)
+	if err != nil {
 		return "", "", nil, err
 	}
-	data, err := os.ReadFile(filepath.Join(dir, fileID))
+	data, err := os.ReadFile(filepath.Join(FilesDir(workflowID), fileID))
 	if err != nil {
 		return "", "", nil, err
 	}
 	return meta.Name, meta.MediaType, data, nil
 }
 
+// readFileMeta loads the metadata sidecar of a file
+func readFileMeta(workflowID, fileID string) (model.FileMeta, error) {
+	var meta model.FileMeta
+	b, err := os.ReadFile(filepath.Join(FilesDir(workflowID), fileID+".json"))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(b, &meta)
+	return meta, err
+}
+
+func (l *LocalFiles) Stat(ctx context.Context, workflowID, fileID string) (model.FileMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return model.FileMeta{}, err
+	}
+	if !validFileID(workflowID, fileID) {
+		return model.FileMeta{}, errBadFileID
+	}
+	return readFileMeta(workflowID, fileID)
+}
+
+// Open returns a file's metadata and its contents for reading, so large
+// files can be streamed instead of loaded whole. The caller closes it.
+func (l *LocalFiles) Open(ctx context.Context, workflowID, fileID string) (model.FileMeta, *os.File, error) {
+	if err := ctx.Err(); err != nil {
+		return model.FileMeta{}, nil, err
+	}
+	if !validFileID(workflowID, fileID) {
+		return model.FileMeta{}, nil, errBadFileID
+	}
+	meta, err := readFileMeta(workflowID, fileID)
+	if err != nil {
+		return model.FileMeta{}, nil, err
+	}
+	f, err := os.Open(filepath.Join(FilesDir(workflowID), fileID))
+	if err != nil {
+		return model.FileMeta{}, nil, err
+	}
+	return meta, f, nil
+}
+
 func (l *LocalFiles) List(ctx context.Context, workflowID string) ([]model.FileMeta, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
+	if !validFileID(workflowID) {
+		return nil, errBadFileID
+	}
 	dir := FilesDir(workflowID)
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -104,10 +163,14 @@ func (l *LocalFiles) Delete(ctx context.Context, workflowID, fileID string) erro
 		return ctx.Err()
 	default:
 	}
+	if !validFileID(workflowID, fileID) {
+		return errBadFileID
+	}
 	dir := FilesDir(workflowID)
+	// the sidecar decides whether the file exists
+	err := os.Remove(filepath.Join(dir, fileID+".json"))
 	_ = os.Remove(filepath.Join(dir, fileID))
-	_ = os.Remove(filepath.Join(dir, fileID+".json"))
-	return nil
+	return err
 }
 
 var _ plugin.FileStore = (*LocalFiles)(nil)
@@ -0,0 +1,47 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+func TestBinaryRefResolvesAfterJSONRoundTrip(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	files := NewLocalFiles()
+	ctx := context.Background()
+
+	ref, err := plugin.StoreBinary(ctx, files, "wf_bin", "report.pdf", []byte("%PDF"), "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(model.Item{"file": ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item model.Item
+	if err := json.Unmarshal(b, &item); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := model.AsBinaryRef(item["file"])
+	if !ok || got != ref {
+		t.Fatalf("decoded %v from %s", got, b)
+	}
+	name, mediaType, data, err := plugin.ReadBinary(ctx, files, ref.WorkflowID, item["file"])
+	if err != nil || name != "report.pdf" || mediaType != "application/pdf" || string(data) != "%PDF" {
+		t.Fatalf("read %q %q %q: %v", name, mediaType, data, err)
+	}
+	// a ref smuggled in through item data cannot reach another workflow
+	if _, _, _, err := plugin.ReadBinary(ctx, files, "wf_other", item["file"]); !errors.Is(err, plugin.ErrForeignBinary) {
+		t.Fatalf("expected a foreign ref to be rejected, got %v", err)
+	}
+
+	if _, _, _, err := files.Get(ctx, "..", ref.FileID); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected escaping IDs to be rejected, got %v", err)
+	}
+}
@@ -57,6 +57,22 @@ func (m *MemFiles) Get(ctx context.Context, workflowID string, fileID string) (s
 	return "", "", nil, fmt.Errorf("file not found")
 }
 
+func (m *MemFiles) Stat(ctx context.Context, workflowID string, fileID string) (model.FileMeta, error) {
+	select {
+	case <-ctx.Done():
+		return model.FileMeta{}, ctx.Err()
+	default:
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if wf, ok := m.data[workflowID]; ok {
+		if f, ok := wf[fileID]; ok {
+			return model.FileMeta{ID: fileID, Name: f.name, Size: int64(len(f.content)), MediaType: f.mediaType, CreatedAt: f.createdAt}, nil
+		}
+	}
+	return model.FileMeta{}, fmt.Errorf("file not found")
+}
+
 func (m *MemFiles) List(ctx context.Context, workflowID string) ([]model.FileMeta, error) {
 	select {
 	case <-ctx.Done():
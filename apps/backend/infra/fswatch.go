@@ -0,0 +1,299 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// FSWatchNodeType is the node type that enqueues files dropped into a directory
+const FSWatchNodeType = "trigger:fs_watch"
+
+// FSWatchStatus is a directory watch as shown on its instance
+type FSWatchStatus struct {
+	Node       model.ID  `json:"node"`
+	Path       string    `json:"path"`
+	Mode       string    `json:"mode"` // inotify or poll once running
+	Imported   int       `json:"imported"`
+	Dropped    int       `json:"dropped"`
+	LastFile   string    `json:"last_file,omitempty"`
+	LastImport time.Time `json:"last_import,omitempty"`
+}
+
+// fsWatchConfig is the config of a trigger:fs_watch node
+type fsWatchConfig struct {
+	Path            string `json:"path"`
+	Pattern         string `json:"pattern"`       // glob on file names, default "*"
+	Poll            bool   `json:"poll"`          // poll even where inotify is available
+	PollInterval    string `json:"poll_interval"` // Go duration, default 2s
+	Settle          string `json:"settle"`        // quiet time before a file is imported, default 500ms
+	IncludeExisting bool   `json:"include_existing"`
+}
+
+// fsWatch is a parsed trigger:fs_watch node with its status; status is
+// guarded by the instance's statsMu
+type fsWatch struct {
+	node     model.ID
+	dir      string
+	pattern  string
+	poll     bool
+	interval time.Duration
+	settle   time.Duration
+	existing bool
+	status   FSWatchStatus
+}
+
+// parseFSWatches reads the trigger:fs_watch nodes of wf
+func parseFSWatches(wf model.Workflow) ([]*fsWatch, error) {
+	var out []*fsWatch
+	for _, node := range wf.Nodes {
+		if node.Type != FSWatchNodeType {
+			continue
+		}
+		w, err := newFSWatch(node)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", node.ID, err)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+func newFSWatch(node model.Node) (*fsWatch, error) {
+	b, err := json.Marshal(node.Config)
+	if err != nil {
+		return nil, err
+	}
+	var cfg fsWatchConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	dir, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if st, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	w := &fsWatch{
+		node:     node.ID,
+		dir:      dir,
+		pattern:  cfg.Pattern,
+		poll:     cfg.Poll,
+		interval: 2 * time.Second,
+		settle:   500 * time.Millisecond,
+		existing: cfg.IncludeExisting,
+		status:   FSWatchStatus{Node: node.ID, Path: dir},
+	}
+	if w.pattern == "" {
+		w.pattern = "*"
+	}
+	if _, err := filepath.Match(w.pattern, ""); err != nil {
+		return nil, fmt.Errorf("pattern: %w", err)
+	}
+	if cfg.PollInterval != "" {
+		if w.interval, err = time.ParseDuration(cfg.PollInterval); err != nil || w.interval <= 0 {
+			return nil, fmt.Errorf("poll_interval: invalid duration %q", cfg.PollInterval)
+		}
+	}
+	if cfg.Settle != "" {
+		if w.settle, err = time.ParseDuration(cfg.Settle); err != nil || w.settle < 0 {
+			return nil, fmt.Errorf("settle: invalid duration %q", cfg.Settle)
+		}
+	}
+	return w, nil
+}
+
+// fileState identifies a version of a watched file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// dirScan tracks the files of a watched directory between scans
+type dirScan struct {
+	seen    map[string]fileState
+	pending map[string]time.Time // changed files, by when they last changed
+}
+
+// scan lists the directory and returns the files that changed and have
+// been quiet for settle since, in name order
+func (w *fsWatch) scan(s *dirScan, now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if ok, _ := filepath.Match(w.pattern, e.Name()); !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := e.Name()
+		present[name] = true
+		st := fileState{size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := s.seen[name]; !ok || prev != st {
+			s.seen[name] = st
+			s.pending[name] = now
+		}
+	}
+	var ready []string
+	for name, changed := range s.pending {
+		switch {
+		case !present[name]:
+			delete(s.pending, name)
+		case now.Sub(changed) >= w.settle:
+			delete(s.pending, name)
+			ready = append(ready, name)
+		}
+	}
+	for name := range s.seen {
+		if !present[name] {
+			delete(s.seen, name)
+		}
+	}
+	sort.Strings(ready)
+	return ready, nil
+}
+
+// startFSWatches runs the directory watches of inst until ctx ends
+func (m *InstanceManager) startFSWatches(ctx context.Context, inst *Instance) {
+	for _, w := range inst.watches {
+		go m.runFSWatch(ctx, inst, w)
+	}
+}
+
+func (m *InstanceManager) runFSWatch(ctx context.Context, inst *Instance, w *fsWatch) {
+	var wake <-chan struct{}
+	mode := "poll"
+	if !w.poll {
+		ch, err := watchDir(ctx, w.dir)
+		if err != nil {
+			inst.logf("watch %s: polling: %v", w.dir, err)
+		} else {
+			wake, mode = ch, "inotify"
+		}
+	}
+	inst.statsMu.Lock()
+	w.status.Mode = mode
+	inst.statsMu.Unlock()
+	inst.logf("watching %s (%s)", w.dir, mode)
+
+	s := &dirScan{seen: map[string]fileState{}, pending: map[string]time.Time{}}
+	if !w.existing {
+		// files already there are the baseline, not new files
+		if _, err := w.scan(s, time.Now()); err != nil {
+			inst.logf("watch %s: %v", w.dir, err)
+		}
+		clear(s.pending)
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-timer.C:
+		}
+		ready, err := w.scan(s, time.Now())
+		if err != nil {
+			inst.logf("watch %s: %v", w.dir, err)
+		}
+		for _, name := range ready {
+			m.importWatchedFile(ctx, inst, w, name)
+		}
+		// inotify wakes the loop on changes; the timer only has to come
+		// back for files that are still settling
+		var next time.Duration
+		switch {
+		case len(s.pending) > 0:
+			next = w.settle
+			if mode == "poll" && w.interval < next {
+				next = w.interval
+			}
+		case mode == "poll":
+			next = w.interval
+		default:
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// importWatchedFile stores a file for the instance's workflow and enqueues
+// an item carrying its file_id for the watch node
+func (m *InstanceManager) importWatchedFile(ctx context.Context, inst *Instance, w *fsWatch, name string) {
+	path := filepath.Join(w.dir, name)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		inst.logf("watch %s: %v", w.dir, err)
+		return
+	}
+	inst.statsMu.Lock()
+	wf := inst.Workflow
+	inst.statsMu.Unlock()
+	mediaType := mime.TypeByExtension(filepath.Ext(name))
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	fileID, err := m.deps.Files.Put(ctx, string(wf.ID), name, contents, mediaType)
+	if err != nil {
+		inst.logf("watch %s: import %s: %v", w.dir, name, err)
+		return
+	}
+	item := model.Item{
+		"file_id":    fileID,
+		"file_name":  name,
+		"path":       path,
+		"size":       len(contents),
+		"media_type": mediaType,
+	}
+	execID := newExecID()
+	err = m.enqueue(ctx, inst, execID, map[model.ID]model.Items{w.node: {item}})
+
+	inst.statsMu.Lock()
+	if err != nil {
+		w.status.Dropped++
+	} else {
+		w.status.Imported++
+		w.status.LastFile, w.status.LastImport = name, time.Now()
+	}
+	inst.statsMu.Unlock()
+
+	fields := map[string]any{"instance": inst.ID, "node": w.node, "file": name, "file_id": fileID}
+	if err != nil {
+		fields["reason"] = err.Error()
+		inst.logf("watched file %s dropped: %v", name, err)
+		m.deps.Bus.Emit(ctx, "fs_watch_dropped", fields)
+		return
+	}
+	fields["execution_id"] = execID
+	inst.logf("watched file %s imported as %s", name, fileID)
+	m.deps.Bus.Emit(ctx, "fs_watch_imported", fields)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package infra
+
+import (
+	"context"
+	"errors"
+)
+
+// watchDir is only implemented with inotify; other systems poll
+func watchDir(ctx context.Context, dir string) (<-chan struct{}, error) {
+	return nil, errors.New("file system notifications not supported on this platform")
+}
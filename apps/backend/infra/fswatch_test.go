@@ -0,0 +1,69 @@
+package infra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+)
+
+func TestFSWatchImportsNewFiles(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		t.Run(map[bool]string{false: "notify", true: "poll"}[poll], func(t *testing.T) {
+			t.Setenv("RIV_DATA_DIR", t.TempDir())
+			t.Setenv("RIV_DB_DRIVER", "none")
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "old.png"), []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			writeWorkflowFile(t, "inbox.json", n8n.N8nWorkflow{
+				ID: "inbox",
+				Nodes: []n8n.N8nNode{{ID: "watch", Name: "Watch", Type: "trigger:fs_watch", Parameters: map[string]interface{}{
+					"path": dir, "pattern": "*.png", "settle": "20ms", "poll": poll, "poll_interval": "20ms",
+				}}},
+			})
+			m := NewInstanceManager()
+			inst, err := m.CreateFromWorkflowPath(filepath.Join(WorkflowsDir(), "inbox.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Stop(inst.ID)
+			// give the watch time to take its baseline
+			time.Sleep(50 * time.Millisecond)
+			for _, name := range []string{"skip.txt", "page.png"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("new "+name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var recs []ExecutionRecord
+			for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				if recs, _ = m.History().List(HistoryQuery{Status: ExecutionSucceeded}); len(recs) > 0 {
+					break
+				}
+			}
+			if len(recs) != 1 {
+				t.Fatalf("expected one execution, got %d", len(recs))
+			}
+			rec, _, err := m.History().Get(recs[0].ExecutionID)
+			if err != nil || len(rec.Input["watch"]) != 1 {
+				t.Fatalf("execution input %v: %v", rec.Input, err)
+			}
+			item := rec.Input["watch"][0]
+			if item["file_name"] != "page.png" || item["media_type"] != "image/png" {
+				t.Fatalf("unexpected item %v", item)
+			}
+			fileID, _ := item["file_id"].(string)
+			name, _, data, err := m.Files().Get(context.Background(), "inbox", fileID)
+			if err != nil || name != "page.png" || string(data) != "new page.png" {
+				t.Fatalf("imported file %q %q: %v", name, data, err)
+			}
+			if st := inst.Snapshot().Watches[0]; st.Imported != 1 || st.Mode != map[bool]string{false: "inotify", true: "poll"}[poll] {
+				t.Fatalf("unexpected watch status %+v", st)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package infra
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// ExecutionStatus is the lifecycle state of a recorded execution
+type ExecutionStatus string
+
+const (
+	ExecutionQueued    ExecutionStatus = "queued" // waiting in an instance queue
+	ExecutionRunning   ExecutionStatus = "running"
+	ExecutionSucceeded ExecutionStatus = "succeeded"
+	ExecutionFailed    ExecutionStatus = "failed"
+	ExecutionCancelled ExecutionStatus = "cancelled"
+)
+
+// NodeExecution is the per-node part of an execution record
+type NodeExecution struct {
+	NodeID     model.ID                     `json:"node_id"`
+	Status     string                       `json:"status"`
+	StartedAt  time.Time                    `json:"started_at"`
+	FinishedAt time.Time                    `json:"finished_at"`
+	DurationMS int64                        `json:"duration_ms"`
+	Input      model.Items                  `json:"input,omitempty"`
+	Output     map[model.Port]model.Items   `json:"output,omitempty"`
+	Lineage    map[model.Port]model.Lineage `json:"lineage,omitempty"` // input items each output item came from
+	ItemErrors int                          `json:"item_errors,omitempty"`
+	Error      string                       `json:"error,omitempty"`
+}
+
+// HistoryQuery filters and pages ExecutionHistory.List
+type HistoryQuery struct {
+	InstanceID string
+	Status     ExecutionStatus
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// HistoryRetention bounds how much history is kept; zero values disable
+// the corresponding limit
+type HistoryRetention struct {
+	MaxAge   time.Duration
+	MaxCount int
+}
+
+// ExecutionHistory persists one JSON document per execution under dir and
+// keeps a summary index in memory for listing.
+type ExecutionHistory struct {
+	dir       string
+	retention HistoryRetention
+
+	mu    sync.RWMutex
+	index map[string]ExecutionRecord // summaries without items
+}
+
+// errInterrupted is recorded for executions that were still running when
+// the process holding the history went away
+const errInterrupted = "interrupted: the process stopped before the execution finished"
+
+// NewExecutionHistory opens a history directory and indexes the records
+// already in it. Unreadable records are skipped rather than blocking startup.
+// Records still running were cut short by a crash or shutdown; they are
+// marked failed so they don't stay running, or escape retention, forever.
+func NewExecutionHistory(dir string, retention HistoryRetention) *ExecutionHistory {
+	h := &ExecutionHistory{dir: dir, retention: retention, index: map[string]ExecutionRecord{}}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var rec ExecutionRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			continue
+		}
+		if rec.Status == ExecutionRunning {
+			rec.Status, rec.Error = ExecutionFailed, errInterrupted
+			rec.FinishedAt = rec.StartedAt
+			if info, err := e.Info(); err == nil {
+				rec.FinishedAt = info.ModTime()
+			}
+			rec.DurationMS = rec.FinishedAt.Sub(rec.StartedAt).Milliseconds()
+			if b, err := json.Marshal(rec); err == nil {
+				_ = writeFileAtomic(path, b)
+			}
+		}
+		h.index[rec.ExecutionID] = rec.summary()
+	}
+	return h
+}
+
+// NewDefaultExecutionHistory opens the history under ExecutionsDir() with
+// retention from RIV_HISTORY_MAX_AGE (Go duration, default 720h) and
+// RIV_HISTORY_MAX_COUNT (default 1000).
+func NewDefaultExecutionHistory() *ExecutionHistory {
+	ret := HistoryRetention{MaxAge: 30 * 24 * time.Hour, MaxCount: 1000}
+	if v := os.Getenv("RIV_HISTORY_MAX_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			ret.MaxAge = d
+		}
+	}
+	if v := os.Getenv("RIV_HISTORY_MAX_COUNT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			ret.MaxCount = n
+		}
+	}
+	return NewExecutionHistory(ExecutionsDir(), ret)
+}
+
+func (h *ExecutionHistory) path(execID string) string {
+	return filepath.Join(h.dir, url.PathEscape(execID)+".json")
+}
+
+// Save inserts or replaces an execution record and applies retention
+func (h *ExecutionHistory) Save(rec ExecutionRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := ensureDir(h.dir); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := writeFileAtomic(h.path(rec.ExecutionID), b); err != nil {
+		return err
+	}
+	h.index[rec.ExecutionID] = rec.summary()
+	return h.pruneLocked(time.Now())
+}
+
+// Get loads the full record including items and node details
+func (h *ExecutionHistory) Get(execID string) (ExecutionRecord, bool, error) {
+	h.mu.RLock()
+	_, ok := h.index[execID]
+	h.mu.RUnlock()
+	if !ok {
+		return ExecutionRecord{}, false, nil
+	}
+	b, err := os.ReadFile(h.path(execID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ExecutionRecord{}, false, nil
+		}
+		return ExecutionRecord{}, false, err
+	}
+	var rec ExecutionRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return ExecutionRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+// Delete removes a record
+func (h *ExecutionHistory) Delete(execID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.index, execID)
+	if err := os.Remove(h.path(execID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns matching summaries, newest first, and the total match count
+func (h *ExecutionHistory) List(q HistoryQuery) ([]ExecutionRecord, int) {
+	h.mu.RLock()
+	matches := make([]ExecutionRecord, 0, len(h.index))
+	for _, rec := range h.index {
+		if q.InstanceID != "" && rec.InstanceID != q.InstanceID {
+			continue
+		}
+		if q.Status != "" && rec.Status != q.Status {
+			continue
+		}
+		if !q.Since.IsZero() && rec.StartedAt.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && rec.StartedAt.After(q.Until) {
+			continue
+		}
+		matches = append(matches, rec)
+	}
+	h.mu.RUnlock()
+
+	sortNewestFirst(matches)
+	total := len(matches)
+	if q.Offset > 0 {
+		if q.Offset >= len(matches) {
+			return []ExecutionRecord{}, total
+		}
+		matches = matches[q.Offset:]
+	}
+	if q.Limit > 0 && q.Limit < len(matches) {
+		matches = matches[:q.Limit]
+	}
+	return matches, total
+}
+
+// Prune applies the retention policy
+func (h *ExecutionHistory) Prune(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pruneLocked(now)
+}
+
+func (h *ExecutionHistory) pruneLocked(now time.Time) error {
+	all := make([]ExecutionRecord, 0, len(h.index))
+	for _, rec := range h.index {
+		all = append(all, rec)
+	}
+	sortNewestFirst(all)
+	for i, rec := range all {
+		if rec.Status == ExecutionQueued || rec.Status == ExecutionRunning {
+			continue
+		}
+		expired := h.retention.MaxAge > 0 && rec.StartedAt.Add(h.retention.MaxAge).Before(now)
+		overflow := h.retention.MaxCount > 0 && i >= h.retention.MaxCount
+		if !expired && !overflow {
+			continue
+		}
+		if err := os.Remove(h.path(rec.ExecutionID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(h.index, rec.ExecutionID)
+	}
+	return nil
+}
+
+func sortNewestFirst(recs []ExecutionRecord) {
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].StartedAt.Equal(recs[j].StartedAt) {
+			return strings.Compare(recs[i].ExecutionID, recs[j].ExecutionID) > 0
+		}
+		return recs[i].StartedAt.After(recs[j].StartedAt)
+	})
+}
+
+// summary strips items so the in-memory index stays small
+func (r ExecutionRecord) summary() ExecutionRecord {
+	s := r
+	s.Input = nil
+	s.Result = nil
+	s.Nodes = nil
+	return s
+}
+
+// nodeRecorder collects NodeRun callbacks per execution
+type nodeRecorder struct {
+	mu   sync.Mutex
+	runs map[string][]NodeExecution
+}
+
+func newNodeRecorder() *nodeRecorder {
+	return &nodeRecorder{runs: map[string][]NodeExecution{}}
+}
+
+func (r *nodeRecorder) observe(run engine.NodeRun) {
+	ne := NodeExecution{
+		NodeID:     run.NodeID,
+		Status:     run.Status,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		DurationMS: run.FinishedAt.Sub(run.StartedAt).Milliseconds(),
+		Input:      run.Input,
+		Output:     run.Output,
+		Lineage:    run.Lineage,
+		ItemErrors: run.ItemErrors,
+	}
+	if run.Err != nil {
+		ne.Error = run.Err.Error()
+	}
+	r.mu.Lock()
+	r.runs[run.ExecID] = append(r.runs[run.ExecID], ne)
+	r.mu.Unlock()
+}
+
+// take returns and forgets the node runs of execID, in start order
+func (r *nodeRecorder) take(execID string) []NodeExecution {
+	r.mu.Lock()
+	runs := r.runs[execID]
+	delete(r.runs, execID)
+	r.mu.Unlock()
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs
+}
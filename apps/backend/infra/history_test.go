@@ -0,0 +1,74 @@
+package infra
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExecutionHistoryQueryAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	h := NewExecutionHistory(dir, HistoryRetention{MaxCount: 3})
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		status := ExecutionSucceeded
+		if i%2 == 1 {
+			status = ExecutionFailed
+		}
+		rec := ExecutionRecord{
+			ExecutionID: fmt.Sprintf("exec-%d", i),
+			InstanceID:  "inst-1",
+			Status:      status,
+			StartedAt:   base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := h.Save(rec); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	all, total := h.List(HistoryQuery{})
+	if total != 3 || all[0].ExecutionID != "exec-4" {
+		t.Fatalf("expected the 3 newest records, got %d starting with %v", total, all)
+	}
+	if _, ok, _ := h.Get("exec-0"); ok {
+		t.Fatalf("exec-0 should have been pruned")
+	}
+
+	failed, total := h.List(HistoryQuery{Status: ExecutionFailed})
+	if total != 1 || failed[0].ExecutionID != "exec-3" {
+		t.Fatalf("unexpected failed filter result: %v", failed)
+	}
+
+	page, total := h.List(HistoryQuery{Limit: 1, Offset: 1})
+	if total != 3 || len(page) != 1 || page[0].ExecutionID != "exec-3" {
+		t.Fatalf("unexpected page: %v (total %d)", page, total)
+	}
+
+	// records survive a reopen
+	reopened := NewExecutionHistory(dir, HistoryRetention{})
+	if _, total := reopened.List(HistoryQuery{InstanceID: "inst-1"}); total != 3 {
+		t.Fatalf("expected 3 records after reopen, got %d", total)
+	}
+}
+
+func TestExecutionHistoryFailsInterruptedRecords(t *testing.T) {
+	dir := t.TempDir()
+	h := NewExecutionHistory(dir, HistoryRetention{MaxAge: time.Hour})
+	old := time.Now().Add(-2 * time.Hour)
+	if err := h.Save(ExecutionRecord{ExecutionID: "exec-crashed", Status: ExecutionRunning, StartedAt: old}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewExecutionHistory(dir, HistoryRetention{MaxAge: time.Hour})
+	rec, ok, err := reopened.Get("exec-crashed")
+	if err != nil || !ok || rec.Status != ExecutionFailed || rec.Error != errInterrupted {
+		t.Fatalf("expected an interrupted failure, got %+v (%v)", rec, err)
+	}
+	// no longer running, so retention applies
+	if err := reopened.Prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := reopened.Get("exec-crashed"); ok {
+		t.Fatal("interrupted record escaped retention")
+	}
+}
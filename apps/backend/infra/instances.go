@@ -2,15 +2,14 @@ package infra
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Tsinling0525/rivulet/engine"
-	"github.com/Tsinling0525/rivulet/format/n8n"
-	apiinfra "github.com/Tsinling0525/rivulet/infra/api"
+	"github.com/Tsinling0525/rivulet/infra/repository"
 	"github.com/Tsinling0525/rivulet/model"
 	"github.com/Tsinling0525/rivulet/plugin"
 )
@@ -28,9 +27,16 @@ type Instance struct {
 	WorkflowPath string
 	Workflow     model.Workflow
 	CreatedAt    time.Time
-	State        InstanceState
+	State        InstanceState // guarded by statsMu once the instance runs
 
-	q       chan map[model.ID]model.Items
+	// Stored workflow the instance runs, when not created from a file.
+	// PinnedVersion 0 follows the latest version.
+	StoredWorkflowID string
+	PinnedVersion    int
+	versionID        string
+	version          int
+
+	q       Queue
 	cancel  context.CancelFunc
 	deps    plugin.Deps
 	logMu   sync.Mutex
@@ -40,6 +46,14 @@ type Instance struct {
 	stats   InstanceStats
 	lastRun ExecutionRecord
 	active  ActiveExecution
+
+	schedules []*schedule // read from the workflow when the instance starts
+	webhooks  []*Webhook
+	watches   []*fsWatch
+	queueDir  string
+
+	retry       retryPolicy
+	deadLetters *DeadLetterStore // shared like the queue
 }
 
 func (i *Instance) logf(format string, a ...any) {
@@ -59,6 +73,12 @@ func (i *Instance) logf(format string, a ...any) {
 	}
 }
 
+var execSeq atomic.Uint64
+
+// newExecID returns a new execution ID; the sequence keeps IDs taken in
+// the same instant, e.g. by concurrent sub-workflow calls, apart
+func newExecID() string { return fmt.Sprintf("exec-%d-%d", time.Now().UnixNano(), execSeq.Add(1)) }
+
 // InstanceStats tracks execution metrics for an instance.
 type InstanceStats struct {
 	TotalExecutions      int
@@ -68,15 +88,31 @@ type InstanceStats struct {
 	LastRunAt            time.Time
 }
 
-// ExecutionRecord captures the latest execution details for UI inspection.
+// ExecutionRecord captures execution details for UI inspection and history.
 type ExecutionRecord struct {
-	ExecutionID string                   `json:"execution_id"`
-	StartedAt   time.Time                `json:"started_at"`
-	FinishedAt  time.Time                `json:"finished_at"`
-	DurationMS  int64                    `json:"duration_ms"`
-	Input       map[model.ID]model.Items `json:"input,omitempty"`
-	Result      map[model.ID]model.Items `json:"result,omitempty"`
-	Error       string                   `json:"error,omitempty"`
+	ExecutionID  string                   `json:"execution_id"`
+	RunID        string                   `json:"run_id,omitempty"` // workflow_runs row, when a database is configured
+	InstanceID   string                   `json:"instance_id,omitempty"`
+	WorkflowID   model.ID                 `json:"workflow_id,omitempty"`
+	WorkflowName string                   `json:"workflow_name,omitempty"`
+	Version      int                      `json:"workflow_version,omitempty"`
+	Status       ExecutionStatus          `json:"status,omitempty"`
+	StartedAt    time.Time                `json:"started_at"`
+	FinishedAt   time.Time                `json:"finished_at"`
+	DurationMS   int64                    `json:"duration_ms"`
+	Input        map[model.ID]model.Items `json:"input,omitempty"`
+	Result       map[model.ID]model.Items `json:"result,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+	Nodes        []NodeExecution          `json:"nodes,omitempty"`
+	// Lineage maps each result item to the items it was derived from
+	Lineage map[model.ID]model.Lineage `json:"lineage,omitempty"`
+
+	// TriggeredBy is the failed execution an error workflow run handles;
+	// ErrorExecutionID is the error workflow run a failure started.
+	TriggeredBy      string `json:"triggered_by,omitempty"`
+	ErrorExecutionID string `json:"error_execution_id,omitempty"`
+	// ParentExecutionID is the execution whose exec:workflow node ran this one
+	ParentExecutionID string `json:"parent_execution_id,omitempty"`
 }
 
 // ActiveExecution describes the current in-flight execution, if any.
@@ -95,6 +131,11 @@ type InstanceSnapshot struct {
 	Stats       InstanceStats
 	LastRun     ExecutionRecord
 	Active      ActiveExecution
+	Workflow    model.Workflow
+	Version     int // loaded stored version, 0 for file-based instances
+	Schedules   []ScheduleStatus
+	Webhooks    []Webhook
+	Watches     []FSWatchStatus
 }
 
 // Snapshot returns a point-in-time snapshot of the instance state.
@@ -103,33 +144,196 @@ func (i *Instance) Snapshot() InstanceSnapshot {
 	statsCopy := i.stats
 	lastRunCopy := i.lastRun
 	activeCopy := i.active
+	wf, version, state := i.Workflow, i.version, i.State
+	var schedules []ScheduleStatus
+	for _, s := range i.schedules {
+		schedules = append(schedules, s.status)
+	}
+	var webhooks []Webhook
+	for _, h := range i.webhooks {
+		webhooks = append(webhooks, *h)
+	}
+	var watches []FSWatchStatus
+	for _, w := range i.watches {
+		watches = append(watches, w.status)
+	}
 	i.statsMu.Unlock()
 
 	return InstanceSnapshot{
 		ID:          i.ID,
 		Name:        i.Name,
-		State:       i.State,
-		QueueLength: len(i.q),
+		State:       state,
+		QueueLength: i.q.Len(),
 		Stats:       statsCopy,
 		LastRun:     lastRunCopy,
 		Active:      activeCopy,
+		Workflow:    wf,
+		Version:     version,
+		Schedules:   schedules,
+		Webhooks:    webhooks,
+		Watches:     watches,
 	}
 }
 
 type InstanceManager struct {
-	mu    sync.Mutex
-	items map[string]*Instance
-	deps  plugin.Deps
-	newID func() string
+	mu       sync.Mutex
+	items    map[string]*Instance
+	deps     plugin.Deps
+	newID    func() string
+	history  *ExecutionHistory
+	recorder *nodeRecorder
+	repo     *repository.Repository
+	events   *repository.EventRecorder
+
+	recordFileRuns bool // see RecordFileRuns
+
+	runsMu sync.Mutex
+	runs   map[string]*inflight // executions running in this process
+	hub    *EventHub
+
+	queuesMu sync.Mutex
+	queues   map[string]*FileQueue // durable queues by instance ID
+
+	hooksMu sync.Mutex
+	hooks   []*Webhook              // routes of running instances
+	waits   map[string]*webhookWait // webhook callers by execution ID
 }
 
 func NewInstanceManager() *InstanceManager {
-	deps := plugin.Deps{State: apiinfra.MemState{}, Bus: apiinfra.NullBus{}, Files: NewLocalFiles()}
-	return &InstanceManager{
-		items: make(map[string]*Instance),
-		deps:  deps,
-		newID: func() string { return fmt.Sprintf("inst-%d", time.Now().UnixNano()) },
+	state := NewDefaultFileState()
+	state.StartJanitor(context.Background(), time.Hour)
+	hub := NewEventHub()
+	deps := plugin.Deps{State: state, Bus: hub, Files: NewLocalFiles()}
+	m := &InstanceManager{
+		items:    make(map[string]*Instance),
+		newID:    func() string { return fmt.Sprintf("inst-%d", time.Now().UnixNano()) },
+		history:  NewDefaultExecutionHistory(),
+		recorder: newNodeRecorder(),
+		runs:     map[string]*inflight{},
+		hub:      hub,
+		waits:    map[string]*webhookWait{},
+		queues:   map[string]*FileQueue{},
+
+		recordFileRuns: RecordFileRuns(),
+	}
+	// The database is optional: without it runs are only kept in the file history
+	repo, err := OpenDefaultRepository(context.Background())
+	if err != nil {
+		m.warnf("database disabled: %v", err)
+	}
+	if repo != nil {
+		m.repo = repo
+		m.events = repository.NewEventRecorder(repo, deps.Bus)
+		deps.Bus = m.events
+	}
+	deps.Bus = instanceBus{m: m, next: deps.Bus}
+	deps.Workflows = m
+	deps.Webhooks = m
+	m.deps = deps
+	return m
+}
+
+// Events is the hub every engine and manager event is published to
+func (m *InstanceManager) Events() *EventHub { return m.hub }
+
+// History exposes the execution history shared by all instances.
+func (m *InstanceManager) History() *ExecutionHistory { return m.history }
+
+// Files returns the store node attachments and binary data live in
+func (m *InstanceManager) Files() plugin.FileStore { return m.deps.Files }
+
+// Repository returns the workflow database, or nil when none is configured.
+func (m *InstanceManager) Repository() *repository.Repository { return m.repo }
+
+// newEngine returns an engine wired to the manager's deps and node recorder
+func (m *InstanceManager) newEngine() *engine.Engine {
+	eng := engine.New(m.deps)
+	eng.OnNodeRun = m.observeNode
+	return eng
+}
+
+// execOptions describes where an execution comes from
+type execOptions struct {
+	instanceID  string
+	versionID   string // stored version being run, if any
+	triggeredBy string // failed execution, for error workflow runs
+	parent      string // calling execution, for sub-workflow runs
+	retried     bool   // a failure is retried, so it isn't final yet
+}
+
+// execute runs one execution and records it in history; the returned
+// record is the finished one. While it runs it can be cancelled by ID.
+func (m *InstanceManager) execute(ctx context.Context, eng *engine.Engine, execID string, wf model.Workflow, inputs map[model.ID]model.Items, opts execOptions) (rec ExecutionRecord, err error) {
+	run := m.track(ctx, execID, opts.instanceID, wf)
+	defer func() {
+		m.finish(execID, run, rec, err)
+		// a waiting webhook caller is answered by the attempt that retries
+		if !opts.retried || rec.Status != ExecutionFailed {
+			m.settleWebhook(execID, wf, rec, err)
+		}
+	}()
+	ctx = run.ctx
+
+	rec = ExecutionRecord{
+		ExecutionID:  execID,
+		InstanceID:   opts.instanceID,
+		WorkflowID:   wf.ID,
+		WorkflowName: wf.Name,
+		Status:       ExecutionRunning,
+		StartedAt:    time.Now(),
+		Input:        cloneItemsMap(inputs),
+		TriggeredBy:  opts.triggeredBy,
+
+		ParentExecutionID: opts.parent,
 	}
+	rec.RunID, rec.Version = m.beginRun(ctx, execID, wf, opts)
+	_ = m.history.Save(rec)
+	started := map[string]any{"exec": execID, "workflow": wf.ID}
+	if opts.parent != "" {
+		started["parent"] = opts.parent
+	}
+	m.deps.Bus.Emit(ctx, "execution_started", started)
+
+	res, err := eng.Run(ctx, execID, wf, inputs)
+	rec.FinishedAt = time.Now()
+	rec.DurationMS = rec.FinishedAt.Sub(rec.StartedAt).Milliseconds()
+	rec.Nodes = m.recorder.take(execID)
+	switch {
+	case err == nil:
+		rec.Status = ExecutionSucceeded
+		rec.Result = cloneItemsMap(res)
+		rec.Lineage = resultLineage(res, rec.Nodes)
+	case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+		rec.Status = ExecutionCancelled
+		rec.Error = err.Error()
+	default:
+		rec.Status = ExecutionFailed
+		rec.Error = err.Error()
+		// failing error workflows don't trigger another one, failing
+		// sub-workflows are handled by their caller and retried jobs only
+		// report their last attempt
+		if opts.triggeredBy == "" && opts.parent == "" && !opts.retried {
+			rec.ErrorExecutionID = m.startErrorWorkflow(context.WithoutCancel(ctx), wf, rec)
+		}
+	}
+	_ = m.history.Save(rec)
+	m.deps.Bus.Emit(context.WithoutCancel(ctx), "execution_finished", map[string]any{"exec": execID, "status": rec.Status, "error": rec.Error})
+	m.finishRun(rec.RunID, rec)
+	return rec, err
+}
+
+// resultLineage picks the main-port lineage of the nodes in res
+func resultLineage(res map[model.ID]model.Items, nodes []NodeExecution) map[model.ID]model.Lineage {
+	out := map[model.ID]model.Lineage{}
+	for _, n := range nodes {
+		if _, ok := res[n.NodeID]; ok && n.Lineage != nil {
+			out[n.NodeID] = n.Lineage[model.PortMain]
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
 }
 
 func (m *InstanceManager) List() []*Instance {
@@ -150,98 +354,249 @@ func (m *InstanceManager) Get(id string) (*Instance, bool) {
 }
 
 func (m *InstanceManager) CreateFromWorkflowPath(path string) (*Instance, error) {
-	b, err := os.ReadFile(path)
+	req, err := readWorkflowRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	wf, inputs, err := workflowFromRequest(req)
 	if err != nil {
 		return nil, err
 	}
-	var req n8n.N8nRequest
-	if err := json.Unmarshal(b, &req); err != nil {
+	schedules, err := parseSchedules(wf)
+	if err != nil {
 		return nil, err
 	}
-	wf, inputs := n8n.ToRivulet(req)
+	webhooks, err := parseWebhooks(wf)
+	if err != nil {
+		return nil, err
+	}
+	watches, err := parseFSWatches(wf)
+	if err != nil {
+		return nil, err
+	}
+	// a workflow with triggers waits for them unless the file carries
+	// data of its own
+	if len(schedules)+len(webhooks)+len(watches) > 0 && len(req.Data) == 0 {
+		inputs = nil
+	}
 
 	inst := &Instance{
 		ID:           m.newID(),
 		Name:         wf.Name,
 		WorkflowPath: path,
 		Workflow:     wf,
-		CreatedAt:    time.Now(),
-		State:        InstanceRunning,
-		q:            make(chan map[model.ID]model.Items, 64),
-		deps:         m.deps,
-		maxLogs:      1000,
+		schedules:    schedules,
+		webhooks:     webhooks,
+		watches:      watches,
+	}
+	if err := m.openQueue(inst); err != nil {
+		return nil, err
+	}
+	if err := m.registerWebhooks(inst); err != nil {
+		m.releaseQueue(inst)
+		return nil, err
+	}
+	m.start(inst, inputs)
+	return inst, nil
+}
+
+// CreateFromStoredWorkflow starts an instance of a stored workflow, pinned
+// to version when it is > 0 and following the latest version otherwise.
+func (m *InstanceManager) CreateFromStoredWorkflow(ctx context.Context, ref string, version int) (*Instance, error) {
+	w, err := m.ResolveWorkflow(ctx, ref)
+	if err != nil {
+		return nil, err
 	}
+	v, err := m.ResolveVersion(ctx, w.ID, version)
+	if err != nil {
+		return nil, fmt.Errorf("workflow %s version %d: %w", w.Slug, version, err)
+	}
+	wf, err := WorkflowFromVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.Validate(wf).Err(); err != nil {
+		return nil, err
+	}
+	schedules, err := parseSchedules(wf)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := parseWebhooks(wf)
+	if err != nil {
+		return nil, err
+	}
+	watches, err := parseFSWatches(wf)
+	if err != nil {
+		return nil, err
+	}
+	inst := &Instance{
+		ID:               m.newID(),
+		Name:             wf.Name,
+		Workflow:         wf,
+		StoredWorkflowID: w.ID,
+		PinnedVersion:    version,
+		versionID:        v.ID,
+		version:          v.Number,
+		schedules:        schedules,
+		webhooks:         webhooks,
+		watches:          watches,
+	}
+	if err := m.openQueue(inst); err != nil {
+		return nil, err
+	}
+	if err := m.registerWebhooks(inst); err != nil {
+		m.releaseQueue(inst)
+		return nil, err
+	}
+	m.start(inst, nil)
+	return inst, nil
+}
+
+// refreshVersion loads the latest version of a stored workflow into an
+// instance that follows it. A version that fails to load or validate is
+// logged and the instance keeps running the one it has.
+func (m *InstanceManager) refreshVersion(ctx context.Context, inst *Instance) {
+	if inst.StoredWorkflowID == "" || inst.PinnedVersion != 0 {
+		return
+	}
+	v, err := m.ResolveVersion(ctx, inst.StoredWorkflowID, 0)
+	if err != nil || v.ID == inst.versionID {
+		return
+	}
+	wf, err := WorkflowFromVersion(v)
+	if err == nil {
+		err = engine.Validate(wf).Err()
+	}
+	if err != nil {
+		inst.logf("version %d not loaded: %v", v.Number, err)
+		return
+	}
+	inst.statsMu.Lock()
+	inst.Workflow = wf
+	inst.versionID, inst.version = v.ID, v.Number
+	inst.statsMu.Unlock()
+	inst.logf("loaded workflow version %d", v.Number)
+}
+
+// start registers inst and runs its queue until it is stopped
+func (m *InstanceManager) start(inst *Instance, inputs map[model.ID]model.Items) {
+	inst.CreatedAt = time.Now()
+	inst.State = InstanceRunning
+	inst.deps = m.deps
+	inst.maxLogs = 1000
 
 	ctx, cancel := context.WithCancel(context.Background())
 	inst.cancel = cancel
-	eng := engine.New(m.deps)
+	eng := m.newEngine()
 
 	go func() {
 		inst.logf("instance started: %s", inst.ID)
+		m.deps.Bus.Emit(ctx, "instance_started", map[string]any{"instance": inst.ID})
+		m.startSchedules(ctx, inst)
+		m.startFSWatches(ctx, inst)
 		// Auto-enqueue initial inputs from the workflow file if present
 		if len(inputs) > 0 {
-			select {
-			case inst.q <- inputs:
-			default:
-				inst.logf("initial inputs dropped: queue full")
+			if err := m.enqueue(ctx, inst, newExecID(), inputs); err != nil {
+				inst.logf("initial inputs dropped: %v", err)
 			}
 		}
 		for {
-			select {
-			case <-ctx.Done():
+			job, err := inst.q.Receive(ctx)
+			if err != nil {
+				m.unregisterWebhooks(inst.ID)
+				m.releaseQueue(inst)
+				inst.statsMu.Lock()
 				inst.State = InstanceStopped
+				inst.statsMu.Unlock()
 				inst.logf("instance stopped: %s", inst.ID)
+				m.deps.Bus.Emit(context.Background(), "instance_stopped", map[string]any{"instance": inst.ID})
 				return
-			case inputs := <-inst.q:
-				execID := fmt.Sprintf("exec-%d", time.Now().UnixNano())
-				inst.logf("execution started: %s", execID)
-				start := time.Now()
-				inst.statsMu.Lock()
-				inst.active = ActiveExecution{
-					ExecutionID: execID,
-					StartedAt:   start,
-					IsExecuting: true,
-				}
-				inst.statsMu.Unlock()
-				res, err := eng.Run(ctx, execID, inst.Workflow, inputs)
-				duration := time.Since(start)
-				inst.statsMu.Lock()
-				inst.stats.TotalExecutions++
-				inst.stats.LastRunAt = time.Now()
-				inst.lastRun = ExecutionRecord{
-					ExecutionID: execID,
-					StartedAt:   start,
-					FinishedAt:  time.Now(),
-					DurationMS:  duration.Milliseconds(),
-					Input:       cloneItemsMap(inputs),
-				}
-				inst.active = ActiveExecution{}
-				if err != nil {
-					inst.stats.FailedExecutions++
-					inst.lastRun.Error = err.Error()
-					inst.statsMu.Unlock()
-					inst.logf("execution %s error: %v", execID, err)
-					continue
-				}
-				inst.stats.SuccessfulExecutions++
-				inst.stats.TotalSuccessDuration += duration
-				inst.lastRun.Result = cloneItemsMap(res)
-				inst.statsMu.Unlock()
-
-				// summarize results
-				total := 0
-				for _, items := range res {
-					total += len(items)
-				}
-				inst.logf("execution %s completed, total items: %d", execID, total)
 			}
+			rec, err := m.runJob(ctx, eng, inst, job)
+			m.settleJob(inst, job, rec, err)
 		}
 	}()
 
 	m.mu.Lock()
 	m.items[inst.ID] = inst
 	m.mu.Unlock()
-	return inst, nil
+}
+
+// runJob runs one queued execution of inst and updates its stats
+func (m *InstanceManager) runJob(ctx context.Context, eng *engine.Engine, inst *Instance, job Job) (ExecutionRecord, error) {
+	m.refreshVersion(ctx, inst)
+	execID, inputs := jobExecID(job), job.Inputs
+	inst.logf("execution started: %s", execID)
+	start := time.Now()
+	inst.statsMu.Lock()
+	inst.active = ActiveExecution{
+		ExecutionID: execID,
+		StartedAt:   start,
+		IsExecuting: true,
+	}
+	wf, versionID := inst.Workflow, inst.versionID
+	inst.statsMu.Unlock()
+	opts := execOptions{instanceID: inst.ID, versionID: versionID, retried: job.Attempts < inst.retry.maxAttempts}
+	rec, err := m.execute(ctx, eng, execID, wf, inputs, opts)
+	inst.statsMu.Lock()
+	inst.stats.TotalExecutions++
+	inst.stats.LastRunAt = time.Now()
+	inst.lastRun = rec.summary()
+	inst.lastRun.Input = rec.Input
+	inst.lastRun.Result = rec.Result
+	inst.active = ActiveExecution{}
+	if err != nil {
+		inst.stats.FailedExecutions++
+		inst.statsMu.Unlock()
+		inst.logf("execution %s error: %v", execID, err)
+		if rec.ErrorExecutionID != "" {
+			inst.logf("error workflow started: %s", rec.ErrorExecutionID)
+		}
+		return rec, err
+	}
+	inst.stats.SuccessfulExecutions++
+	inst.stats.TotalSuccessDuration += rec.FinishedAt.Sub(rec.StartedAt)
+	inst.statsMu.Unlock()
+
+	// summarize results
+	total := 0
+	for _, items := range rec.Result {
+		total += len(items)
+	}
+	inst.logf("execution %s completed, total items: %d", execID, total)
+	return rec, nil
+}
+
+// jobExecID is the execution ID of the current attempt at job. Later
+// attempts get their own ID so each keeps its history record.
+func jobExecID(job Job) string {
+	if job.Attempts <= 1 {
+		return job.ExecID
+	}
+	return fmt.Sprintf("%s-%d", job.ExecID, job.Attempts)
+}
+
+// settleJob acks a job that ran, retries a failed one while it has
+// attempts left and dead-letters it after that. Cancelled executions are
+// not failures and are acked too.
+func (m *InstanceManager) settleJob(inst *Instance, job Job, rec ExecutionRecord, err error) {
+	if err != nil && rec.Status == ExecutionFailed {
+		if job.Attempts < inst.retry.maxAttempts {
+			delay := inst.retry.backoff(job.Attempts)
+			inst.logf("job %s failed on attempt %d of %d, retrying in %s", job.ID, job.Attempts, inst.retry.maxAttempts, delay)
+			m.moveWebhookWait(rec.ExecutionID, jobExecID(Job{ExecID: job.ExecID, Attempts: job.Attempts + 1}))
+			if err := inst.q.Nack(job.ID, delay); err != nil {
+				inst.logf("job %s not released: %v", job.ID, err)
+			}
+			return
+		}
+		m.deadLetter(inst, job, rec)
+		return
+	}
+	if err := inst.q.Ack(job.ID); err != nil {
+		inst.logf("job %s not acked: %v", job.ID, err)
+	}
 }
 
 func cloneItemsMap(src map[model.ID]model.Items) map[model.ID]model.Items {
@@ -273,27 +628,27 @@ func (m *InstanceManager) Stop(id string) error {
 	if inst.cancel != nil {
 		inst.cancel()
 	}
+	// free the instance's webhook paths right away
+	m.unregisterWebhooks(id)
 	return nil
 }
 
-func (m *InstanceManager) Enqueue(id string, inputs map[string]model.Items) error {
-	m.mu.Lock()
-	inst, ok := m.items[id]
-	m.mu.Unlock()
-	if !ok {
-		return fmt.Errorf("instance not found")
+// Enqueue queues an execution of the instance and returns its ID
+func (m *InstanceManager) Enqueue(ctx context.Context, id string, inputs map[string]model.Items) (string, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return "", err
 	}
 	// Convert map[string]model.Items to map[model.ID]model.Items for queue
 	converted := make(map[model.ID]model.Items, len(inputs))
 	for k, v := range inputs {
 		converted[model.ID(k)] = v
 	}
-	select {
-	case inst.q <- converted:
-		return nil
-	default:
-		return fmt.Errorf("queue full")
+	execID := newExecID()
+	if err := m.enqueue(ctx, inst, execID, converted); err != nil {
+		return "", err
 	}
+	return execID, nil
 }
 
 func (m *InstanceManager) Logs(id string) ([]string, error) {
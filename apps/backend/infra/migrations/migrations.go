@@ -0,0 +1,25 @@
+// Package migrations embeds the SQL schema migrations. Files in this
+// directory target Postgres; sqlite/ holds the equivalent SQLite schema.
+// Each file manages its own transaction and is applied once, in file name
+// order, by repository.Migrate.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var postgres embed.FS
+
+//go:embed sqlite/*.sql
+var sqlite embed.FS
+
+// Postgres returns the Postgres migrations
+func Postgres() fs.FS { return postgres }
+
+// SQLite returns the SQLite migrations
+func SQLite() fs.FS {
+	sub, _ := fs.Sub(sqlite, "sqlite")
+	return sub
+}
@@ -0,0 +1,104 @@
+-- 001_create_workflow_tables.sql (SQLite)
+-- Mirrors ../001_create_workflow_tables.sql for embedded/local use.
+-- UUIDs and timestamps are generated by the application; enums are CHECKs
+-- and jsonb columns are TEXT.
+
+BEGIN;
+
+CREATE TABLE workflows (
+    id TEXT PRIMARY KEY,
+    slug TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT,
+    owner_id TEXT,
+    state TEXT DEFAULT 'draft' CHECK (state IN ('draft', 'active', 'archived')),
+    default_version_id TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE workflow_versions (
+    id TEXT PRIMARY KEY,
+    workflow_id TEXT NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    version_number INTEGER NOT NULL,
+    config TEXT NOT NULL,
+    config_hash BLOB,
+    changelog TEXT,
+    created_by TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (workflow_id, version_number)
+);
+
+CREATE TABLE workflow_nodes (
+    id TEXT PRIMARY KEY,
+    version_id TEXT NOT NULL REFERENCES workflow_versions(id) ON DELETE CASCADE,
+    node_key TEXT NOT NULL,
+    node_type TEXT NOT NULL,
+    name TEXT,
+    spec TEXT NOT NULL,
+    position TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (version_id, node_key)
+);
+
+CREATE TABLE workflow_edges (
+    id TEXT PRIMARY KEY,
+    version_id TEXT NOT NULL REFERENCES workflow_versions(id) ON DELETE CASCADE,
+    source_node_id TEXT NOT NULL REFERENCES workflow_nodes(id) ON DELETE CASCADE,
+    target_node_id TEXT NOT NULL REFERENCES workflow_nodes(id) ON DELETE CASCADE,
+    condition TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (version_id, source_node_id, target_node_id, condition)
+);
+
+CREATE TABLE workflow_runs (
+    id TEXT PRIMARY KEY,
+    workflow_id TEXT NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    version_id TEXT REFERENCES workflow_versions(id),
+    trigger TEXT,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'succeeded', 'failed', 'cancelled')),
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    metrics TEXT,
+    context TEXT,
+    error TEXT
+);
+
+CREATE TABLE workflow_run_events (
+    id TEXT PRIMARY KEY,
+    run_id TEXT NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    node_id TEXT REFERENCES workflow_nodes(id),
+    step TEXT,
+    event_type TEXT NOT NULL,
+    payload TEXT,
+    occurred_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE artifacts (
+    id TEXT PRIMARY KEY,
+    run_id TEXT NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    node_id TEXT REFERENCES workflow_nodes(id),
+    artifact_type TEXT NOT NULL,
+    location TEXT,
+    metadata TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE workflow_tags (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE workflow_tag_map (
+    workflow_id TEXT NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES workflow_tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (workflow_id, tag_id)
+);
+
+CREATE INDEX workflow_versions_workflow_idx ON workflow_versions (workflow_id, version_number DESC);
+CREATE INDEX workflow_nodes_version_key_idx ON workflow_nodes (version_id, node_key);
+CREATE INDEX workflow_runs_workflow_idx ON workflow_runs (workflow_id, started_at DESC);
+CREATE INDEX workflow_run_events_run_idx ON workflow_run_events (run_id, occurred_at);
+
+COMMIT;
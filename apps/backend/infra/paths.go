@@ -3,6 +3,9 @@ package infra
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+
+	"github.com/Tsinling0525/rivulet/infra/repository"
 )
 
 // DataDir returns the base directory to persist data. Defaults to ./data
@@ -21,6 +24,21 @@ func WorkflowsDir() string { return filepath.Join(DataDir(), "workflows") }
 // ScriptsDir is the directory to store Python scripts
 func ScriptsDir() string { return filepath.Join(DataDir(), "scripts") }
 
+// StateDir is the directory holding persisted node state per execution
+func StateDir() string { return filepath.Join(DataDir(), "state") }
+
+// ExecutionsDir is the directory holding execution history records
+func ExecutionsDir() string { return filepath.Join(DataDir(), "executions") }
+
+// SchedulesDir is the directory holding the fire times of schedules
+func SchedulesDir() string { return filepath.Join(DataDir(), "schedules") }
+
+// QueuesDir is the directory holding the durable queues of workflows
+func QueuesDir() string { return filepath.Join(DataDir(), "queues") }
+
+// DeadLettersDir is the directory holding the inputs of failed executions
+func DeadLettersDir() string { return filepath.Join(DataDir(), "dead_letters") }
+
 // FilesDir returns directory for attachments under a workflow
 func FilesDir(workflowID string) string { return filepath.Join(DataDir(), "files", workflowID) }
 
@@ -31,3 +49,26 @@ func FrontendDir() string {
 	}
 	return filepath.Join("apps", "frontend")
 }
+
+// DatabaseConfig returns the driver and DSN from RIV_DB_DRIVER and RIV_DB_DSN.
+// The default is an SQLite file under DataDir(); driver "none" disables the database.
+func DatabaseConfig() (driver, dsn string) {
+	driver = os.Getenv("RIV_DB_DRIVER")
+	if driver == "" {
+		driver = "sqlite"
+	}
+	dsn = os.Getenv("RIV_DB_DSN")
+	if dsn == "" && driver == "sqlite" {
+		dsn = repository.SQLiteDSN(filepath.Join(DataDir(), "rivulet.db"))
+	}
+	return driver, dsn
+}
+
+// RecordFileRuns reports whether runs of workflow files, not only of stored
+// workflows, are recorded in the database (RIV_DB_RECORD_FILE_RUNS). Each
+// recorded file then becomes a stored workflow, with its ID prefixed by
+// "file:", and a version per change.
+func RecordFileRuns() bool {
+	on, _ := strconv.ParseBool(os.Getenv("RIV_DB_RECORD_FILE_RUNS"))
+	return on
+}
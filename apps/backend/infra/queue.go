@@ -1,30 +1,341 @@
 package infra
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
-type Job struct{ ExecID string }
+	"github.com/Tsinling0525/rivulet/model"
+)
 
+// Job is one queued execution of an instance
+type Job struct {
+	ID         string                   `json:"id"` // assigned by Push
+	ExecID     string                   `json:"exec_id"`
+	Inputs     map[model.ID]model.Items `json:"inputs,omitempty"`
+	Attempts   int                      `json:"attempts"` // deliveries so far, the current one included
+	EnqueuedAt time.Time                `json:"enqueued_at"`
+}
+
+// Queue hands out jobs at least once: a job taken by Pop or Receive is
+// leased until it is acked or nacked, or until its visibility timeout
+// passes and it is delivered again.
 type Queue interface {
-	Push(Job)
+	// Push adds a job; at capacity it blocks, fails or drops the oldest
+	// job as the overflow policy says
+	Push(ctx context.Context, j Job) (Job, error)
+	// Pop leases the oldest deliverable job, if any
 	Pop() (Job, bool)
+	// Receive waits for a deliverable job and leases it
+	Receive(ctx context.Context) (Job, error)
+	// Ack removes a delivered job
+	Ack(id string) error
+	// Nack releases a delivered job for redelivery after delay
+	Nack(id string, delay time.Duration) error
+	// Len counts the jobs waiting or leased
+	Len() int
+	Close() error
+}
+
+// OverflowPolicy says what Push does when the queue is at capacity
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // wait for room
+	OverflowReject     OverflowPolicy = "reject"      // fail with ErrQueueFull
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // drop the oldest job not leased
+)
+
+// Queue defaults
+const (
+	DefaultQueueCapacity          = 1024
+	DefaultQueueVisibilityTimeout = 10 * time.Minute
+)
+
+var (
+	ErrQueueFull   = errors.New("queue full")
+	ErrQueueClosed = errors.New("queue closed")
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// QueueOptions configures a queue; zero values take the defaults
+type QueueOptions struct {
+	Capacity          int
+	Overflow          OverflowPolicy
+	VisibilityTimeout time.Duration
+	OnDrop            func(Job) // called for jobs dropped by OverflowDropOldest
+}
+
+func (o QueueOptions) withDefaults() (QueueOptions, error) {
+	if o.Capacity <= 0 {
+		o.Capacity = DefaultQueueCapacity
+	}
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = DefaultQueueVisibilityTimeout
+	}
+	switch o.Overflow {
+	case "":
+		o.Overflow = OverflowBlock
+	case OverflowBlock, OverflowReject, OverflowDropOldest:
+	default:
+		return o, fmt.Errorf("unknown overflow policy %q", o.Overflow)
+	}
+	return o, nil
+}
+
+// queueEntry is a job with its delivery state
+type queueEntry struct {
+	job         Job
+	leasedUntil time.Time
+	notBefore   time.Time // set by Nack with a delay
+}
+
+func (e *queueEntry) leased(now time.Time) bool { return now.Before(e.leasedUntil) }
+
+// deliverableAt is when the entry can be handed out (again)
+func (e *queueEntry) deliverableAt() time.Time {
+	if e.notBefore.After(e.leasedUntil) {
+		return e.notBefore
+	}
+	return e.leasedUntil
+}
+
+// jobQueue implements Queue in memory, writing every change to journal
+// when it has one
+type jobQueue struct {
+	opts QueueOptions
+
+	mu      sync.Mutex
+	entries []*queueEntry // in push order
+	byID    map[string]*queueEntry
+	changed chan struct{} // closed and replaced on every change
+	closed  bool
+	journal *queueJournal
+}
+
+func newJobQueue(opts QueueOptions) *jobQueue {
+	return &jobQueue{opts: opts, byID: map[string]*queueEntry{}, changed: make(chan struct{})}
+}
+
+// MemQueue is a Queue that lives in memory only
+type MemQueue struct{ *jobQueue }
+
+func NewMemQueue(opts QueueOptions) (*MemQueue, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &MemQueue{newJobQueue(opts)}, nil
+}
+
+// notify wakes everyone waiting on the queue; q.mu must be held
+func (q *jobQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
 }
 
-type MemQueue struct {
-	mu sync.Mutex
-	q  []Job
+var jobSeq atomic.Uint64
+
+func newJobID() string { return fmt.Sprintf("job-%d-%d", time.Now().UnixNano(), jobSeq.Add(1)) }
+
+func (q *jobQueue) Push(ctx context.Context, j Job) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return Job{}, ErrQueueClosed
+		}
+		if len(q.entries) < q.opts.Capacity {
+			break
+		}
+		switch q.opts.Overflow {
+		case OverflowReject:
+			return Job{}, ErrQueueFull
+		case OverflowDropOldest:
+			dropped, ok := q.dropOldest()
+			if !ok {
+				return Job{}, ErrQueueFull
+			}
+			if q.opts.OnDrop != nil {
+				q.opts.OnDrop(dropped)
+			}
+			continue
+		}
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			return Job{}, ctx.Err()
+		case <-changed:
+		}
+		q.mu.Lock()
+	}
+	if j.ID == "" {
+		j.ID = newJobID()
+	}
+	if j.EnqueuedAt.IsZero() {
+		j.EnqueuedAt = time.Now().UTC()
+	}
+	if _, ok := q.byID[j.ID]; ok {
+		return Job{}, fmt.Errorf("job %s already queued", j.ID)
+	}
+	if err := q.journal.append(queueRecord{Op: opPush, Job: &j}); err != nil {
+		return Job{}, err
+	}
+	e := &queueEntry{job: j}
+	q.entries = append(q.entries, e)
+	q.byID[j.ID] = e
+	q.notify()
+	return j, nil
+}
+
+// dropOldest removes the oldest job that isn't leased; q.mu must be held
+func (q *jobQueue) dropOldest() (Job, bool) {
+	now := time.Now()
+	for _, e := range q.entries {
+		if e.leased(now) {
+			continue
+		}
+		// a job that can't be dropped on disk would come back on restart;
+		// dropping it from memory still makes room
+		_ = q.journal.append(queueRecord{Op: opAck, ID: e.job.ID})
+		q.remove(e.job.ID)
+		return e.job, true
+	}
+	return Job{}, false
+}
+
+// remove deletes an entry; q.mu must be held
+func (q *jobQueue) remove(id string) {
+	delete(q.byID, id)
+	for i, e := range q.entries {
+		if e.job.ID == id {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			break
+		}
+	}
+	q.notify()
+}
+
+func (q *jobQueue) Pop() (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok, _ := q.lease(time.Now())
+	return j, ok
 }
 
-func NewMemQueue() *MemQueue { return &MemQueue{} }
+// lease hands out the oldest deliverable job, or reports when the next one
+// becomes deliverable (zero when none will); q.mu must be held
+func (q *jobQueue) lease(now time.Time) (Job, bool, time.Time) {
+	if q.closed {
+		return Job{}, false, time.Time{}
+	}
+	var next time.Time
+	for _, e := range q.entries {
+		if at := e.deliverableAt(); at.After(now) {
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+			continue
+		}
+		if err := q.journal.append(queueRecord{Op: opLease, ID: e.job.ID}); err != nil {
+			return Job{}, false, now.Add(time.Second)
+		}
+		e.job.Attempts++
+		e.leasedUntil = now.Add(q.opts.VisibilityTimeout)
+		e.notBefore = time.Time{}
+		return e.job, true, time.Time{}
+	}
+	return Job{}, false, next
+}
 
-func (mq *MemQueue) Push(j Job) { mq.mu.Lock(); defer mq.mu.Unlock(); mq.q = append(mq.q, j) }
+func (q *jobQueue) Receive(ctx context.Context) (Job, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return Job{}, err
+		}
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return Job{}, ErrQueueClosed
+		}
+		j, ok, next := q.lease(time.Now())
+		changed := q.changed
+		q.mu.Unlock()
+		if ok {
+			return j, nil
+		}
+		var (
+			timer *time.Timer
+			wake  <-chan time.Time
+		)
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			wake = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
 
-func (mq *MemQueue) Pop() (Job, bool) {
-	mq.mu.Lock()
-	defer mq.mu.Unlock()
-	if len(mq.q) == 0 {
-		return Job{}, false
+func (q *jobQueue) Ack(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.byID[id]; !ok {
+		return ErrJobNotFound
+	}
+	// gone from memory either way, so a failed write only means the job
+	// is delivered again after a restart
+	err := q.journal.append(queueRecord{Op: opAck, ID: id})
+	q.remove(id)
+	if err != nil {
+		return err
 	}
-	j := mq.q[0]
-	mq.q = mq.q[1:]
-	return j, true
+	return q.compact()
 }
+
+func (q *jobQueue) Nack(id string, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.byID[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	e.leasedUntil = time.Time{}
+	e.notBefore = time.Now().Add(delay)
+	q.notify()
+	nb := e.notBefore
+	return q.journal.append(queueRecord{Op: opNack, ID: id, NotBefore: &nb})
+}
+
+func (q *jobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+func (q *jobQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.notify()
+	return q.journal.close()
+}
+
+var (
+	_ Queue = (*MemQueue)(nil)
+	_ Queue = (*FileQueue)(nil)
+)
@@ -0,0 +1,247 @@
+package infra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Journal operations. A lease counts a delivery attempt; leases themselves
+// don't survive a restart, so leased jobs are delivered again. A nack
+// keeps its retry delay.
+const (
+	opPush  = "push"
+	opLease = "lease"
+	opNack  = "nack"
+	opAck   = "ack"
+)
+
+// queueRecord is one line of a queue journal
+type queueRecord struct {
+	Op  string `json:"op"`
+	Job *Job   `json:"job,omitempty"`
+	ID  string `json:"id,omitempty"`
+	// NotBefore is when a nacked job may be delivered again
+	NotBefore *time.Time `json:"not_before,omitempty"`
+}
+
+// entryRecords journals an entry: its push and, while it waits out a
+// retry delay, the nack
+func entryRecords(e *queueEntry) []queueRecord {
+	recs := []queueRecord{{Op: opPush, Job: &e.job}}
+	if !e.notBefore.IsZero() {
+		nb := e.notBefore
+		recs = append(recs, queueRecord{Op: opNack, ID: e.job.ID, NotBefore: &nb})
+	}
+	return recs
+}
+
+// queueJournal is an append-only file of queue records, synced after every
+// write. A nil journal writes nothing.
+type queueJournal struct {
+	path    string
+	f       *os.File
+	records int // lines in the file
+}
+
+// compactAfter is the journal length past which it is rewritten with only
+// the jobs still queued
+const compactAfter = 4096
+
+func (j *queueJournal) append(recs ...queueRecord) error {
+	if j == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, r := range recs {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	if _, err := j.f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	j.records += len(recs)
+	return j.f.Sync()
+}
+
+func (j *queueJournal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+// rewrite replaces the journal with the records of entries, atomically
+func (j *queueJournal) rewrite(entries []*queueEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), "."+filepath.Base(j.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	records := 0
+	for _, e := range entries {
+		for _, r := range entryRecords(e) {
+			b, err := json.Marshal(r)
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+			w.Write(b)
+			w.WriteByte('\n')
+			records++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	syncDir(filepath.Dir(j.path))
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f, j.records = tmp, records
+	return nil
+}
+
+// syncDir makes a rename in dir durable where the platform allows it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
+
+// FileQueue is a Queue journaled to a file, so jobs that were not acked
+// survive a restart
+type FileQueue struct{ *jobQueue }
+
+// OpenFileQueue opens the queue journaled in dir, creating it if needed,
+// and loads the jobs left in it
+func OpenFileQueue(dir string, opts QueueOptions) (*FileQueue, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureDir(dir); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "queue.log")
+	entries, err := replayQueue(path)
+	if err != nil {
+		return nil, err
+	}
+	q := newJobQueue(opts)
+	for _, e := range entries {
+		q.entries = append(q.entries, e)
+		q.byID[e.job.ID] = e
+	}
+	// start from a compact journal, which also drops a torn last line
+	q.journal = &queueJournal{path: path}
+	if err := q.journal.rewrite(entries); err != nil {
+		return nil, err
+	}
+	return &FileQueue{q}, nil
+}
+
+// replayQueue reads a journal into the jobs still queued, in push order,
+// with their retry delays. A last line cut short by a crash is ignored.
+func replayQueue(path string) ([]*queueEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		order   []string
+		entries = map[string]*queueEntry{}
+	)
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec queueRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		switch rec.Op {
+		case opPush:
+			if rec.Job != nil {
+				order = append(order, rec.Job.ID)
+				entries[rec.Job.ID] = &queueEntry{job: *rec.Job}
+			}
+		case opLease:
+			if e := entries[rec.ID]; e != nil {
+				e.job.Attempts++
+				e.notBefore = time.Time{}
+			}
+		case opNack:
+			if e := entries[rec.ID]; e != nil && rec.NotBefore != nil {
+				e.notBefore = *rec.NotBefore
+			}
+		case opAck:
+			delete(entries, rec.ID)
+		}
+	}
+	out := make([]*queueEntry, 0, len(entries))
+	for _, id := range order {
+		if e := entries[id]; e != nil {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// restore adds entries taken over from another queue with their IDs,
+// attempts and retry delays, regardless of capacity. Jobs already queued
+// are skipped.
+func (q *jobQueue) restore(entries []*queueEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range entries {
+		if _, ok := q.byID[e.job.ID]; ok {
+			continue
+		}
+		if err := q.journal.append(entryRecords(e)...); err != nil {
+			return err
+		}
+		q.entries = append(q.entries, e)
+		q.byID[e.job.ID] = e
+	}
+	q.notify()
+	return nil
+}
+
+// compact rewrites a long journal; q.mu must be held
+func (q *jobQueue) compact() error {
+	if q.journal == nil || q.journal.records < compactAfter || q.journal.records < 4*len(q.entries) {
+		return nil
+	}
+	return q.journal.rewrite(q.entries)
+}
@@ -0,0 +1,251 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+func TestFileQueueRedeliversAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	q, err := OpenFileQueue(dir, QueueOptions{VisibilityTimeout: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := q.Push(ctx, Job{ID: id, ExecID: "exec-" + id, Inputs: map[model.ID]model.Items{"n": {{"id": id}}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ := q.Pop()
+	b, _ := q.Pop()
+	if a.ID != "a" || b.ID != "b" || a.Attempts != 1 {
+		t.Fatalf("unexpected deliveries %+v %+v", a, b)
+	}
+	if err := q.Ack("a"); err != nil {
+		t.Fatal(err)
+	}
+	// b's lease runs out and it comes back before c
+	time.Sleep(40 * time.Millisecond)
+	if j, _ := q.Pop(); j.ID != "b" || j.Attempts != 2 {
+		t.Fatalf("expected b to be redelivered, got %+v", j)
+	}
+	if err := q.Nack("b", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := q.Pop(); j.ID != "c" {
+		t.Fatalf("expected c while b is delayed, got %+v", j)
+	}
+	q.Close()
+
+	// a crash can leave half a record behind
+	f, _ := os.OpenFile(filepath.Join(dir, "queue.log"), os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"op":"ack","id":"b`)
+	f.Close()
+
+	q, err = OpenFileQueue(dir, QueueOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != 2 {
+		t.Fatalf("expected b and c to survive, got %d jobs", q.Len())
+	}
+	// c's lease is gone, b still waits out its retry delay
+	j, err := q.Receive(ctx)
+	if err != nil || j.ID != "c" || j.Attempts != 2 || j.Inputs["n"][0]["id"] != "c" {
+		t.Fatalf("unexpected job after restart %+v: %v", j, err)
+	}
+	if j, ok := q.Pop(); ok {
+		t.Fatalf("b was delivered before its retry delay: %+v", j)
+	}
+}
+
+func TestFileQueueKeepsRetryDelayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenFileQueue(dir, QueueOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(context.Background(), Job{ID: "a"})
+	q.Pop()
+	if err := q.Nack("a", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	// reopen twice, so the delay also survives the journal rewrite
+	for i := 0; i < 2; i++ {
+		if q, err = OpenFileQueue(dir, QueueOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if j, ok := q.Pop(); ok {
+			t.Fatalf("nacked job delivered early after restart: %+v", j)
+		}
+		if i == 0 {
+			q.Close()
+		}
+	}
+	defer q.Close()
+	time.Sleep(120 * time.Millisecond)
+	if j, ok := q.Pop(); !ok || j.ID != "a" || j.Attempts != 2 {
+		t.Fatalf("expected a once its delay passed, got %+v", j)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	ctx := context.Background()
+	var dropped []string
+	q, _ := NewMemQueue(QueueOptions{Capacity: 2, Overflow: OverflowDropOldest, OnDrop: func(j Job) { dropped = append(dropped, j.ID) }})
+	for _, id := range []string{"a", "b", "c"} {
+		q.Push(ctx, Job{ID: id})
+	}
+	if len(dropped) != 1 || dropped[0] != "a" || q.Len() != 2 {
+		t.Fatalf("expected a to be dropped, got %v", dropped)
+	}
+
+	q, _ = NewMemQueue(QueueOptions{Capacity: 1, Overflow: OverflowReject})
+	q.Push(ctx, Job{ID: "a"})
+	if _, err := q.Push(ctx, Job{ID: "b"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	q, _ = NewMemQueue(QueueOptions{Capacity: 1})
+	q.Push(ctx, Job{ID: "a"})
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Push(short, Job{ID: "b"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a full queue to block, got %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Ack("a")
+	}()
+	if _, err := q.Push(ctx, Job{ID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stopAndRelease stops instances and waits until their queues are closed
+func stopAndRelease(m *InstanceManager, ids ...string) {
+	for _, id := range ids {
+		_ = m.Stop(id)
+	}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		m.queuesMu.Lock()
+		open := len(m.queues)
+		m.queuesMu.Unlock()
+		if open == 0 {
+			return
+		}
+	}
+}
+
+func TestInstanceQueueSurvivesRestart(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	writeWorkflowFile(t, "durable.json", n8n.N8nWorkflow{
+		ID:    "durable",
+		Nodes: []n8n.N8nNode{{ID: "n", Name: "N", Type: "test:block"}},
+	})
+	path := filepath.Join(WorkflowsDir(), "durable.json")
+	m := NewInstanceManager()
+	inst, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// whatever runs first blocks until the instance stops, the rest stays queued
+	if _, err := m.Enqueue(ctx, inst.ID, map[string]model.Items{"n": {{"x": 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	queued, _ := m.Enqueue(ctx, inst.ID, map[string]model.Items{"n": {{"x": 2}}})
+	for deadline := time.Now().Add(2 * time.Second); !inst.Snapshot().Active.IsExecuting && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// the waiting job can be looked up before it starts
+	if rec, progress, err := m.Execution(queued); err != nil || rec.Status != ExecutionQueued || progress != nil {
+		t.Fatalf("expected a queued execution, got %+v %v (%v)", rec, progress, err)
+	}
+	stopAndRelease(m, inst.ID)
+
+	writeWorkflowFile(t, "durable.json", n8n.N8nWorkflow{
+		ID:    "durable",
+		Nodes: []n8n.N8nNode{{ID: "n", Name: "N", Type: "echo"}},
+	})
+	m = NewInstanceManager()
+	inst, err = m.CreateFromWorkflowPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if inst.Snapshot().QueueLength == 0 {
+			break
+		}
+	}
+	stopAndRelease(m, inst.ID)
+	rec, _, _ := m.History().Get(queued)
+	if rec.Status != ExecutionSucceeded || rec.InstanceID != inst.ID {
+		t.Fatalf("queued job not run after restart: %+v", rec)
+	}
+}
+
+func TestInstancesOfOneWorkflowKeepTheirJobs(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	writeWorkflowFile(t, "twins.json", n8n.N8nWorkflow{
+		ID:       "twins",
+		Nodes:    []n8n.N8nNode{{ID: "n", Name: "N", Type: "echo"}},
+		Settings: map[string]interface{}{"queue": map[string]any{"capacity": 5}},
+	})
+	path := filepath.Join(WorkflowsDir(), "twins.json")
+	m := NewInstanceManager()
+	a, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeWorkflowFile(t, "twins.json", n8n.N8nWorkflow{
+		ID:       "twins",
+		Nodes:    []n8n.N8nNode{{ID: "n", Name: "N", Type: "echo"}},
+		Settings: map[string]interface{}{"queue": map[string]any{"capacity": 1, "overflow": "reject"}},
+	})
+	b, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		m.Stop(a.ID)
+		t.Fatal(err)
+	}
+	defer stopAndRelease(m, a.ID, b.ID)
+	if a.q == b.q {
+		t.Fatal("instances share a queue")
+	}
+	// each queue keeps the options it was opened with
+	if a.q.(*FileQueue).opts.Capacity != 5 || b.q.(*FileQueue).opts.Overflow != OverflowReject {
+		t.Fatalf("unexpected options %+v %+v", a.q.(*FileQueue).opts, b.q.(*FileQueue).opts)
+	}
+	var execs []string
+	for i := 0; i < 3; i++ {
+		id, err := m.Enqueue(context.Background(), a.ID, map[string]model.Items{"n": {{"i": i}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		execs = append(execs, id)
+	}
+	for _, id := range execs {
+		var rec ExecutionRecord
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if rec, _, _ = m.History().Get(id); rec.Status == ExecutionSucceeded {
+				break
+			}
+		}
+		if rec.Status != ExecutionSucceeded || rec.InstanceID != a.ID {
+			t.Fatalf("job of %s ran as %+v", a.ID, rec)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package infra
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// QueueSetting configures the queue of a workflow's instances:
+// {"capacity": n, "overflow": "block|reject|drop_oldest", "visibility_timeout": "10m",
+// "max_attempts": n, "retry_delay": "1s"}
+const QueueSetting = "queue"
+
+// Retry defaults: a failed execution is dead-lettered right away
+const (
+	DefaultMaxAttempts = 1
+	DefaultRetryDelay  = time.Second
+)
+
+type queueSettings struct {
+	Capacity          int            `json:"capacity,omitempty"`
+	Overflow          OverflowPolicy `json:"overflow,omitempty"`
+	VisibilityTimeout string         `json:"visibility_timeout,omitempty"`
+	MaxAttempts       int            `json:"max_attempts,omitempty"`
+	RetryDelay        string         `json:"retry_delay,omitempty"`
+}
+
+func readQueueSettings(wf model.Workflow) (queueSettings, error) {
+	var s queueSettings
+	raw, ok := wf.Settings[QueueSetting]
+	if !ok || raw == nil {
+		return s, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("%s: %w", QueueSetting, err)
+	}
+	return s, nil
+}
+
+// parseQueueOptions reads the queue setting of wf
+func parseQueueOptions(wf model.Workflow) (QueueOptions, error) {
+	var opts QueueOptions
+	s, err := readQueueSettings(wf)
+	if err != nil {
+		return opts, err
+	}
+	opts.Capacity, opts.Overflow = s.Capacity, s.Overflow
+	if s.VisibilityTimeout != "" {
+		if opts.VisibilityTimeout, err = time.ParseDuration(s.VisibilityTimeout); err != nil {
+			return opts, fmt.Errorf("%s: visibility_timeout: %w", QueueSetting, err)
+		}
+	}
+	if opts, err = opts.withDefaults(); err != nil {
+		return opts, fmt.Errorf("%s: %w", QueueSetting, err)
+	}
+	return opts, nil
+}
+
+// retryPolicy says how often a failed execution is tried before its input
+// is dead-lettered
+type retryPolicy struct {
+	maxAttempts int
+	delay       time.Duration // before the second attempt, doubled for each one after
+}
+
+// backoff is the wait before the attempt following attempt n
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.delay
+	for i := 1; i < n && d < time.Hour; i++ {
+		d *= 2
+	}
+	return d
+}
+
+// parseRetryPolicy reads max_attempts and retry_delay from the queue
+// setting of wf
+func parseRetryPolicy(wf model.Workflow) (retryPolicy, error) {
+	p := retryPolicy{maxAttempts: DefaultMaxAttempts, delay: DefaultRetryDelay}
+	s, err := readQueueSettings(wf)
+	if err != nil {
+		return p, err
+	}
+	if s.MaxAttempts < 0 {
+		return p, fmt.Errorf("%s: max_attempts must not be negative", QueueSetting)
+	}
+	if s.MaxAttempts > 0 {
+		p.maxAttempts = s.MaxAttempts
+	}
+	if s.RetryDelay != "" {
+		if p.delay, err = time.ParseDuration(s.RetryDelay); err != nil {
+			return p, fmt.Errorf("%s: retry_delay: %w", QueueSetting, err)
+		}
+	}
+	return p, nil
+}
+
+// workflowKey names the files kept per workflow across instances: by the
+// stored workflow or the workflow file
+func workflowKey(inst *Instance) string {
+	key := "path:" + inst.WorkflowPath
+	if inst.StoredWorkflowID != "" {
+		key = "stored:" + inst.StoredWorkflowID
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// openQueue gives inst a durable queue and a dead-letter store of its own,
+// kept next to those of other instances of its workflow. Jobs and dead
+// letters left by instances that no longer run, in this process or an
+// earlier one, are taken over so they outlive a restart.
+func (m *InstanceManager) openQueue(inst *Instance) error {
+	opts, err := parseQueueOptions(inst.Workflow)
+	if err != nil {
+		return err
+	}
+	if inst.retry, err = parseRetryPolicy(inst.Workflow); err != nil {
+		return err
+	}
+	key := workflowKey(inst)
+	instID := inst.ID
+	opts.OnDrop = func(j Job) {
+		m.warnf("instance %s: queue full, dropped job %s", instID, j.ID)
+		m.deps.Bus.Emit(context.Background(), "job_dropped", map[string]any{"instance": instID, "exec": j.ExecID, "job": j.ID})
+		m.dropQueued(j)
+	}
+	dir := filepath.Join(QueuesDir(), key)
+	m.queuesMu.Lock()
+	defer m.queuesMu.Unlock()
+	q, err := OpenFileQueue(filepath.Join(dir, inst.ID), opts)
+	if err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	if err := m.adoptQueues(q, dir, inst.ID); err != nil {
+		q.Close()
+		return fmt.Errorf("queue: %w", err)
+	}
+	letters := filepath.Join(DeadLettersDir(), key)
+	inst.deadLetters = NewDeadLetterStore(filepath.Join(letters, inst.ID))
+	if err := m.adoptDeadLetters(inst.deadLetters, letters, inst.ID); err != nil {
+		q.Close()
+		return fmt.Errorf("dead letters: %w", err)
+	}
+	m.queues[inst.ID] = q
+	inst.q, inst.queueDir = q, filepath.Join(dir, inst.ID)
+	return nil
+}
+
+// adoptQueues moves the jobs left in the queues under dir that no running
+// instance holds into q; m.queuesMu must be held
+func (m *InstanceManager) adoptQueues(q *FileQueue, dir, self string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == self {
+			continue
+		}
+		if _, open := m.queues[e.Name()]; open {
+			continue
+		}
+		orphan := filepath.Join(dir, e.Name())
+		jobs, err := replayQueue(filepath.Join(orphan, "queue.log"))
+		if err != nil {
+			return err
+		}
+		// a crash before the removal only means the jobs are found
+		// again; restore skips the ones already queued
+		if err := q.restore(jobs); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(orphan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseQueue closes the queue of a stopped instance, removing it when no
+// jobs are left for another instance to take over
+func (m *InstanceManager) releaseQueue(inst *Instance) {
+	m.queuesMu.Lock()
+	defer m.queuesMu.Unlock()
+	q, ok := m.queues[inst.ID]
+	if !ok {
+		return
+	}
+	delete(m.queues, inst.ID)
+	if err := q.Close(); err != nil {
+		m.warnf("closing queue of %s: %v", inst.ID, err)
+	}
+	if q.Len() == 0 {
+		_ = os.RemoveAll(inst.queueDir)
+	}
+}
+
+// enqueue queues an execution of inst under execID. Depending on the
+// queue's overflow policy it waits for room until ctx ends. The execution
+// is recorded as queued first, so its ID can be looked up and followed
+// before the job starts.
+func (m *InstanceManager) enqueue(ctx context.Context, inst *Instance, execID string, inputs map[model.ID]model.Items) error {
+	inst.statsMu.Lock()
+	wf := inst.Workflow
+	inst.statsMu.Unlock()
+	rec := ExecutionRecord{
+		ExecutionID:  execID,
+		InstanceID:   inst.ID,
+		WorkflowID:   wf.ID,
+		WorkflowName: wf.Name,
+		Status:       ExecutionQueued,
+		StartedAt:    time.Now(),
+		Input:        cloneItemsMap(inputs),
+	}
+	if err := m.history.Save(rec); err != nil {
+		return err
+	}
+	if _, err := inst.q.Push(ctx, Job{ExecID: execID, Inputs: inputs}); err != nil {
+		_ = m.history.Delete(execID)
+		return err
+	}
+	return nil
+}
+
+// dropQueued records a job dropped from a full queue as cancelled
+func (m *InstanceManager) dropQueued(j Job) {
+	rec, found, err := m.history.Get(j.ExecID)
+	if err != nil || !found || rec.Status != ExecutionQueued {
+		return
+	}
+	rec.Status, rec.Error = ExecutionCancelled, "dropped: queue full"
+	rec.FinishedAt = time.Now()
+	_ = m.history.Save(rec)
+	m.deps.Bus.Emit(context.Background(), "execution_finished", map[string]any{"exec": j.ExecID, "status": rec.Status, "error": rec.Error})
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// EventRecorder is a plugin.EventBus that stores engine events of tracked
+// executions as workflow_run_events and forwards every event to Next.
+type EventRecorder struct {
+	repo *Repository
+	Next plugin.EventBus
+
+	mu   sync.RWMutex
+	runs map[string]trackedRun // by execution ID
+}
+
+type trackedRun struct {
+	runID string
+	nodes map[string]string // node key -> workflow_nodes.id
+}
+
+func NewEventRecorder(repo *Repository, next plugin.EventBus) *EventRecorder {
+	return &EventRecorder{repo: repo, Next: next, runs: map[string]trackedRun{}}
+}
+
+// Track starts recording events of execID against runID
+func (e *EventRecorder) Track(execID, runID string, nodes map[string]string) {
+	e.mu.Lock()
+	e.runs[execID] = trackedRun{runID: runID, nodes: nodes}
+	e.mu.Unlock()
+}
+
+// Untrack stops recording events of execID
+func (e *EventRecorder) Untrack(execID string) {
+	e.mu.Lock()
+	delete(e.runs, execID)
+	e.mu.Unlock()
+}
+
+func (e *EventRecorder) Emit(ctx context.Context, event string, fields map[string]any) error {
+	var nextErr error
+	if e.Next != nil {
+		nextErr = e.Next.Emit(ctx, event, fields)
+	}
+	execID, _ := fields["exec"].(string)
+	e.mu.RLock()
+	run, ok := e.runs[execID]
+	e.mu.RUnlock()
+	if !ok {
+		return nextErr
+	}
+	ev := RunEvent{RunID: run.runID, Type: event}
+	if node, ok := fields["node"]; ok {
+		ev.Step = fmt.Sprint(node)
+		ev.NodeID = run.nodes[ev.Step]
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	ev.Payload = payload
+	// the engine's context may already be cancelled; the event still belongs to the run
+	if _, err := e.repo.AppendRunEvent(context.WithoutCancel(ctx), ev); err != nil {
+		return err
+	}
+	return nextErr
+}
+
+var _ plugin.EventBus = (*EventRecorder)(nil)
@@ -0,0 +1,214 @@
+// Package repository persists workflows, versions, runs and run events in
+// the relational schema of infra/migrations through database/sql. SQLite
+// (embedded, pure Go) serves local and test use; Postgres is the dialect
+// the original migration targets.
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"github.com/Tsinling0525/rivulet/infra/migrations"
+)
+
+// ErrNotFound is returned when a looked up row does not exist
+var ErrNotFound = errors.New("not found")
+
+// Dialect captures the differences between the supported databases
+type Dialect interface {
+	Name() string
+	// Rebind rewrites the ? placeholders used in this package for the driver
+	Rebind(query string) string
+	Migrations() fs.FS
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string               { return "sqlite" }
+func (sqliteDialect) Rebind(query string) string { return query }
+func (sqliteDialect) Migrations() fs.FS          { return migrations.SQLite() }
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string      { return "postgres" }
+func (postgresDialect) Migrations() fs.FS { return migrations.Postgres() }
+func (postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var (
+	SQLite   Dialect = sqliteDialect{}
+	Postgres Dialect = postgresDialect{}
+)
+
+// Repository is the SQL-backed store for workflow definitions and runs
+type Repository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// New wraps an open database handle
+func New(db *sql.DB, dialect Dialect) *Repository {
+	return &Repository{db: db, dialect: dialect}
+}
+
+// Open connects using driver "sqlite" or "postgres" (alias "pgx").
+func Open(driver, dsn string) (*Repository, error) {
+	switch driver {
+	case "sqlite", "sqlite3":
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			return nil, err
+		}
+		// a single connection serialises writers instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+		return New(db, SQLite), nil
+	case "postgres", "pgx":
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return New(db, Postgres), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// SQLiteDSN builds a DSN for a database file with foreign keys enforced
+func SQLiteDSN(path string) string {
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	return "file:" + path + "?" + q.Encode()
+}
+
+// DB exposes the underlying handle
+func (r *Repository) DB() *sql.DB { return r.db }
+
+// Dialect reports which database the repository talks to
+func (r *Repository) Dialect() Dialect { return r.dialect }
+
+func (r *Repository) Close() error { return r.db.Close() }
+
+// Migrate applies the dialect's migrations that have not run yet, in file
+// name order, and returns the names it applied. Each file manages its own
+// transaction; schema_migrations records what has been applied.
+func (r *Repository) Migrate(ctx context.Context) ([]string, error) {
+	if _, err := r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version TEXT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL
+)`); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	applied := map[string]bool{}
+	rows, err := r.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fsys := r.dialect.Migrations()
+	names, err := fs.Glob(fsys, "*.sql") // sorted
+	if err != nil {
+		return nil, err
+	}
+	var done []string
+	for _, name := range names {
+		if applied[name] {
+			continue
+		}
+		script, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return done, err
+		}
+		if _, err := r.db.ExecContext(ctx, string(script)); err != nil {
+			return done, fmt.Errorf("migration %s: %w", name, err)
+		}
+		if _, err := r.exec(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, name, now()); err != nil {
+			return done, fmt.Errorf("record migration %s: %w", name, err)
+		}
+		done = append(done, name)
+	}
+	return done, nil
+}
+
+func (r *Repository) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return r.db.ExecContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r *Repository) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r *Repository) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.db.QueryRowContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+// inTx runs fn in a transaction, committing only if it succeeds
+func (r *Repository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// newID returns a random RFC 4122 version 4 UUID
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// now is truncated to microseconds, the resolution Postgres keeps
+func now() time.Time { return time.Now().UTC().Truncate(time.Microsecond) }
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullJSON(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
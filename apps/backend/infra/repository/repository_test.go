@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+func openTest(t *testing.T) *Repository {
+	t.Helper()
+	repo, err := Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	if _, err := repo.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	repo := openTest(t)
+	applied, err := repo.Migrate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("second migrate applied %v", applied)
+	}
+}
+
+func TestPostgresRebind(t *testing.T) {
+	got := Postgres.Rebind(`SELECT a FROM t WHERE b = ? AND c = ?`)
+	if got != `SELECT a FROM t WHERE b = $1 AND c = $2` {
+		t.Fatalf("rebind = %q", got)
+	}
+}
+
+func TestVersionsAndRuns(t *testing.T) {
+	ctx := context.Background()
+	repo := openTest(t)
+	wf := model.Workflow{
+		ID:   "wf",
+		Name: "Demo",
+		Nodes: []model.Node{
+			{ID: "a", Type: "echo", Config: map[string]any{"label": "x"}},
+			{ID: "b", Type: "echo"},
+		},
+		Edges: []model.Edge{{FromNode: "a", FromPort: model.PortMain, ToNode: "b", ToPort: model.PortMain}},
+	}
+
+	w, v1, err := repo.EnsureVersion(ctx, string(wf.ID), wf, json.RawMessage(`{"v":1}`), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, same, err := repo.EnsureVersion(ctx, string(wf.ID), wf, json.RawMessage(`{"v":1}`), "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.ID != v1.ID {
+		t.Fatalf("unchanged config created version %d", same.Number)
+	}
+	_, v2, err := repo.EnsureVersion(ctx, string(wf.ID), wf, json.RawMessage(`{"v":2}`), "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Number != 1 || v2.Number != 2 || v1.ConfigHash == v2.ConfigHash {
+		t.Fatalf("versions: %+v %+v", v1, v2)
+	}
+	versions, err := repo.ListVersions(ctx, w.ID)
+	if err != nil || len(versions) != 2 || versions[0].ID != v2.ID {
+		t.Fatalf("list versions: %v %+v", err, versions)
+	}
+	got, err := repo.GetWorkflow(ctx, w.ID)
+	if err != nil || got.DefaultVersionID != v2.ID {
+		t.Fatalf("default version: %v %+v", err, got)
+	}
+
+	nodes, err := repo.NodeIDs(ctx, v2.ID)
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("nodes: %v %v", err, nodes)
+	}
+	run, err := repo.CreateRun(ctx, Run{WorkflowID: w.ID, VersionID: v2.ID, Trigger: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := NewEventRecorder(repo, nil)
+	events.Track("exec-1", run.ID, nodes)
+	_ = events.Emit(ctx, "node_started", map[string]any{"exec": "exec-1", "node": model.ID("a")})
+	_ = events.Emit(ctx, "node_started", map[string]any{"exec": "other", "node": model.ID("a")})
+	if err := repo.FinishRun(ctx, run.ID, RunSucceeded, map[string]any{"nodes": 2}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err = repo.GetRun(ctx, run.ID)
+	if err != nil || run.Status != RunSucceeded || run.FinishedAt.IsZero() {
+		t.Fatalf("run: %v %+v", err, run)
+	}
+	evs, err := repo.ListRunEvents(ctx, run.ID)
+	if err != nil || len(evs) != 1 || evs[0].NodeID != nodes["a"] || evs[0].Step != "a" {
+		t.Fatalf("events: %v %+v", err, evs)
+	}
+
+	if err := repo.DeleteWorkflow(ctx, w.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetRun(ctx, run.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("run survived workflow delete: %v", err)
+	}
+}
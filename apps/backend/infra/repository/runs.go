@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RunStatus matches the run_status enum
+type RunStatus string
+
+const (
+	RunPending   RunStatus = "pending"
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// Run is a row of workflow_runs
+type Run struct {
+	ID         string          `json:"id"`
+	WorkflowID string          `json:"workflow_id"`
+	VersionID  string          `json:"version_id,omitempty"`
+	Trigger    string          `json:"trigger,omitempty"`
+	Status     RunStatus       `json:"status"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at,omitempty"`
+	Metrics    json.RawMessage `json:"metrics,omitempty"`
+	Context    json.RawMessage `json:"context,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// RunEvent is a row of workflow_run_events. Step is the node key the event
+// concerns, NodeID the matching workflow_nodes row when known.
+type RunEvent struct {
+	ID         string          `json:"id"`
+	RunID      string          `json:"run_id"`
+	NodeID     string          `json:"node_id,omitempty"`
+	Step       string          `json:"step,omitempty"`
+	Type       string          `json:"event_type"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+const runColumns = `id, workflow_id, version_id, trigger, status, started_at, finished_at, metrics, context, error`
+
+func scanRun(row interface{ Scan(...any) error }) (Run, error) {
+	var (
+		run                                      Run
+		version, trigger, metrics, rctx, errText sql.NullString
+		finished                                 sql.NullTime
+	)
+	if err := row.Scan(&run.ID, &run.WorkflowID, &version, &trigger, &run.Status, &run.StartedAt, &finished, &metrics, &rctx, &errText); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Run{}, ErrNotFound
+		}
+		return Run{}, err
+	}
+	run.VersionID, run.Trigger, run.Error = version.String, trigger.String, errText.String
+	run.FinishedAt = finished.Time
+	if metrics.Valid {
+		run.Metrics = json.RawMessage(metrics.String)
+	}
+	if rctx.Valid {
+		run.Context = json.RawMessage(rctx.String)
+	}
+	return run, nil
+}
+
+// CreateRun inserts a run; ID and start time are filled in when empty and
+// the status defaults to running
+func (r *Repository) CreateRun(ctx context.Context, run Run) (Run, error) {
+	if run.ID == "" {
+		run.ID = newID()
+	}
+	if run.Status == "" {
+		run.Status = RunRunning
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = now()
+	}
+	_, err := r.exec(ctx, `INSERT INTO workflow_runs (id, workflow_id, version_id, trigger, status, started_at, context) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.WorkflowID, nullString(run.VersionID), nullString(run.Trigger), string(run.Status), run.StartedAt.UTC(), nullJSON(run.Context))
+	if err != nil {
+		return Run{}, err
+	}
+	return run, nil
+}
+
+// FinishRun records the final status, metrics and error of a run
+func (r *Repository) FinishRun(ctx context.Context, id string, status RunStatus, metrics map[string]any, errMsg string) error {
+	var m []byte
+	if metrics != nil {
+		var err error
+		if m, err = json.Marshal(metrics); err != nil {
+			return err
+		}
+	}
+	res, err := r.exec(ctx, `UPDATE workflow_runs SET status = ?, finished_at = ?, metrics = ?, error = ? WHERE id = ?`,
+		string(status), now(), nullJSON(m), nullString(errMsg), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetRun loads a run by ID
+func (r *Repository) GetRun(ctx context.Context, id string) (Run, error) {
+	return scanRun(r.queryRow(ctx, `SELECT `+runColumns+` FROM workflow_runs WHERE id = ?`, id))
+}
+
+// ListRuns returns a workflow's runs, newest first; limit <= 0 means all
+func (r *Repository) ListRuns(ctx context.Context, workflowID string, limit int) ([]Run, error) {
+	q := `SELECT ` + runColumns + ` FROM workflow_runs WHERE workflow_id = ? ORDER BY started_at DESC`
+	args := []any{workflowID}
+	if limit > 0 {
+		q += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := r.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+// AppendRunEvent inserts an event for a run
+func (r *Repository) AppendRunEvent(ctx context.Context, ev RunEvent) (RunEvent, error) {
+	ev.ID = newID()
+	if ev.OccurredAt.IsZero() {
+		ev.OccurredAt = now()
+	}
+	_, err := r.exec(ctx, `INSERT INTO workflow_run_events (id, run_id, node_id, step, event_type, payload, occurred_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		ev.ID, ev.RunID, nullString(ev.NodeID), nullString(ev.Step), ev.Type, nullJSON(ev.Payload), ev.OccurredAt.UTC())
+	if err != nil {
+		return RunEvent{}, err
+	}
+	return ev, nil
+}
+
+// ListRunEvents returns the events of a run in the order they occurred
+func (r *Repository) ListRunEvents(ctx context.Context, runID string) ([]RunEvent, error) {
+	rows, err := r.query(ctx, `SELECT id, run_id, node_id, step, event_type, payload, occurred_at FROM workflow_run_events WHERE run_id = ? ORDER BY occurred_at, id`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RunEvent{}
+	for rows.Next() {
+		var (
+			ev                  RunEvent
+			node, step, payload sql.NullString
+		)
+		if err := rows.Scan(&ev.ID, &ev.RunID, &node, &step, &ev.Type, &payload, &ev.OccurredAt); err != nil {
+			return nil, err
+		}
+		ev.NodeID, ev.Step = node.String, step.String
+		if payload.Valid {
+			ev.Payload = json.RawMessage(payload.String)
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// Workflow states, matching the workflow_state enum
+const (
+	StateDraft    = "draft"
+	StateActive   = "active"
+	StateArchived = "archived"
+)
+
+// Workflow is a row of the workflows table. Slug is the workflow ID used in
+// definitions (model.Workflow.ID); ID is the database key.
+type Workflow struct {
+	ID               string    `json:"id"`
+	Slug             string    `json:"slug"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description,omitempty"`
+	State            string    `json:"state"`
+	DefaultVersionID string    `json:"default_version_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Version is an immutable snapshot of a workflow definition
+type Version struct {
+	ID         string          `json:"id"`
+	WorkflowID string          `json:"workflow_id"`
+	Number     int             `json:"version"`
+	Config     json.RawMessage `json:"config,omitempty"`
+	ConfigHash string          `json:"config_hash"` // hex sha256 of Config
+	Changelog  string          `json:"changelog,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// HashConfig returns the hex digest stored as a version's config hash
+func HashConfig(config []byte) string {
+	sum := sha256.Sum256(config)
+	return hex.EncodeToString(sum[:])
+}
+
+const workflowColumns = `id, slug, name, description, state, default_version_id, created_at, updated_at`
+
+func scanWorkflow(row interface{ Scan(...any) error }) (Workflow, error) {
+	var (
+		w                   Workflow
+		desc, state, defVer sql.NullString
+	)
+	if err := row.Scan(&w.ID, &w.Slug, &w.Name, &desc, &state, &defVer, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Workflow{}, ErrNotFound
+		}
+		return Workflow{}, err
+	}
+	w.Description, w.State, w.DefaultVersionID = desc.String, state.String, defVer.String
+	return w, nil
+}
+
+// CreateWorkflow inserts a workflow; ID, timestamps and state are filled in
+func (r *Repository) CreateWorkflow(ctx context.Context, w Workflow) (Workflow, error) {
+	if w.Slug == "" {
+		return Workflow{}, fmt.Errorf("workflow slug is required")
+	}
+	w.ID = newID()
+	if w.State == "" {
+		w.State = StateDraft
+	}
+	w.CreatedAt = now()
+	w.UpdatedAt = w.CreatedAt
+	_, err := r.exec(ctx, `INSERT INTO workflows (id, slug, name, description, state, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.Slug, w.Name, nullString(w.Description), w.State, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return Workflow{}, err
+	}
+	return w, nil
+}
+
+// GetWorkflow loads a workflow by database ID
+func (r *Repository) GetWorkflow(ctx context.Context, id string) (Workflow, error) {
+	return scanWorkflow(r.queryRow(ctx, `SELECT `+workflowColumns+` FROM workflows WHERE id = ?`, id))
+}
+
+// GetWorkflowBySlug loads a workflow by its definition ID
+func (r *Repository) GetWorkflowBySlug(ctx context.Context, slug string) (Workflow, error) {
+	return scanWorkflow(r.queryRow(ctx, `SELECT `+workflowColumns+` FROM workflows WHERE slug = ?`, slug))
+}
+
+// ListWorkflows returns all workflows, most recently updated first
+func (r *Repository) ListWorkflows(ctx context.Context) ([]Workflow, error) {
+	rows, err := r.query(ctx, `SELECT `+workflowColumns+` FROM workflows ORDER BY updated_at DESC, slug`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Workflow{}
+	for rows.Next() {
+		w, err := scanWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// UpdateWorkflow saves name, description and state
+func (r *Repository) UpdateWorkflow(ctx context.Context, w Workflow) (Workflow, error) {
+	w.UpdatedAt = now()
+	res, err := r.exec(ctx, `UPDATE workflows SET name = ?, description = ?, state = ?, updated_at = ? WHERE id = ?`,
+		w.Name, nullString(w.Description), w.State, w.UpdatedAt, w.ID)
+	if err != nil {
+		return Workflow{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Workflow{}, ErrNotFound
+	}
+	return r.GetWorkflow(ctx, w.ID)
+}
+
+// DeleteWorkflow removes a workflow with its versions and runs
+func (r *Repository) DeleteWorkflow(ctx context.Context, id string) error {
+	res, err := r.exec(ctx, `DELETE FROM workflows WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const versionColumns = `id, workflow_id, version_number, config, config_hash, changelog, created_at`
+
+func scanVersion(row interface{ Scan(...any) error }) (Version, error) {
+	var (
+		v         Version
+		config    string
+		hash      []byte
+		changelog sql.NullString
+	)
+	if err := row.Scan(&v.ID, &v.WorkflowID, &v.Number, &config, &hash, &changelog, &v.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Version{}, ErrNotFound
+		}
+		return Version{}, err
+	}
+	v.Config = json.RawMessage(config)
+	v.ConfigHash = hex.EncodeToString(hash)
+	v.Changelog = changelog.String
+	return v, nil
+}
+
+// CreateVersion stores config as the next version of a workflow, along with
+// the nodes and edges of wf, and makes it the workflow's default version.
+func (r *Repository) CreateVersion(ctx context.Context, workflowID string, wf model.Workflow, config json.RawMessage, changelog string) (Version, error) {
+	sum := sha256.Sum256(config)
+	v := Version{
+		ID:         newID(),
+		WorkflowID: workflowID,
+		Config:     config,
+		ConfigHash: hex.EncodeToString(sum[:]),
+		Changelog:  changelog,
+		CreatedAt:  now(),
+	}
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var last sql.NullInt64
+		if err := tx.QueryRowContext(ctx, r.dialect.Rebind(`SELECT MAX(version_number) FROM workflow_versions WHERE workflow_id = ?`), workflowID).Scan(&last); err != nil {
+			return err
+		}
+		v.Number = int(last.Int64) + 1
+		if _, err := tx.ExecContext(ctx, r.dialect.Rebind(`INSERT INTO workflow_versions (id, workflow_id, version_number, config, config_hash, changelog, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			v.ID, workflowID, v.Number, string(config), sum[:], nullString(changelog), v.CreatedAt); err != nil {
+			return err
+		}
+		if err := r.insertGraph(ctx, tx, v.ID, wf, v.CreatedAt); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, r.dialect.Rebind(`UPDATE workflows SET default_version_id = ?, updated_at = ? WHERE id = ?`), v.ID, v.CreatedAt, workflowID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return Version{}, err
+	}
+	return v, nil
+}
+
+// insertGraph writes the nodes and edges of a version
+func (r *Repository) insertGraph(ctx context.Context, tx *sql.Tx, versionID string, wf model.Workflow, at time.Time) error {
+	nodeIDs := make(map[model.ID]string, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		spec, err := json.Marshal(map[string]any{
+			"type":        n.Type,
+			"config":      n.Config,
+			"concurrency": n.Concurrency,
+			"timeout_ms":  n.Timeout.Milliseconds(),
+			"credentials": n.Credentials,
+		})
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		var position []byte
+		if p, ok := n.Config["_n8n_position"]; ok {
+			position, _ = json.Marshal(p)
+		}
+		id := newID()
+		if _, err := tx.ExecContext(ctx, r.dialect.Rebind(`INSERT INTO workflow_nodes (id, version_id, node_key, node_type, name, spec, position, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			id, versionID, string(n.ID), n.Type, nullString(n.Name), string(spec), nullJSON(position), at); err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		nodeIDs[n.ID] = id
+	}
+	seen := map[string]bool{}
+	for _, e := range wf.Edges {
+		from, ok1 := nodeIDs[e.FromNode]
+		to, ok2 := nodeIDs[e.ToNode]
+		if !ok1 || !ok2 {
+			continue
+		}
+		cond, _ := json.Marshal(map[string]string{"from_port": string(e.FromPort), "to_port": string(e.ToPort)})
+		key := from + "|" + to + "|" + string(cond)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, err := tx.ExecContext(ctx, r.dialect.Rebind(`INSERT INTO workflow_edges (id, version_id, source_node_id, target_node_id, condition, created_at) VALUES (?, ?, ?, ?, ?, ?)`),
+			newID(), versionID, from, to, string(cond), at); err != nil {
+			return fmt.Errorf("edge %s->%s: %w", e.FromNode, e.ToNode, err)
+		}
+	}
+	return nil
+}
+
+// GetVersion loads a version by ID
+func (r *Repository) GetVersion(ctx context.Context, id string) (Version, error) {
+	return scanVersion(r.queryRow(ctx, `SELECT `+versionColumns+` FROM workflow_versions WHERE id = ?`, id))
+}
+
+// GetVersionByNumber loads version n of a workflow
+func (r *Repository) GetVersionByNumber(ctx context.Context, workflowID string, n int) (Version, error) {
+	return scanVersion(r.queryRow(ctx, `SELECT `+versionColumns+` FROM workflow_versions WHERE workflow_id = ? AND version_number = ?`, workflowID, n))
+}
+
+// LatestVersion loads the highest numbered version of a workflow
+func (r *Repository) LatestVersion(ctx context.Context, workflowID string) (Version, error) {
+	return scanVersion(r.queryRow(ctx, `SELECT `+versionColumns+` FROM workflow_versions WHERE workflow_id = ? ORDER BY version_number DESC LIMIT 1`, workflowID))
+}
+
+// ListVersions returns a workflow's versions, newest first, without configs
+func (r *Repository) ListVersions(ctx context.Context, workflowID string) ([]Version, error) {
+	rows, err := r.query(ctx, `SELECT `+versionColumns+` FROM workflow_versions WHERE workflow_id = ? ORDER BY version_number DESC`, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Version{}
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		v.Config = nil
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// NodeIDs maps the node keys of a version to their database IDs
+func (r *Repository) NodeIDs(ctx context.Context, versionID string) (map[string]string, error) {
+	rows, err := r.query(ctx, `SELECT node_key, id FROM workflow_nodes WHERE version_id = ?`, versionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var key, id string
+		if err := rows.Scan(&key, &id); err != nil {
+			return nil, err
+		}
+		out[key] = id
+	}
+	return out, rows.Err()
+}
+
+// EnsureVersion returns the workflow with slug and a version whose config
+// matches, creating either when missing. It lets ad-hoc executions be
+// recorded against the definition they actually ran.
+func (r *Repository) EnsureVersion(ctx context.Context, slug string, wf model.Workflow, config json.RawMessage, changelog string) (Workflow, Version, error) {
+	w, err := r.GetWorkflowBySlug(ctx, slug)
+	if errors.Is(err, ErrNotFound) {
+		w, err = r.CreateWorkflow(ctx, Workflow{Slug: slug, Name: wf.Name, State: StateActive})
+	}
+	if err != nil {
+		return Workflow{}, Version{}, err
+	}
+	latest, err := r.LatestVersion(ctx, w.ID)
+	switch {
+	case err == nil && latest.ConfigHash == HashConfig(config):
+		return w, latest, nil
+	case err != nil && !errors.Is(err, ErrNotFound):
+		return Workflow{}, Version{}, err
+	}
+	v, err := r.CreateVersion(ctx, w.ID, wf, config, changelog)
+	if err != nil {
+		return Workflow{}, Version{}, err
+	}
+	w.DefaultVersionID = v.ID
+	return w, v, nil
+}
@@ -0,0 +1,290 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// SchedulesSetting lists the schedules that enqueue executions into an
+// instance of the workflow
+const SchedulesSetting = "schedules"
+
+// Schedule is one entry of a workflow's schedules setting. Exactly one of
+// Cron and Every is set.
+type Schedule struct {
+	Name     string `json:"name,omitempty"`     // defaults to the cron expression or interval
+	Cron     string `json:"cron,omitempty"`     // five fields or a macro like @hourly
+	Every    string `json:"every,omitempty"`    // Go duration, e.g. "15m"
+	Timezone string `json:"timezone,omitempty"` // IANA name for cron schedules, default UTC
+	Jitter   string `json:"jitter,omitempty"`   // random delay up to this duration
+	// SkipIfRunning drops a fire while the instance is executing or has
+	// queued work (default true)
+	SkipIfRunning *bool                    `json:"skip_if_running,omitempty"`
+	Data          map[model.ID]model.Items `json:"data,omitempty"` // inputs, default one item per root node
+}
+
+// ScheduleStatus is a schedule's state as shown on its instance
+type ScheduleStatus struct {
+	Name          string    `json:"name"`
+	Cron          string    `json:"cron,omitempty"`
+	Every         string    `json:"every,omitempty"`
+	Timezone      string    `json:"timezone,omitempty"`
+	SkipIfRunning bool      `json:"skip_if_running"`
+	LastFire      time.Time `json:"last_fire,omitempty"`
+	NextFire      time.Time `json:"next_fire"`
+	Fired         int       `json:"fired"`
+	Skipped       int       `json:"skipped"`
+	LastSkipped   time.Time `json:"last_skipped,omitempty"`
+}
+
+// schedule is a parsed Schedule with its status; status is guarded by the
+// instance's statsMu
+type schedule struct {
+	spec   Schedule
+	cron   *cronSpec
+	every  time.Duration
+	jitter time.Duration
+	loc    *time.Location
+	status ScheduleStatus
+}
+
+// parseSchedules reads and checks the schedules setting of wf
+func parseSchedules(wf model.Workflow) ([]*schedule, error) {
+	raw, ok := wf.Settings[SchedulesSetting]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var specs []Schedule
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, fmt.Errorf("%s: %w", SchedulesSetting, err)
+	}
+	out := make([]*schedule, 0, len(specs))
+	names := map[string]bool{}
+	for i, spec := range specs {
+		s, err := newSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %d: %w", i, err)
+		}
+		if names[s.status.Name] {
+			return nil, fmt.Errorf("schedule %d: duplicate name %q", i, s.status.Name)
+		}
+		names[s.status.Name] = true
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func newSchedule(spec Schedule) (*schedule, error) {
+	s := &schedule{spec: spec, loc: time.UTC}
+	var err error
+	switch {
+	case (spec.Cron == "") == (spec.Every == ""):
+		return nil, errors.New("set one of cron or every")
+	case spec.Cron != "":
+		if s.cron, err = parseCron(spec.Cron); err != nil {
+			return nil, err
+		}
+	default:
+		if s.every, err = time.ParseDuration(spec.Every); err != nil {
+			return nil, fmt.Errorf("every: %w", err)
+		}
+		if s.every <= 0 {
+			return nil, errors.New("every must be positive")
+		}
+	}
+	if spec.Timezone != "" {
+		if s.loc, err = time.LoadLocation(spec.Timezone); err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+	}
+	if spec.Jitter != "" {
+		if s.jitter, err = time.ParseDuration(spec.Jitter); err != nil || s.jitter < 0 {
+			return nil, fmt.Errorf("jitter: invalid duration %q", spec.Jitter)
+		}
+	}
+	name := spec.Name
+	if name == "" {
+		name = spec.Cron + spec.Every
+	}
+	s.status = ScheduleStatus{
+		Name:          name,
+		Cron:          spec.Cron,
+		Every:         spec.Every,
+		Timezone:      spec.Timezone,
+		SkipIfRunning: spec.SkipIfRunning == nil || *spec.SkipIfRunning,
+	}
+	return s, nil
+}
+
+// nextFire returns when s fires next after t, jitter included
+func (s *schedule) nextFire(t time.Time) time.Time {
+	var next time.Time
+	if s.cron != nil {
+		next = s.cron.next(t.In(s.loc))
+	} else {
+		next = t.Add(s.every)
+	}
+	if s.jitter > 0 && !next.IsZero() {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	return next
+}
+
+// inputs are the schedule's data, or one item describing the fire for
+// every root node
+func (s *schedule) inputs(wf model.Workflow, at time.Time) map[model.ID]model.Items {
+	if len(s.spec.Data) > 0 {
+		return cloneItemsMap(s.spec.Data)
+	}
+	inputs := map[model.ID]model.Items{}
+	for _, id := range engine.Roots(wf) {
+		inputs[id] = model.Items{{"schedule": s.status.Name, "scheduled_at": at.UTC().Format(time.RFC3339)}}
+	}
+	return inputs
+}
+
+// scheduleTimes is what survives a restart, per schedule name
+type scheduleTimes struct {
+	LastFire time.Time `json:"last_fire,omitempty"`
+	NextFire time.Time `json:"next_fire,omitempty"`
+}
+
+// scheduleFile is where the fire times of an instance's workflow are kept:
+// keyed by the stored workflow or workflow file, so a new instance of the
+// same workflow picks them up
+func scheduleFile(inst *Instance) string {
+	return filepath.Join(SchedulesDir(), workflowKey(inst)+".json")
+}
+
+func loadScheduleTimes(path string) map[string]scheduleTimes {
+	times := map[string]scheduleTimes{}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &times)
+	}
+	return times
+}
+
+// saveSchedules persists the fire times of inst's schedules
+func saveSchedules(inst *Instance) error {
+	inst.statsMu.Lock()
+	times := make(map[string]scheduleTimes, len(inst.schedules))
+	for _, s := range inst.schedules {
+		times[s.status.Name] = scheduleTimes{LastFire: s.status.LastFire, NextFire: s.status.NextFire}
+	}
+	inst.statsMu.Unlock()
+	b, err := json.Marshal(times)
+	if err != nil {
+		return err
+	}
+	if err := ensureDir(SchedulesDir()); err != nil {
+		return err
+	}
+	return writeFileAtomic(scheduleFile(inst), b)
+}
+
+// startSchedules restores the fire times of inst's schedules and runs each
+// until ctx ends. Fires missed while the server was down are not caught
+// up on, except that an overdue interval fires once right away.
+func (m *InstanceManager) startSchedules(ctx context.Context, inst *Instance) {
+	if len(inst.schedules) == 0 {
+		return
+	}
+	now := time.Now()
+	saved := loadScheduleTimes(scheduleFile(inst))
+	inst.statsMu.Lock()
+	for _, s := range inst.schedules {
+		s.status.LastFire = saved[s.status.Name].LastFire
+		switch {
+		case s.cron == nil && !s.status.LastFire.IsZero():
+			s.status.NextFire = s.nextFire(s.status.LastFire)
+			if s.status.NextFire.Before(now) {
+				s.status.NextFire = now
+			}
+		default:
+			s.status.NextFire = s.nextFire(now)
+		}
+	}
+	inst.statsMu.Unlock()
+	if err := saveSchedules(inst); err != nil {
+		inst.logf("schedules not saved: %v", err)
+	}
+	for _, s := range inst.schedules {
+		go m.runSchedule(ctx, inst, s)
+	}
+}
+
+func (m *InstanceManager) runSchedule(ctx context.Context, inst *Instance, s *schedule) {
+	for {
+		inst.statsMu.Lock()
+		at := s.status.NextFire
+		inst.statsMu.Unlock()
+		if at.IsZero() {
+			inst.logf("schedule %s never fires again", s.status.Name)
+			return
+		}
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		m.fireSchedule(ctx, inst, s, at)
+		if err := saveSchedules(inst); err != nil {
+			inst.logf("schedules not saved: %v", err)
+		}
+	}
+}
+
+// fireSchedule enqueues the schedule's inputs, or skips the fire when the
+// instance is busy and the schedule says so, and plans the next fire
+func (m *InstanceManager) fireSchedule(ctx context.Context, inst *Instance, s *schedule, at time.Time) {
+	inst.statsMu.Lock()
+	busy := inst.active.IsExecuting || inst.q.Len() > 0
+	wf := inst.Workflow
+	inst.statsMu.Unlock()
+
+	reason := ""
+	if busy && s.status.SkipIfRunning {
+		reason = "instance busy"
+	} else {
+		if err := m.enqueue(ctx, inst, newExecID(), s.inputs(wf, at)); err != nil {
+			reason = err.Error()
+		}
+	}
+
+	now := time.Now()
+	inst.statsMu.Lock()
+	if reason == "" {
+		s.status.Fired++
+		s.status.LastFire = at
+	} else {
+		s.status.Skipped++
+		s.status.LastSkipped = at
+	}
+	s.status.NextFire = s.nextFire(now)
+	inst.statsMu.Unlock()
+
+	fields := map[string]any{"instance": inst.ID, "schedule": s.status.Name, "at": at.UTC()}
+	if reason != "" {
+		fields["reason"] = reason
+		inst.logf("schedule %s skipped: %s", s.status.Name, reason)
+		m.deps.Bus.Emit(ctx, "schedule_skipped", fields)
+		return
+	}
+	inst.logf("schedule %s fired", s.status.Name)
+	m.deps.Bus.Emit(ctx, "schedule_fired", fields)
+}
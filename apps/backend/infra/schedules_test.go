@@ -0,0 +1,93 @@
+package infra
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+)
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	cases := []struct {
+		expr       string
+		from, want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 3, 2, 10, 7, 30, 0, time.UTC), time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, 3, 6, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 12, 15, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{"0 0 13 * fri", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+		// 02:30 doesn't exist on the day DST starts
+		{"30 2 * * *", time.Date(2026, 3, 28, 12, 0, 0, 0, berlin), time.Date(2026, 3, 30, 2, 30, 0, 0, berlin)},
+	}
+	for _, c := range cases {
+		spec, err := parseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if got := spec.next(c.from); !got.Equal(c.want) {
+			t.Errorf("%s after %v: got %v, want %v", c.expr, c.from, got, c.want)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "0 0 * foo *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestIntervalScheduleSkipsWhileRunning(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	writeWorkflowFile(t, "tick.json", n8n.N8nWorkflow{
+		ID:       "tick",
+		Nodes:    []n8n.N8nNode{{ID: "wait", Name: "Wait", Type: "test:block"}},
+		Settings: map[string]interface{}{"schedules": []any{map[string]any{"name": "tick", "every": "20ms"}}},
+	})
+	path := filepath.Join(WorkflowsDir(), "tick.json")
+	m := NewInstanceManager()
+	inst, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	var st ScheduleStatus
+	for time.Now().Before(deadline) {
+		st = inst.Snapshot().Schedules[0]
+		if st.Skipped >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the first fire blocks the instance, the following ones are skipped
+	if st.Fired != 1 || st.Skipped < 2 || st.LastFire.IsZero() || !st.NextFire.After(st.LastFire) {
+		t.Fatalf("unexpected schedule status %+v", st)
+	}
+	_ = m.Stop(inst.ID)
+	// the blocked execution is recorded as cancelled once the instance stops
+	for time.Now().Before(deadline) {
+		if recs, _ := m.History().List(HistoryQuery{Status: ExecutionCancelled}); len(recs) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	saved := loadScheduleTimes(scheduleFile(inst))
+	if !saved["tick"].LastFire.Equal(st.LastFire) {
+		t.Fatalf("fire times not persisted: %+v", saved)
+	}
+
+	writeWorkflowFile(t, "bad.json", n8n.N8nWorkflow{
+		ID:       "bad",
+		Nodes:    []n8n.N8nNode{{ID: "a", Name: "A", Type: "echo"}},
+		Settings: map[string]interface{}{"schedules": []any{map[string]any{"cron": "@hourly", "every": "1h"}}},
+	})
+	if _, err := m.CreateFromWorkflowPath(filepath.Join(WorkflowsDir(), "bad.json")); err == nil {
+		t.Fatal("expected a schedule with both cron and every to be rejected")
+	}
+}
@@ -3,6 +3,9 @@ package infra
 import (
 	"context"
 	"sync"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
 )
 
 type memState struct {
@@ -12,23 +15,25 @@ type memState struct {
 
 func NewMemState() *memState { return &memState{m: map[string]map[string]map[string]any{}} }
 
-func (s *memState) SaveNodeState(ctx context.Context, execID, nodeID string, state map[string]any) error {
+func (s *memState) SaveNodeState(ctx context.Context, execID string, nodeID model.ID, state map[string]any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.m[execID]; !ok {
 		s.m[execID] = map[string]map[string]any{}
 	}
-	s.m[execID][nodeID] = state
+	s.m[execID][string(nodeID)] = state
 	return nil
 }
 
-func (s *memState) LoadNodeState(ctx context.Context, execID, nodeID string) (map[string]any, error) {
+func (s *memState) LoadNodeState(ctx context.Context, execID string, nodeID model.ID) (map[string]any, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if e, ok := s.m[execID]; ok {
-		if st, ok := e[nodeID]; ok {
+		if st, ok := e[string(nodeID)]; ok {
 			return st, nil
 		}
 	}
 	return map[string]any{}, nil
 }
+
+var _ plugin.StateStore = (*memState)(nil)
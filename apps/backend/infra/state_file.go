@@ -0,0 +1,192 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// DefaultStateTTL is how long an execution's state is kept after its last write
+const DefaultStateTTL = 7 * 24 * time.Hour
+
+// FileState persists node state as JSON files under
+// <dir>/<execID>/<nodeID>.json. Every write goes to a temp file that is
+// fsync'd and renamed into place, so readers never see a partial state.
+type FileState struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewFileState returns a state store rooted at dir; ttl <= 0 disables cleanup.
+func NewFileState(dir string, ttl time.Duration) *FileState {
+	return &FileState{dir: dir, ttl: ttl}
+}
+
+// NewDefaultFileState returns a store under StateDir() using RIV_STATE_TTL
+// (a Go duration) or DefaultStateTTL.
+func NewDefaultFileState() *FileState {
+	ttl := DefaultStateTTL
+	if v := os.Getenv("RIV_STATE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			ttl = d
+		}
+	}
+	return NewFileState(StateDir(), ttl)
+}
+
+// errBadExecID is returned for execution IDs that would leave the state
+// directory; escaping leaves "." and ".." as they are
+var errBadExecID = errors.New("invalid execution ID")
+
+func (s *FileState) execDir(execID string) (string, error) {
+	if execID == "." || execID == ".." {
+		return "", errBadExecID
+	}
+	return filepath.Join(s.dir, url.PathEscape(execID)), nil
+}
+
+func (s *FileState) path(execID string, nodeID model.ID) (string, error) {
+	dir, err := s.execDir(execID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, url.PathEscape(string(nodeID))+".json"), nil
+}
+
+func (s *FileState) SaveNodeState(ctx context.Context, execID string, nodeID model.ID, state map[string]any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path, err := s.path(execID, nodeID)
+	if err != nil {
+		return err
+	}
+	if err := ensureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+func (s *FileState) LoadNodeState(ctx context.Context, execID string, nodeID model.ID) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := s.path(execID, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]any{}, nil
+		}
+		return nil, err
+	}
+	state := map[string]any{}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Cleanup removes executions whose newest state file is older than the TTL
+// and returns how many were removed.
+func (s *FileState) Cleanup(now time.Time) (int, error) {
+	if s.ttl <= 0 {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, e.Name())
+		if newestModTime(dir).Add(s.ttl).After(now) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// StartJanitor runs Cleanup every interval until ctx is done.
+func (s *FileState) StartJanitor(ctx context.Context, every time.Duration) {
+	if s.ttl <= 0 || every <= 0 {
+		return
+	}
+	go func() {
+		_, _ = s.Cleanup(time.Now())
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				_, _ = s.Cleanup(now)
+			}
+		}
+	}()
+}
+
+func newestModTime(dir string) time.Time {
+	var newest time.Time
+	if fi, err := os.Stat(dir); err == nil {
+		newest = fi.ModTime()
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return newest
+	}
+	for _, e := range entries {
+		if fi, err := e.Info(); err == nil && fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	return newest
+}
+
+// writeFileAtomic writes data to a temp file in the target directory, syncs
+// it and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var _ plugin.StateStore = (*FileState)(nil)
@@ -0,0 +1,70 @@
+package infra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStateRoundTripAndCleanup(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileState(dir, time.Hour)
+	ctx := context.Background()
+
+	if err := s.SaveNodeState(ctx, "exec-1", "_checkpoint/n1", map[string]any{"count": 3}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	st, err := s.LoadNodeState(ctx, "exec-1", "_checkpoint/n1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if st["count"] != float64(3) {
+		t.Fatalf("unexpected state: %v", st)
+	}
+	if st, err := s.LoadNodeState(ctx, "exec-1", "missing"); err != nil || len(st) != 0 {
+		t.Fatalf("expected empty state for missing node, got %v, %v", st, err)
+	}
+
+	// no temp files left behind
+	matches, _ := filepath.Glob(filepath.Join(dir, "exec-1", ".*"))
+	if len(matches) != 0 {
+		t.Fatalf("unexpected temp files: %v", matches)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	execDir := filepath.Join(dir, "exec-1")
+	entries, _ := os.ReadDir(execDir)
+	for _, e := range entries {
+		_ = os.Chtimes(filepath.Join(execDir, e.Name()), old, old)
+	}
+	_ = os.Chtimes(execDir, old, old)
+	if err := s.SaveNodeState(ctx, "exec-2", "n1", map[string]any{}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	removed, err := s.Cleanup(time.Now())
+	if err != nil || removed != 1 {
+		t.Fatalf("expected one expired execution removed, got %d, %v", removed, err)
+	}
+	if _, err := os.Stat(execDir); !os.IsNotExist(err) {
+		t.Fatalf("expired execution still present")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "exec-2")); err != nil {
+		t.Fatalf("fresh execution removed: %v", err)
+	}
+}
+
+func TestFileStateRejectsDotExecIDs(t *testing.T) {
+	s := NewFileState(t.TempDir(), time.Hour)
+	ctx := context.Background()
+	for _, id := range []string{".", ".."} {
+		if err := s.SaveNodeState(ctx, id, "n1", map[string]any{}); err == nil {
+			t.Fatalf("expected %q to be rejected on save", id)
+		}
+		if _, err := s.LoadNodeState(ctx, id, "n1"); err == nil {
+			t.Fatalf("expected %q to be rejected on load", id)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// DefaultMaxWorkflowDepth bounds how deeply exec:workflow calls may nest
+const DefaultMaxWorkflowDepth = 8
+
+// ErrWorkflowDepth is returned when a sub-workflow would exceed its nesting limit
+var ErrWorkflowDepth = errors.New("sub-workflow depth limit exceeded")
+
+type depthKey struct{}
+
+// workflowDepth is how many sub-workflow levels ctx is nested in
+func workflowDepth(ctx context.Context) int {
+	d, _ := ctx.Value(depthKey{}).(int)
+	return d
+}
+
+// RunWorkflow implements plugin.WorkflowRunner. The child is recorded in
+// history under its own execution ID, linked to the calling execution,
+// and is cancelled with it.
+func (m *InstanceManager) RunWorkflow(ctx context.Context, run plugin.WorkflowRun) (string, model.Items, error) {
+	limit := run.MaxDepth
+	if limit <= 0 {
+		limit = DefaultMaxWorkflowDepth
+	}
+	depth := workflowDepth(ctx) + 1
+	if depth > limit {
+		return "", nil, fmt.Errorf("%w (%d)", ErrWorkflowDepth, limit)
+	}
+	wf, versionID, err := m.LoadWorkflow(ctx, run.Ref)
+	if err != nil {
+		return "", nil, err
+	}
+	entry, err := endpointNode(wf, run.Entry, engine.Roots(wf), "entry")
+	if err != nil {
+		return "", nil, err
+	}
+	output, err := endpointNode(wf, run.Output, sinks(wf), "output")
+	if err != nil {
+		return "", nil, err
+	}
+
+	parent := plugin.ExecutionID(ctx)
+	opts := execOptions{versionID: versionID, parent: parent}
+	if p, ok := m.inflight(parent); ok {
+		p.mu.Lock()
+		opts.instanceID = p.start.InstanceID
+		p.mu.Unlock()
+	}
+	execID := newExecID()
+	m.deps.Bus.Emit(ctx, "subworkflow_started", map[string]any{"exec": parent, "node": run.Node, "child": execID, "workflow": wf.ID})
+
+	ctx = context.WithValue(ctx, depthKey{}, depth)
+	rec, err := m.execute(ctx, m.newEngine(), execID, wf, map[model.ID]model.Items{entry: run.Items}, opts)
+	if err != nil {
+		return execID, nil, fmt.Errorf("sub-workflow %s (%s): %w", run.Ref, execID, err)
+	}
+	return execID, rec.Result[output], nil
+}
+
+// endpointNode checks the configured entry or output node, or picks the
+// only candidate when none is configured
+func endpointNode(wf model.Workflow, id model.ID, candidates []model.ID, role string) (model.ID, error) {
+	if id != "" {
+		for _, n := range wf.Nodes {
+			if n.ID == id {
+				return id, nil
+			}
+		}
+		return "", fmt.Errorf("workflow %s has no %s node %q", wf.ID, role, id)
+	}
+	if len(candidates) != 1 {
+		return "", fmt.Errorf("workflow %s has %d possible %s nodes, set %s", wf.ID, len(candidates), role, role)
+	}
+	return candidates[0], nil
+}
+
+// sinks returns the nodes without outgoing edges, in declaration order
+func sinks(wf model.Workflow) []model.ID {
+	from := map[model.ID]bool{}
+	for _, e := range wf.Edges {
+		from[e.FromNode] = true
+	}
+	var out []model.ID
+	for _, n := range wf.Nodes {
+		if !from[n.ID] {
+			out = append(out, n.ID)
+		}
+	}
+	return out
+}
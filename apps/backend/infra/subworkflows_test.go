@@ -0,0 +1,98 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/model"
+	_ "github.com/Tsinling0525/rivulet/nodes/exec"
+)
+
+func writeWorkflowFile(t *testing.T, name string, wf n8n.N8nWorkflow) {
+	t.Helper()
+	b, _ := json.Marshal(n8n.N8nRequest{Workflow: wf})
+	if err := os.MkdirAll(WorkflowsDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(WorkflowsDir(), name), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubWorkflow(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	writeWorkflowFile(t, "child.json", n8n.N8nWorkflow{
+		ID: "child",
+		Nodes: []n8n.N8nNode{
+			{ID: "in", Name: "In", Type: "echo", Parameters: map[string]interface{}{"label": "child"}},
+			{ID: "out", Name: "Out", Type: "echo", Parameters: map[string]interface{}{"label": "done"}},
+		},
+		Connections: map[string]n8n.N8nConnections{"in": {Main: [][]n8n.N8nConnection{{{Node: "out", Type: "main"}}}}},
+	})
+	writeWorkflowFile(t, "loop.json", n8n.N8nWorkflow{
+		ID:    "loop",
+		Nodes: []n8n.N8nNode{{ID: "self", Name: "Self", Type: "exec:workflow", Parameters: map[string]interface{}{"workflow": "loop.json", "max_depth": 3}}},
+	})
+	m := NewInstanceManager()
+
+	wf := model.Workflow{
+		ID:    "parent",
+		Nodes: []model.Node{{ID: "call", Type: "exec:workflow", Config: map[string]any{"workflow": "child.json"}}},
+	}
+	m.Submit("exec-parent", "", wf, map[model.ID]model.Items{"call": {{"x": 1}}})
+	rec, err := m.Wait(context.Background(), "exec-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := rec.Result["call"]
+	if len(out) != 1 || out[0]["x"] != 1 || out[0]["echo_label"] != "done" {
+		t.Fatalf("unexpected sub-workflow output: %v", out)
+	}
+	children, _ := m.History().List(HistoryQuery{})
+	var child ExecutionRecord
+	for _, r := range children {
+		if r.ParentExecutionID == "exec-parent" {
+			child = r
+		}
+	}
+	if child.ExecutionID == "" || child.WorkflowID != "child" || child.Status != ExecutionSucceeded {
+		t.Fatalf("child execution not linked to its parent: %+v", children)
+	}
+
+	wf.Nodes[0].Config = map[string]any{"workflow": "loop.json"}
+	m.Submit("exec-loop", "", wf, nil)
+	if _, err := m.Wait(context.Background(), "exec-loop"); !errors.Is(err, ErrWorkflowDepth) {
+		t.Fatalf("expected the depth limit, got %v", err)
+	}
+}
+
+func TestConcurrentExecIDsAreUnique(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = map[string]bool{}
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := newExecID()
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("duplicate execution ID %s", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
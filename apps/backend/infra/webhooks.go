@@ -0,0 +1,399 @@
+package infra
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// WebhookNodeType is the node type that exposes an instance under /webhook
+const WebhookNodeType = "trigger:webhook"
+
+// Webhook response modes
+const (
+	WebhookOnReceived  = "on_received"  // answer 202 with the execution ID right away
+	WebhookLastNode    = "last_node"    // answer with the result once the execution finishes
+	WebhookRespondNode = "respond_node" // answer with what a webhook:respond node sends
+)
+
+// DefaultWebhookTimeout is how long a synchronous webhook waits for its response
+const DefaultWebhookTimeout = 30 * time.Second
+
+var (
+	ErrWebhookNotFound   = errors.New("webhook not found")
+	ErrWebhookMethod     = errors.New("method not allowed")
+	ErrWebhookConflict   = errors.New("webhook path already in use")
+	ErrWebhookTimeout    = errors.New("timed out waiting for the webhook response")
+	ErrWebhookNoResponse = errors.New("execution finished without responding to the webhook")
+)
+
+// WebhookAuth is how callers of a webhook authenticate: "none", "header"
+// (Name and Value), "basic" (Username and Password) or "bearer" (Token)
+type WebhookAuth struct {
+	Type     string `json:"type,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// Webhook is a route served for a trigger:webhook node of a running
+// instance. Path segments starting with ':' are parameters.
+type Webhook struct {
+	Method       string        `json:"method"`
+	Path         string        `json:"path"`
+	ResponseMode string        `json:"response_mode"`
+	Timeout      time.Duration `json:"-"`
+	Auth         WebhookAuth   `json:"-"`
+	AuthType     string        `json:"auth"`
+	Instance     string        `json:"instance"`
+	Node         model.ID      `json:"node"`
+
+	segments []string
+}
+
+// webhookConfig is the config of a trigger:webhook node
+type webhookConfig struct {
+	Path            string      `json:"path"`
+	Method          string      `json:"method"`
+	ResponseMode    string      `json:"response_mode"`
+	ResponseTimeout string      `json:"response_timeout"` // Go duration, default 30s
+	Auth            WebhookAuth `json:"auth"`
+}
+
+// parseWebhooks reads the trigger:webhook nodes of wf
+func parseWebhooks(wf model.Workflow) ([]*Webhook, error) {
+	var out []*Webhook
+	for _, node := range wf.Nodes {
+		if node.Type != WebhookNodeType {
+			continue
+		}
+		hook, err := newWebhook(node)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", node.ID, err)
+		}
+		out = append(out, hook)
+	}
+	return out, nil
+}
+
+func newWebhook(node model.Node) (*Webhook, error) {
+	b, err := json.Marshal(node.Config)
+	if err != nil {
+		return nil, err
+	}
+	var cfg webhookConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	hook := &Webhook{
+		Method:       strings.ToUpper(cfg.Method),
+		Path:         strings.Trim(cfg.Path, "/"),
+		ResponseMode: cfg.ResponseMode,
+		Timeout:      DefaultWebhookTimeout,
+		Auth:         cfg.Auth,
+		AuthType:     cfg.Auth.Type,
+		Node:         node.ID,
+	}
+	if hook.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	hook.segments = strings.Split(hook.Path, "/")
+	for _, seg := range hook.segments {
+		if seg == "" || seg == ":" {
+			return nil, fmt.Errorf("invalid path %q", cfg.Path)
+		}
+	}
+	if hook.Method == "" {
+		hook.Method = http.MethodPost
+	}
+	switch hook.ResponseMode {
+	case "":
+		hook.ResponseMode = WebhookOnReceived
+	case WebhookOnReceived, WebhookLastNode, WebhookRespondNode:
+	default:
+		return nil, fmt.Errorf("unknown response_mode %q", hook.ResponseMode)
+	}
+	if cfg.ResponseTimeout != "" {
+		if hook.Timeout, err = time.ParseDuration(cfg.ResponseTimeout); err != nil || hook.Timeout <= 0 {
+			return nil, fmt.Errorf("response_timeout: invalid duration %q", cfg.ResponseTimeout)
+		}
+	}
+	switch a := cfg.Auth; a.Type {
+	case "", "none":
+		hook.AuthType = "none"
+	case "header":
+		if a.Name == "" || a.Value == "" {
+			return nil, errors.New("header auth needs a name and value")
+		}
+	case "basic":
+		if a.Username == "" {
+			return nil, errors.New("basic auth needs a username")
+		}
+	case "bearer":
+		if a.Token == "" {
+			return nil, errors.New("bearer auth needs a token")
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth type %q", a.Type)
+	}
+	return hook, nil
+}
+
+// match reports whether path matches the hook's segments, returning the
+// path parameters and how many segments matched literally
+func (h *Webhook) match(segments []string) (map[string]string, int, bool) {
+	if len(segments) != len(h.segments) {
+		return nil, 0, false
+	}
+	params := map[string]string{}
+	literal := 0
+	for i, seg := range h.segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			params[seg[1:]] = segments[i]
+		case seg == segments[i]:
+			literal++
+		default:
+			return nil, 0, false
+		}
+	}
+	return params, literal, true
+}
+
+// shape is the hook's path with parameter names dropped; two hooks with the
+// same method and shape would serve the same requests
+func (h *Webhook) shape() string {
+	parts := make([]string, len(h.segments))
+	for i, seg := range h.segments {
+		if strings.HasPrefix(seg, ":") {
+			seg = ":"
+		}
+		parts[i] = seg
+	}
+	return strings.Join(parts, "/")
+}
+
+// Authorize checks the request's credentials against the hook's auth
+func (h *Webhook) Authorize(r *http.Request) bool {
+	a := h.Auth
+	switch a.Type {
+	case "header":
+		return secureEqual(r.Header.Get(a.Name), a.Value)
+	case "basic":
+		user, pass, ok := r.BasicAuth()
+		// compare both so a wrong username takes as long as a wrong password
+		userOK, passOK := secureEqual(user, a.Username), secureEqual(pass, a.Password)
+		return ok && userOK && passOK
+	case "bearer":
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && secureEqual(token, a.Token)
+	}
+	return true
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// registerWebhooks makes the webhooks of inst reachable; it fails when one
+// of them is already served by another instance
+func (m *InstanceManager) registerWebhooks(inst *Instance) error {
+	if len(inst.webhooks) == 0 {
+		return nil
+	}
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	taken := map[string]bool{}
+	for _, h := range m.hooks {
+		taken[h.Method+" "+h.shape()] = true
+	}
+	for _, h := range inst.webhooks {
+		key := h.Method + " " + h.shape()
+		if taken[key] {
+			return fmt.Errorf("%w: %s /webhook/%s", ErrWebhookConflict, h.Method, h.Path)
+		}
+		taken[key] = true
+	}
+	for _, h := range inst.webhooks {
+		h.Instance = inst.ID
+		m.hooks = append(m.hooks, h)
+	}
+	return nil
+}
+
+// unregisterWebhooks drops the routes of an instance
+func (m *InstanceManager) unregisterWebhooks(instanceID string) {
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	kept := m.hooks[:0]
+	for _, h := range m.hooks {
+		if h.Instance != instanceID {
+			kept = append(kept, h)
+		}
+	}
+	m.hooks = kept
+}
+
+// MatchWebhook finds the webhook serving a request to /webhook/<path>.
+// Literal segments win over parameters. ErrWebhookMethod means the path is
+// served, just not for method.
+func (m *InstanceManager) MatchWebhook(method, path string) (*Webhook, map[string]string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	var (
+		best       *Webhook
+		bestParams map[string]string
+		bestScore  = -1
+		pathFound  bool
+	)
+	for _, h := range m.hooks {
+		params, score, ok := h.match(segments)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if h.Method == strings.ToUpper(method) && score > bestScore {
+			best, bestParams, bestScore = h, params, score
+		}
+	}
+	switch {
+	case best != nil:
+		return best, bestParams, nil
+	case pathFound:
+		return nil, nil, ErrWebhookMethod
+	default:
+		return nil, nil, ErrWebhookNotFound
+	}
+}
+
+// webhookWait is a caller waiting for the response of an execution
+type webhookWait struct {
+	mode   string
+	execID string // key in m.waits, moved along when the job is retried
+	once   sync.Once
+	done   chan struct{}
+	resp   *plugin.WebhookResponse
+	err    error
+}
+
+func (w *webhookWait) settle(resp *plugin.WebhookResponse, err error) {
+	w.once.Do(func() {
+		w.resp, w.err = resp, err
+		close(w.done)
+	})
+}
+
+// TriggerWebhook enqueues an execution of the hook's instance with item as
+// the input of the trigger node. Unless the hook responds on receipt it
+// waits for the response, up to the hook's timeout.
+func (m *InstanceManager) TriggerWebhook(ctx context.Context, hook *Webhook, item model.Item) (string, *plugin.WebhookResponse, error) {
+	inst, ok := m.Get(hook.Instance)
+	if !ok {
+		return "", nil, fmt.Errorf("instance not found")
+	}
+	execID, inputs := newExecID(), map[model.ID]model.Items{hook.Node: {item}}
+	if hook.ResponseMode == WebhookOnReceived {
+		// nothing was queued on error, so there is no execution to name
+		if err := m.enqueue(ctx, inst, execID, inputs); err != nil {
+			return "", nil, err
+		}
+		return execID, nil, nil
+	}
+
+	// register before enqueueing so a fast execution can't respond unseen
+	w := &webhookWait{mode: hook.ResponseMode, execID: execID, done: make(chan struct{})}
+	m.hooksMu.Lock()
+	m.waits[execID] = w
+	m.hooksMu.Unlock()
+	defer func() {
+		m.hooksMu.Lock()
+		delete(m.waits, w.execID)
+		m.hooksMu.Unlock()
+	}()
+	if err := m.enqueue(ctx, inst, execID, inputs); err != nil {
+		return "", nil, err
+	}
+	timer := time.NewTimer(hook.Timeout)
+	defer timer.Stop()
+	select {
+	case <-w.done:
+		return execID, w.resp, w.err
+	case <-timer.C:
+		return execID, nil, ErrWebhookTimeout
+	case <-ctx.Done():
+		return execID, nil, ctx.Err()
+	}
+}
+
+// RespondWebhook implements plugin.WebhookResponder. Only the first
+// response of an execution is sent; without a caller waiting for one it
+// does nothing.
+func (m *InstanceManager) RespondWebhook(ctx context.Context, resp plugin.WebhookResponse) error {
+	m.hooksMu.Lock()
+	w := m.waits[plugin.ExecutionID(ctx)]
+	m.hooksMu.Unlock()
+	if w != nil && w.mode == WebhookRespondNode {
+		w.settle(&resp, nil)
+	}
+	return nil
+}
+
+// moveWebhookWait hands a caller waiting on a failed attempt over to the
+// next one
+func (m *InstanceManager) moveWebhookWait(from, to string) {
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	if w := m.waits[from]; w != nil {
+		delete(m.waits, from)
+		w.execID = to
+		m.waits[to] = w
+	}
+}
+
+// settleWebhook answers a caller still waiting when its execution ends
+func (m *InstanceManager) settleWebhook(execID string, wf model.Workflow, rec ExecutionRecord, err error) {
+	m.hooksMu.Lock()
+	w := m.waits[execID]
+	m.hooksMu.Unlock()
+	switch {
+	case w == nil:
+	case err != nil:
+		w.settle(nil, err)
+	case w.mode == WebhookRespondNode:
+		w.settle(nil, ErrWebhookNoResponse)
+	default:
+		w.settle(resultResponse(wf, rec.Result))
+	}
+}
+
+// resultResponse is the JSON answer of a last_node webhook: the items of
+// the workflow's only sink node, or all results keyed by node
+func resultResponse(wf model.Workflow, res map[model.ID]model.Items) (*plugin.WebhookResponse, error) {
+	var v any = res
+	if ends := sinks(wf); len(ends) == 1 {
+		if v = res[ends[0]]; v == nil {
+			v = model.Items{}
+		}
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.WebhookResponse{
+		Status:  http.StatusOK,
+		Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:    body,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/model"
+	_ "github.com/Tsinling0525/rivulet/nodes/trigger"
+)
+
+func TestWebhookRespondNode(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_DRIVER", "none")
+	hook := map[string]interface{}{
+		"path":          "orders/:id",
+		"response_mode": "respond_node",
+		"auth":          map[string]any{"type": "bearer", "token": "s3cret"},
+	}
+	writeWorkflowFile(t, "orders.json", n8n.N8nWorkflow{
+		ID: "orders",
+		Nodes: []n8n.N8nNode{
+			{ID: "hook", Name: "Hook", Type: "trigger:webhook", Parameters: hook},
+			{ID: "reply", Name: "Reply", Type: "webhook:respond", Parameters: map[string]interface{}{"respond_with": "field", "field": "params", "status": 201}},
+		},
+		Connections: map[string]n8n.N8nConnections{"hook": {Main: [][]n8n.N8nConnection{{{Node: "reply", Type: "main"}}}}},
+	})
+	path := filepath.Join(WorkflowsDir(), "orders.json")
+	m := NewInstanceManager()
+	inst, err := m.CreateFromWorkflowPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateFromWorkflowPath(path); !errors.Is(err, ErrWebhookConflict) {
+		t.Fatalf("expected a second instance on the same path to conflict, got %v", err)
+	}
+
+	if _, _, err := m.MatchWebhook(http.MethodGet, "/orders/42"); !errors.Is(err, ErrWebhookMethod) {
+		t.Fatalf("expected GET to be refused, got %v", err)
+	}
+	h, params, err := m.MatchWebhook(http.MethodPost, "/orders/42")
+	if err != nil || params["id"] != "42" {
+		t.Fatalf("match: %v %v", params, err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "/webhook/orders/42", nil)
+	if h.Authorize(req) {
+		t.Fatal("expected a request without a token to be refused")
+	}
+	req.Header.Set("Authorization", "Bearer s3cret")
+	if !h.Authorize(req) {
+		t.Fatal("expected the bearer token to be accepted")
+	}
+
+	execID, resp, err := m.TriggerWebhook(context.Background(), h, model.Item{"params": map[string]any{"id": "42"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if resp == nil || resp.Status != http.StatusCreated || json.Unmarshal(resp.Body, &body) != nil || body["id"] != "42" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if rec, err := m.Wait(context.Background(), execID); err != nil || rec.Status != ExecutionSucceeded {
+		t.Fatalf("execution %s: %+v %v", execID, rec, err)
+	}
+
+	_ = m.Stop(inst.ID)
+	if _, _, err := m.MatchWebhook(http.MethodPost, "/orders/42"); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("expected the route to go away with its instance, got %v", err)
+	}
+}
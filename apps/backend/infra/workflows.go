@@ -0,0 +1,226 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/engine"
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	"github.com/Tsinling0525/rivulet/infra/repository"
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+var (
+	// ErrNoDatabase is returned by stored-workflow operations when the
+	// database is disabled
+	ErrNoDatabase = errors.New("workflow database is not configured")
+	// ErrWorkflowExists is returned when creating a workflow whose ID is taken
+	ErrWorkflowExists = errors.New("workflow already exists")
+	// ErrReservedWorkflowID is returned when creating a workflow whose ID
+	// is kept for recorded workflow file runs
+	ErrReservedWorkflowID = errors.New("workflow IDs starting with \"" + fileRunSlugPrefix + "\" are reserved")
+)
+
+// canonicalConfig is the stored form of a definition: the n8n document
+// rebuilt from the parsed workflow, so equal definitions hash equally.
+func canonicalConfig(wf model.Workflow) (json.RawMessage, error) {
+	return json.Marshal(n8n.FromRivulet(wf))
+}
+
+// WorkflowFromVersion parses the definition stored in a version
+func WorkflowFromVersion(v repository.Version) (model.Workflow, error) {
+	var def n8n.N8nWorkflow
+	if err := json.Unmarshal(v.Config, &def); err != nil {
+		return model.Workflow{}, fmt.Errorf("version %d: %w", v.Number, err)
+	}
+	return n8n.ParseWorkflow(def), nil
+}
+
+// ResolveWorkflow finds a stored workflow by its definition ID (slug) or database ID
+func (m *InstanceManager) ResolveWorkflow(ctx context.Context, ref string) (repository.Workflow, error) {
+	if m.repo == nil {
+		return repository.Workflow{}, ErrNoDatabase
+	}
+	w, err := m.repo.GetWorkflowBySlug(ctx, ref)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Postgres rejects non-UUID keys, which only means there is no such row
+		if w, err = m.repo.GetWorkflow(ctx, ref); err != nil {
+			return repository.Workflow{}, repository.ErrNotFound
+		}
+	}
+	return w, err
+}
+
+// ResolveVersion returns version n of a workflow, or the latest when n is 0
+func (m *InstanceManager) ResolveVersion(ctx context.Context, workflowID string, n int) (repository.Version, error) {
+	if m.repo == nil {
+		return repository.Version{}, ErrNoDatabase
+	}
+	if n == 0 {
+		return m.repo.LatestVersion(ctx, workflowID)
+	}
+	return m.repo.GetVersionByNumber(ctx, workflowID, n)
+}
+
+// CreateWorkflow validates and stores a new workflow as version 1. A
+// definition without an ID gets a generated one.
+func (m *InstanceManager) CreateWorkflow(ctx context.Context, def n8n.N8nWorkflow, description, changelog string) (repository.Workflow, repository.Version, error) {
+	if m.repo == nil {
+		return repository.Workflow{}, repository.Version{}, ErrNoDatabase
+	}
+	if def.ID == "" {
+		def.ID = fmt.Sprintf("wf-%d", time.Now().UnixNano())
+	}
+	if strings.HasPrefix(def.ID, fileRunSlugPrefix) {
+		return repository.Workflow{}, repository.Version{}, ErrReservedWorkflowID
+	}
+	wf, config, err := prepareDefinition(def)
+	if err != nil {
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	if _, err := m.repo.GetWorkflowBySlug(ctx, def.ID); err == nil {
+		return repository.Workflow{}, repository.Version{}, ErrWorkflowExists
+	}
+	w, err := m.repo.CreateWorkflow(ctx, repository.Workflow{Slug: def.ID, Name: def.Name, Description: description, State: repository.StateActive})
+	if err != nil {
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	if changelog == "" {
+		changelog = "created"
+	}
+	v, err := m.repo.CreateVersion(ctx, w.ID, wf, config, changelog)
+	if err != nil {
+		_ = m.repo.DeleteWorkflow(ctx, w.ID)
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	w.DefaultVersionID = v.ID
+	return w, v, nil
+}
+
+// UpdateWorkflow stores def as a new immutable version of the workflow ref.
+// The definition keeps the workflow's ID whatever the document says.
+func (m *InstanceManager) UpdateWorkflow(ctx context.Context, ref string, def n8n.N8nWorkflow, description, changelog string) (repository.Workflow, repository.Version, error) {
+	w, err := m.ResolveWorkflow(ctx, ref)
+	if err != nil {
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	def.ID = w.Slug
+	wf, config, err := prepareDefinition(def)
+	if err != nil {
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	v, err := m.repo.CreateVersion(ctx, w.ID, wf, config, changelog)
+	if err != nil {
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	w.Name = def.Name
+	if description != "" {
+		w.Description = description
+	}
+	if w, err = m.repo.UpdateWorkflow(ctx, w); err != nil {
+		return repository.Workflow{}, repository.Version{}, err
+	}
+	return w, v, nil
+}
+
+// DeleteWorkflow removes a stored workflow with all versions and runs.
+// Instances already running it keep their loaded definition.
+func (m *InstanceManager) DeleteWorkflow(ctx context.Context, ref string) error {
+	w, err := m.ResolveWorkflow(ctx, ref)
+	if err != nil {
+		return err
+	}
+	return m.repo.DeleteWorkflow(ctx, w.ID)
+}
+
+func prepareDefinition(def n8n.N8nWorkflow) (model.Workflow, json.RawMessage, error) {
+	wf := n8n.ParseWorkflow(def)
+	if err := engine.Validate(wf).Err(); err != nil {
+		return model.Workflow{}, nil, err
+	}
+	config, err := canonicalConfig(wf)
+	if err != nil {
+		return model.Workflow{}, nil, err
+	}
+	return wf, config, nil
+}
+
+// readWorkflowRequest decodes a workflow file without interpreting it
+func readWorkflowRequest(path string) (n8n.N8nRequest, error) {
+	var req n8n.N8nRequest
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return req, fmt.Errorf("%s: %w", path, err)
+	}
+	return req, nil
+}
+
+// readWorkflowFile parses and validates a workflow JSON file together with
+// the inputs it carries
+func readWorkflowFile(path string) (model.Workflow, map[model.ID]model.Items, error) {
+	req, err := readWorkflowRequest(path)
+	if err != nil {
+		return model.Workflow{}, nil, err
+	}
+	return workflowFromRequest(req)
+}
+
+// workflowFromRequest parses and validates a decoded workflow file
+func workflowFromRequest(req n8n.N8nRequest) (model.Workflow, map[model.ID]model.Items, error) {
+	wf, inputs := n8n.ToRivulet(req)
+	if err := engine.Validate(wf).Err(); err != nil {
+		return model.Workflow{}, nil, err
+	}
+	return wf, inputs, nil
+}
+
+// LoadWorkflow resolves a workflow reference from a definition: a .json
+// path under WorkflowsDir, or the ID of a stored workflow, which loads its
+// latest version. The version ID is "" for files.
+func (m *InstanceManager) LoadWorkflow(ctx context.Context, ref string) (model.Workflow, string, error) {
+	if strings.HasSuffix(ref, ".json") {
+		path, err := workflowFilePath(ref)
+		if err != nil {
+			return model.Workflow{}, "", err
+		}
+		wf, _, err := readWorkflowFile(path)
+		return wf, "", err
+	}
+	w, err := m.ResolveWorkflow(ctx, ref)
+	if err != nil {
+		return model.Workflow{}, "", fmt.Errorf("workflow %s: %w", ref, err)
+	}
+	v, err := m.ResolveVersion(ctx, w.ID, 0)
+	if err != nil {
+		return model.Workflow{}, "", fmt.Errorf("workflow %s: %w", ref, err)
+	}
+	wf, err := WorkflowFromVersion(v)
+	if err == nil {
+		err = engine.Validate(wf).Err()
+	}
+	return wf, v.ID, err
+}
+
+// workflowFilePath resolves ref against WorkflowsDir, refusing paths that
+// leave it
+func workflowFilePath(ref string) (string, error) {
+	dir := WorkflowsDir()
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, ref)
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("workflow file %s is outside %s", ref, dir)
+	}
+	return path, nil
+}
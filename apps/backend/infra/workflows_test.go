@@ -0,0 +1,120 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/format/n8n"
+	_ "github.com/Tsinling0525/rivulet/nodes/echo"
+)
+
+func echoWorkflow(label string) n8n.N8nWorkflow {
+	return n8n.N8nWorkflow{
+		ID:    "greet",
+		Name:  "Greet",
+		Nodes: []n8n.N8nNode{{ID: "a", Name: "A", Type: "echo", Parameters: map[string]interface{}{"label": label}}},
+	}
+}
+
+func TestStoredWorkflowVersions(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	ctx := context.Background()
+	m := NewInstanceManager()
+	if m.Repository() == nil {
+		t.Fatal("expected the default SQLite database")
+	}
+
+	w, v1, err := m.CreateWorkflow(ctx, echoWorkflow("one"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.CreateWorkflow(ctx, echoWorkflow("one"), "", ""); !errors.Is(err, ErrWorkflowExists) {
+		t.Fatalf("duplicate create: %v", err)
+	}
+	pinned, err := m.CreateFromStoredWorkflow(ctx, "greet", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := m.CreateFromStoredWorkflow(ctx, w.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop(pinned.ID)
+	defer m.Stop(latest.ID)
+
+	_, v2, err := m.UpdateWorkflow(ctx, "greet", echoWorkflow("two"), "", "relabel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Number != 1 || v2.Number != 2 || v1.ConfigHash == v2.ConfigHash {
+		t.Fatalf("versions: %+v %+v", v1, v2)
+	}
+
+	m.refreshVersion(ctx, pinned)
+	m.refreshVersion(ctx, latest)
+	if got := pinned.Snapshot().Version; got != 1 {
+		t.Errorf("pinned instance moved to version %d", got)
+	}
+	snap := latest.Snapshot()
+	if snap.Version != 2 || snap.Workflow.Nodes[0].Config["label"] != "two" {
+		t.Errorf("following instance has version %d, config %v", snap.Version, snap.Workflow.Nodes[0].Config)
+	}
+}
+
+func TestFileRunsAreNotStoredByDefault(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	ctx := context.Background()
+	wf := n8n.ParseWorkflow(echoWorkflow("adhoc"))
+	for _, record := range []bool{false, true} {
+		if record {
+			t.Setenv("RIV_DB_RECORD_FILE_RUNS", "true")
+		}
+		m := NewInstanceManager()
+		execID := newExecID()
+		m.Submit(execID, "", wf, nil)
+		rec, err := m.Wait(ctx, execID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := m.Repository().ListWorkflows(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(stored) == 1 && rec.RunID != ""; got != record {
+			t.Fatalf("record=%v: run %q, stored workflows %+v", record, rec.RunID, stored)
+		}
+	}
+}
+
+func TestFileRunsKeepOutOfStoredWorkflows(t *testing.T) {
+	t.Setenv("RIV_DATA_DIR", t.TempDir())
+	t.Setenv("RIV_DB_RECORD_FILE_RUNS", "true")
+	ctx := context.Background()
+	m := NewInstanceManager()
+	if _, _, err := m.CreateWorkflow(ctx, echoWorkflow("stored"), "", ""); err != nil {
+		t.Fatal(err)
+	}
+	// a workflow file of the same ID but another graph
+	execID := newExecID()
+	m.Submit(execID, "", n8n.ParseWorkflow(echoWorkflow("file")), nil)
+	if _, err := m.Wait(ctx, execID); err != nil {
+		t.Fatal(err)
+	}
+	w, err := m.ResolveWorkflow(ctx, "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.ResolveVersion(ctx, w.ID, 0); err != nil || v.Number != 1 {
+		t.Fatalf("file run changed the stored workflow: %+v (%v)", v, err)
+	}
+	if _, err := m.ResolveWorkflow(ctx, fileRunSlug("greet")); err != nil {
+		t.Fatalf("file run not recorded apart: %v", err)
+	}
+
+	def := echoWorkflow("x")
+	def.ID = fileRunSlug("other")
+	if _, _, err := m.CreateWorkflow(ctx, def, "", ""); !errors.Is(err, ErrReservedWorkflowID) {
+		t.Fatalf("expected the file run namespace to be reserved, got %v", err)
+	}
+}
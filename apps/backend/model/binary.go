@@ -0,0 +1,58 @@
+package model
+
+import "encoding/json"
+
+// BinaryKey marks the JSON form of a BinaryRef, so references survive a
+// round trip through history, checkpoints or scripts as plain maps
+const BinaryKey = "$binary"
+
+// BinaryRef points at file contents in the FileStore instead of carrying
+// them inline in an item. Nodes resolve it when they need the bytes.
+type BinaryRef struct {
+	WorkflowID ID     `json:"workflow_id"` // FileStore scope
+	FileID     string `json:"file_id"`
+	Name       string `json:"name,omitempty"`
+	MediaType  string `json:"media_type,omitempty"`
+	Size       int64  `json:"size"`
+}
+
+func (r BinaryRef) MarshalJSON() ([]byte, error) {
+	type plain BinaryRef
+	return json.Marshal(struct {
+		Binary bool `json:"$binary"`
+		plain
+	}{true, plain(r)})
+}
+
+// AsBinaryRef reports whether v is a BinaryRef, either as the Go value or
+// in its JSON map form
+func AsBinaryRef(v any) (BinaryRef, bool) {
+	switch r := v.(type) {
+	case BinaryRef:
+		return r, true
+	case *BinaryRef:
+		if r != nil {
+			return *r, true
+		}
+	case map[string]any:
+		if marked, _ := r[BinaryKey].(bool); !marked {
+			return BinaryRef{}, false
+		}
+		ref := BinaryRef{}
+		id, _ := r["workflow_id"].(string)
+		ref.WorkflowID = ID(id)
+		ref.FileID, _ = r["file_id"].(string)
+		ref.Name, _ = r["name"].(string)
+		ref.MediaType, _ = r["media_type"].(string)
+		switch n := r["size"].(type) {
+		case float64:
+			ref.Size = int64(n)
+		case int64:
+			ref.Size = n
+		case int:
+			ref.Size = int64(n)
+		}
+		return ref, ref.FileID != ""
+	}
+	return BinaryRef{}, false
+}
@@ -8,6 +8,15 @@ type Port string
 
 const (
 	PortMain Port = "main"
+	// PortError receives failing items of nodes with OnError set to route
+	PortError Port = "error"
+)
+
+// What the engine does when a node fails on an item
+const (
+	OnErrorFail     = "fail"     // abort the execution (default)
+	OnErrorContinue = "continue" // pass the item on with an "error" field
+	OnErrorRoute    = "route"    // send the item with an "error" field to PortError
 )
 
 type Edge struct {
@@ -22,22 +31,36 @@ type Node struct {
 	Type        string
 	Name        string
 	Concurrency int           // 0 = default
-	Timeout     time.Duration // 0 = none
+	Timeout     time.Duration // 0 = none, negative = invalid in the source definition
 	Config      map[string]any
 	Credentials string // reference key
+	OnError     string // OnErrorFail (default), OnErrorContinue or OnErrorRoute
 }
 
 type Workflow struct {
-	ID    ID
-	Name  string
-	Nodes []Node
-	Edges []Edge
+	ID       ID
+	Name     string
+	Nodes    []Node
+	Edges    []Edge
+	Settings map[string]any // workflow-level knobs, e.g. max_parallelism
 }
 
 type Item = map[string]any
 
 type Items = []Item
 
+// ItemSource locates an item in a node's output on a port. An empty Port
+// refers to the node's own direct input.
+type ItemSource struct {
+	Node  ID   `json:"node"`
+	Port  Port `json:"port,omitempty"`
+	Index int  `json:"index"`
+}
+
+// Lineage lists, for each item of a node's output port, the items it was
+// derived from
+type Lineage = [][]ItemSource
+
 // FileMeta describes an attached file
 type FileMeta struct {
 	ID        string
@@ -0,0 +1,56 @@
+package exec
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// Workflow runs another workflow with the incoming items and returns the
+// items of its output node.
+// Config:
+// - workflow: string (required) .json file under the workflows dir, or stored workflow ID
+// - entry: string (node receiving the items; default: the only root node)
+// - output: string (node whose items are returned; default: the only sink node)
+// - max_depth: number (nesting limit; default: 8)
+type Workflow struct{ deps plugin.Deps }
+
+func (n *Workflow) Init(ctx context.Context, deps plugin.Deps) error {
+	if deps.Workflows == nil {
+		return errors.New("exec:workflow needs a workflow runner; run it through the API server or an instance")
+	}
+	n.deps = deps
+	return nil
+}
+
+func (n *Workflow) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	ref, _ := node.Config["workflow"].(string)
+	if ref == "" {
+		return nil, errors.New("workflow is required")
+	}
+	entry, _ := node.Config["entry"].(string)
+	output, _ := node.Config["output"].(string)
+	depth, _ := node.Config["max_depth"].(float64)
+	if d, ok := node.Config["max_depth"].(int); ok {
+		depth = float64(d)
+	}
+	_, out, err := n.deps.Workflows.RunWorkflow(ctx, plugin.WorkflowRun{
+		Ref:      ref,
+		Node:     node.ID,
+		Entry:    model.ID(entry),
+		Output:   model.ID(output),
+		Items:    in,
+		MaxDepth: int(depth),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = model.Items{}
+	}
+	return out, nil
+}
+
+func init() { plugin.Register("exec:workflow", func() plugin.NodeHandler { return &Workflow{} }) }
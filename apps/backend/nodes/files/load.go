@@ -9,11 +9,12 @@ import (
     "github.com/Tsinling0525/rivulet/plugin"
 )
 
-// Load reads a file from the FileStore using item[file_id] and attaches
-// metadata and bytes to the item.
+// Load looks up a file in the FileStore using item[file_id] and attaches
+// its metadata and a reference to its contents to the item.
 // Config:
 // - file_id_field: string (default: "file_id")
-// - out_prefix: string (default: "file_") => fields: <prefix>name, <prefix>bytes, <prefix>media_type, <prefix>ext, <prefix>base
+// - out_prefix: string (default: "file_") => fields: <prefix>name, <prefix>ref, <prefix>size, <prefix>media_type, <prefix>ext, <prefix>base
+// - inline: bool (default: false) also attach <prefix>bytes and <prefix>b64
 type Load struct{ deps plugin.Deps }
 
 func (n *Load) Init(ctx context.Context, deps plugin.Deps) error { n.deps = deps; return nil }
@@ -24,14 +25,21 @@ func (n *Load) Process(ctx context.Context, wf model.Workflow, node model.Node,
     if v, ok := node.Config["file_id_field"].(string); ok && v != "" { idField = v }
     prefix := "file_"
     if v, ok := node.Config["out_prefix"].(string); ok && v != "" { prefix = v }
+    inline, _ := node.Config["inline"].(bool)
 
     out := make(model.Items, 0, len(in))
     for _, item := range in {
         if item == nil { item = model.Item{} }
         raw := item[idField]
         fid, _ := raw.(string)
-        name, mt, data, err := n.deps.Files.Get(ctx, string(wf.ID), fid)
+        // metadata only; contents are read when a consumer resolves the ref
+        meta, err := n.deps.Files.Stat(ctx, string(wf.ID), fid)
         if err != nil { return nil, err }
+        name, mt := meta.Name, meta.MediaType
+        var data []byte
+        if inline {
+            if _, _, data, err = n.deps.Files.Get(ctx, string(wf.ID), fid); err != nil { return nil, err }
+        }
         base := filepath.Base(name)
         ext := filepath.Ext(name)
 
@@ -42,8 +50,12 @@ func (n *Load) Process(ctx context.Context, wf model.Workflow, node model.Node,
         o[prefix+"base"] = base
         o[prefix+"ext"] = ext
         o[prefix+"media_type"] = mt
-        o[prefix+"bytes"] = data
-        o[prefix+"b64"] = base64.StdEncoding.EncodeToString(data)
+        o[prefix+"size"] = meta.Size
+        o[prefix+"ref"] = model.BinaryRef{WorkflowID: wf.ID, FileID: fid, Name: name, MediaType: mt, Size: meta.Size}
+        if inline {
+            o[prefix+"bytes"] = data
+            o[prefix+"b64"] = base64.StdEncoding.EncodeToString(data)
+        }
         out = append(out, o)
     }
     return out, nil
@@ -15,7 +15,7 @@ import (
 // Write writes an item field to a file using a path template.
 // Config:
 // - path_template: string (Go template, required)
-// - field: string (default: "body"); value may be string or map (JSON encoded)
+// - field: string (default: "body"); value may be string, bytes, a binary reference or anything else (JSON encoded)
 // - mkdirs: bool (default: true)
 type Write struct{ deps plugin.Deps }
 
@@ -47,7 +47,15 @@ func (n *Write) Process(ctx context.Context, wf model.Workflow, node model.Node,
             data = []byte(v)
         case []byte:
             data = v
+        case model.BinaryRef:
+            _, _, data, err = plugin.ReadBinary(ctx, n.deps.Files, wf.ID, v)
+            if err != nil { return nil, err }
         case map[string]any:
+            if _, ok := model.AsBinaryRef(v); ok {
+                _, _, data, err = plugin.ReadBinary(ctx, n.deps.Files, wf.ID, v)
+                if err != nil { return nil, err }
+                break
+            }
             b, err := json.Marshal(v)
             if err != nil { return nil, err }
             data = b
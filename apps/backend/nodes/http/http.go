@@ -58,13 +58,14 @@ func (n *HTTP) Process(ctx context.Context, wf model.Workflow, node model.Node,
 			if err := json.NewDecoder(res.Body).Decode(&respObj); err != nil {
 				respObj = map[string]any{"status": res.StatusCode}
 			}
+			lastErr = nil
 			break
 		}
+		// failures are returned so the node's on_error mode decides what happens
 		if lastErr != nil {
-			out = append(out, model.Item{"error": lastErr.Error()})
-		} else {
-			out = append(out, model.Item{"response": respObj})
+			return nil, fmt.Errorf("%s %s: %w", method, url, lastErr)
 		}
+		out = append(out, model.Item{"response": respObj})
 	}
 	return out, nil
 }
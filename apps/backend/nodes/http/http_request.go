@@ -23,8 +23,9 @@ import (
 // - headers: map[string]string
 // - json_body: map[string]any (templated strings inside)
 // - multipart_file_field: string (e.g., "file"); if set, sends multipart/form-data
-// - file_bytes_field: string (default: "file_bytes")
-// - file_name_field: string (default: "file_name")
+// - file_bytes_field: string (default: "file_bytes"); bytes, a string or a binary reference
+// - file_ref_field: string (default: "file_ref") used when the bytes field is missing
+// - file_name_field: string (default: "file_name"); defaults to the reference's name
 // - timeout: number seconds (default 60)
 // - poll: { enabled: bool, url: string (template), interval_ms: int, max_attempts: int, done_expr: string(template on last body to "true"/"false") }
 type HttpRequest struct{ deps plugin.Deps }
@@ -63,6 +64,8 @@ func (n *HttpRequest) Process(ctx context.Context, wf model.Workflow, node model
     fileField, _ := node.Config["multipart_file_field"].(string)
     fileBytesField, _ := node.Config["file_bytes_field"].(string)
     if fileBytesField == "" { fileBytesField = "file_bytes" }
+    fileRefField, _ := node.Config["file_ref_field"].(string)
+    if fileRefField == "" { fileRefField = "file_ref" }
     fileNameField, _ := node.Config["file_name_field"].(string)
     if fileNameField == "" { fileNameField = "file_name" }
 
@@ -97,7 +100,15 @@ func (n *HttpRequest) Process(ctx context.Context, wf model.Workflow, node model
             mw := multipart.NewWriter(&b)
             // file part
             fname, _ := item[fileNameField].(string)
-            fbytes, _ := item[fileBytesField].([]byte)
+            fdata, ok := item[fileBytesField]
+            if !ok { fdata = item[fileRefField] }
+            var fbytes []byte
+            if fdata != nil {
+                refName, _, data, err := plugin.ReadBinary(ctx, n.deps.Files, wf.ID, fdata)
+                if err != nil { return nil, err }
+                fbytes = data
+                if fname == "" { fname = refName }
+            }
             if fname == "" { fname = "file.bin" }
             fw, err := mw.CreateFormFile(fileField, fname)
             if err != nil { return nil, err }
@@ -27,10 +27,11 @@ func (n *If) ProcessPorted(ctx context.Context, wf model.Workflow, node model.No
 
 	trueItems := model.Items{}
 	falseItems := model.Items{}
-	for _, it := range in {
+	for i, it := range in {
 		if it == nil {
 			it = model.Item{}
 		}
+		plugin.Pair(it, i)
 		var buf bytesBuffer
 		if err := tpl.Execute(&buf, it); err != nil {
 			return nil, err
@@ -44,10 +45,15 @@ func (n *If) ProcessPorted(ctx context.Context, wf model.Workflow, node model.No
 	return map[model.Port]model.Items{
 		model.Port("true"):  trueItems,
 		model.Port("false"): falseItems,
-		model.PortMain:      append(model.Items{}, in...),
+		model.PortMain:      append(model.Items{}, in...), // nil items stay unpaired and are matched by position
 	}, nil
 }
 
+// OutputPorts lists the ports ProcessPorted emits
+func (n *If) OutputPorts(node model.Node) []model.Port {
+	return []model.Port{model.Port("true"), model.Port("false"), model.PortMain}
+}
+
 // allow registration without explicit engine import
 func (n *If) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
 	return in, nil
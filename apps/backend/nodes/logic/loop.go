@@ -0,0 +1,116 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// defaultMaxIterations guards loops that don't set max_iterations
+const defaultMaxIterations = 100
+
+// Loop runs a body workflow repeatedly, feeding each iteration the items
+// the previous one returned. It stops when the body returns no items, when
+// the while template renders anything but "true" for the last returned
+// item, or fails after max_iterations.
+// Config:
+// - workflow: string (required) body workflow, as for exec:workflow
+// - entry, output: string (body entry and output nodes)
+// - while: string (Go template over the last returned item; default: loop while items are returned)
+// - max_iterations: number (default: 100)
+// - collect: "all" | "last" (default: "all") which iterations' items to output
+type Loop struct{ deps plugin.Deps }
+
+func (n *Loop) Init(ctx context.Context, deps plugin.Deps) error {
+	if deps.Workflows == nil {
+		return errors.New("logic:loop needs a workflow runner; run it through the API server or an instance")
+	}
+	n.deps = deps
+	return nil
+}
+
+func (n *Loop) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	body, err := bodyRun(node)
+	if err != nil {
+		return nil, err
+	}
+	var cond *template.Template
+	if expr, _ := node.Config["while"].(string); expr != "" {
+		if cond, err = template.New("while").Parse(expr); err != nil {
+			return nil, err
+		}
+	}
+	limit := intConfig(node.Config, "max_iterations", defaultMaxIterations)
+	collect, _ := node.Config["collect"].(string)
+	switch collect {
+	case "", "all", "last":
+	default:
+		return nil, fmt.Errorf("unknown collect %q: expected all or last", collect)
+	}
+
+	out := model.Items{}
+	items := in
+	for i := 0; ; i++ {
+		if i == limit {
+			return nil, fmt.Errorf("loop did not finish within max_iterations (%d)", limit)
+		}
+		body.Items = items
+		_, res, err := n.deps.Workflows.RunWorkflow(ctx, body)
+		if err != nil {
+			return nil, fmt.Errorf("iteration %d: %w", i, err)
+		}
+		// an empty result ends the loop and keeps the last items found
+		if collect == "last" && len(res) > 0 {
+			out = model.Items{}
+		}
+		out = append(out, res...)
+		if len(res) == 0 {
+			break
+		}
+		if cond != nil {
+			var buf bytesBuffer
+			if err := cond.Execute(&buf, res[len(res)-1]); err != nil {
+				return nil, err
+			}
+			if buf.String() != "true" {
+				break
+			}
+		}
+		items = res
+	}
+	return out, nil
+}
+
+// bodyRun reads the body workflow settings shared by the loop nodes
+func bodyRun(node model.Node) (plugin.WorkflowRun, error) {
+	ref, _ := node.Config["workflow"].(string)
+	if ref == "" {
+		return plugin.WorkflowRun{}, errors.New("workflow is required")
+	}
+	entry, _ := node.Config["entry"].(string)
+	output, _ := node.Config["output"].(string)
+	return plugin.WorkflowRun{
+		Ref:      ref,
+		Node:     node.ID,
+		Entry:    model.ID(entry),
+		Output:   model.ID(output),
+		MaxDepth: intConfig(node.Config, "max_depth", 0),
+	}, nil
+}
+
+func intConfig(config map[string]any, key string, def int) int {
+	switch v := config[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return def
+	}
+}
+
+func init() { plugin.Register("logic:loop", func() plugin.NodeHandler { return &Loop{} }) }
@@ -0,0 +1,86 @@
+package logic
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// pager serves three pages: each run returns the next page number
+type pager struct{ runs []model.Items }
+
+func (p *pager) RunWorkflow(_ context.Context, run plugin.WorkflowRun) (string, model.Items, error) {
+	p.runs = append(p.runs, run.Items)
+	page, _ := run.Items[0]["page"].(int)
+	return "child", model.Items{{"page": page + 1, "more": page+1 < 3}}, nil
+}
+
+func TestLoop(t *testing.T) {
+	p := &pager{}
+	n := &Loop{}
+	if err := n.Init(context.Background(), plugin.Deps{Workflows: p}); err != nil {
+		t.Fatal(err)
+	}
+	node := model.Node{ID: "pages", Config: map[string]any{"workflow": "page.json", "while": "{{.more}}"}}
+	out, err := n.Process(context.Background(), model.Workflow{}, node, model.Items{{"page": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.runs) != 3 || len(out) != 3 || out[2]["page"] != 3 {
+		t.Fatalf("expected 3 pages, got runs %v out %v", p.runs, out)
+	}
+
+	node.Config["while"] = "true"
+	node.Config["max_iterations"] = 5
+	if _, err := n.Process(context.Background(), model.Workflow{}, node, model.Items{{"page": 0}}); err == nil || !strings.Contains(err.Error(), "max_iterations") {
+		t.Fatalf("expected the iteration guard, got %v", err)
+	}
+}
+
+// countdown returns the next lower number until it reaches zero, then nothing
+type countdown struct{}
+
+func (countdown) RunWorkflow(_ context.Context, run plugin.WorkflowRun) (string, model.Items, error) {
+	n, _ := run.Items[0]["n"].(int)
+	if n <= 1 {
+		return "child", nil, nil
+	}
+	return "child", model.Items{{"n": n - 1}}, nil
+}
+
+func TestLoopCollectLast(t *testing.T) {
+	n := &Loop{}
+	if err := n.Init(context.Background(), plugin.Deps{Workflows: countdown{}}); err != nil {
+		t.Fatal(err)
+	}
+	node := model.Node{ID: "count", Config: map[string]any{"workflow": "count.json", "collect": "last"}}
+	out, err := n.Process(context.Background(), model.Workflow{}, node, model.Items{{"n": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the empty last iteration ends the loop; the one before it is output
+	if len(out) != 1 || out[0]["n"] != 1 {
+		t.Fatalf("expected the last non-empty iteration, got %v", out)
+	}
+
+	node.Config["collect"] = "first"
+	if _, err := n.Process(context.Background(), model.Workflow{}, node, model.Items{{"n": 3}}); err == nil {
+		t.Fatal("expected an unknown collect to be rejected")
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	n := &SplitBatches{}
+	in := model.Items{{"i": 0}, {"i": 1}, {"i": 2}, {"i": 3}, {"i": 4}}
+	node := model.Node{Config: map[string]any{"batch_size": 2}}
+	out, err := n.Process(context.Background(), model.Workflow{}, node, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 || len(out[2]["items"].(model.Items)) != 1 || out[0]["batches"] != 3 {
+		t.Fatalf("unexpected batches: %v", out)
+	}
+}
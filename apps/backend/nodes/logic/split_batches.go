@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// SplitBatches groups items into batches of batch_size. With a workflow it
+// runs that body once per batch, in order and pausing between batches, and
+// outputs what the runs returned; without one it outputs one item per
+// batch: {"items": [...], "batch": i, "batches": n}.
+// Config:
+// - batch_size: number (required)
+// - workflow, entry, output: string (optional body, as for exec:workflow)
+// - pause: string (Go duration between batches, e.g. "2s")
+type SplitBatches struct{ deps plugin.Deps }
+
+func (n *SplitBatches) Init(ctx context.Context, deps plugin.Deps) error { n.deps = deps; return nil }
+
+func (n *SplitBatches) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	size := intConfig(node.Config, "batch_size", 0)
+	if size <= 0 {
+		return nil, errors.New("batch_size must be positive")
+	}
+	var pause time.Duration
+	if s, _ := node.Config["pause"].(string); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("pause: %w", err)
+		}
+		pause = d
+	}
+	var batches []model.Items
+	for i := 0; i < len(in); i += size {
+		batches = append(batches, in[i:min(i+size, len(in))])
+	}
+
+	if _, ok := node.Config["workflow"]; !ok {
+		out := make(model.Items, 0, len(batches))
+		for i, b := range batches {
+			item := model.Item{"items": b, "batch": i, "batches": len(batches)}
+			out = append(out, plugin.Pair(item, span(i*size, len(b))...))
+		}
+		return out, nil
+	}
+	if n.deps.Workflows == nil {
+		return nil, errors.New("logic:split_batches with a workflow needs a workflow runner")
+	}
+	body, err := bodyRun(node)
+	if err != nil {
+		return nil, err
+	}
+	out := model.Items{}
+	for i, b := range batches {
+		if i > 0 && pause > 0 {
+			select {
+			case <-time.After(pause):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		body.Items = b
+		_, res, err := n.deps.Workflows.RunWorkflow(ctx, body)
+		if err != nil {
+			return nil, fmt.Errorf("batch %d: %w", i, err)
+		}
+		// results pair with their batch item by position when the body
+		// kept the count, otherwise with the whole batch
+		for j, it := range res {
+			if len(res) == len(b) {
+				plugin.Pair(it, i*size+j)
+			} else {
+				plugin.Pair(it, span(i*size, len(b))...)
+			}
+		}
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+// span lists n indexes starting at start
+func span(start, n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = start + i
+	}
+	return idx
+}
+
+func init() {
+	plugin.Register("logic:split_batches", func() plugin.NodeHandler { return &SplitBatches{} })
+}
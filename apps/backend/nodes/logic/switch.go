@@ -0,0 +1,262 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// Switch routes each item to the port of the first matching rule, or of
+// every matching rule in "all" mode; items no rule matches go to the
+// fallback port. Rule types are equals, contains, regex, numeric (op is
+// ==, !=, >, >=, < or <=), exists and template (value renders "true");
+// field is a dotted path into the item.
+// Config:
+// - rules: list of {port, type, field, op, value}, checked in order
+// - mode: "first" | "all" (default: "first")
+// - fallback: string (default: "fallback")
+type Switch struct{ deps plugin.Deps }
+
+type switchRule struct {
+	Port  string `json:"port"`
+	Type  string `json:"type"`
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+
+	re  *regexp.Regexp
+	tpl *template.Template
+}
+
+func (n *Switch) Init(ctx context.Context, deps plugin.Deps) error { n.deps = deps; return nil }
+
+func (n *Switch) ProcessPorted(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (map[model.Port]model.Items, error) {
+	rules, err := switchRules(node)
+	if err != nil {
+		return nil, err
+	}
+	all := node.Config["mode"] == "all"
+	fallback := fallbackPort(node)
+
+	out := map[model.Port]model.Items{}
+	for i, it := range in {
+		if it == nil {
+			it = model.Item{}
+		}
+		plugin.Pair(it, i)
+		sent := map[model.Port]bool{}
+		for _, r := range rules {
+			ok, err := r.match(it)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", r.Port, err)
+			}
+			if !ok {
+				continue
+			}
+			// a port takes an item once even if several of its rules match
+			if port := model.Port(r.Port); !sent[port] {
+				sent[port] = true
+				out[port] = append(out[port], it)
+			}
+			if !all {
+				break
+			}
+		}
+		if len(sent) == 0 {
+			out[fallback] = append(out[fallback], it)
+		}
+	}
+	return out, nil
+}
+
+// OutputPorts lists the rule ports in order, then the fallback port
+func (n *Switch) OutputPorts(node model.Node) []model.Port {
+	var ports []model.Port
+	seen := map[model.Port]bool{}
+	add := func(p model.Port) {
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	rules, _ := decodeRules(node.Config["rules"])
+	for _, r := range rules {
+		if r.Port != "" {
+			add(model.Port(r.Port))
+		}
+	}
+	add(fallbackPort(node))
+	return ports
+}
+
+func (n *Switch) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	return in, nil
+}
+
+func fallbackPort(node model.Node) model.Port {
+	if p, _ := node.Config["fallback"].(string); p != "" {
+		return model.Port(p)
+	}
+	return model.Port("fallback")
+}
+
+func decodeRules(v any) ([]*switchRule, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*switchRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	return rules, nil
+}
+
+// switchRules decodes and checks the rules, compiling regexes and templates
+func switchRules(node model.Node) ([]*switchRule, error) {
+	rules, err := decodeRules(node.Config["rules"])
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("rules are required")
+	}
+	for i, r := range rules {
+		if r.Port == "" {
+			return nil, fmt.Errorf("rule %d has no port", i)
+		}
+		switch r.Type {
+		case "equals", "contains", "exists":
+		case "numeric":
+			switch r.Op {
+			case "==", "!=", ">", ">=", "<", "<=":
+			default:
+				return nil, fmt.Errorf("rule %d: unknown numeric op %q", i, r.Op)
+			}
+		case "regex":
+			if r.re, err = regexp.Compile(fmt.Sprint(r.Value)); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+		case "template":
+			if r.tpl, err = template.New("rule").Parse(fmt.Sprint(r.Value)); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: unknown type %q", i, r.Type)
+		}
+	}
+	return rules, nil
+}
+
+func (r *switchRule) match(it model.Item) (bool, error) {
+	if r.Type == "template" {
+		var buf bytesBuffer
+		if err := r.tpl.Execute(&buf, it); err != nil {
+			return false, err
+		}
+		return strings.TrimSpace(buf.String()) == "true", nil
+	}
+	v, ok := lookup(it, r.Field)
+	if r.Type == "exists" {
+		return ok && v != nil, nil
+	}
+	if !ok {
+		return false, nil
+	}
+	switch r.Type {
+	case "equals":
+		return equalValues(v, r.Value), nil
+	case "contains":
+		if list, isList := v.([]any); isList {
+			for _, e := range list {
+				if equalValues(e, r.Value) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return strings.Contains(fmt.Sprint(v), fmt.Sprint(r.Value)), nil
+	case "regex":
+		return r.re.MatchString(fmt.Sprint(v)), nil
+	case "numeric":
+		a, okA := number(v)
+		b, okB := number(r.Value)
+		if !okA || !okB {
+			return false, nil
+		}
+		switch r.Op {
+		case "==":
+			return a == b, nil
+		case "!=":
+			return a != b, nil
+		case ">":
+			return a > b, nil
+		case ">=":
+			return a >= b, nil
+		case "<":
+			return a < b, nil
+		default:
+			return a <= b, nil
+		}
+	}
+	return false, nil
+}
+
+// lookup resolves a dotted path through nested maps
+func lookup(it model.Item, path string) (any, bool) {
+	var cur any = map[string]any(it)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			if item, isItem := cur.(model.Item); isItem {
+				m = item
+			} else {
+				return nil, false
+			}
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// equalValues compares numbers numerically and everything else by its
+// printed form, so 3 equals 3.0 and "3"
+func equalValues(a, b any) bool {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			return x == y
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func init() { plugin.Register("logic:switch", func() plugin.NodeHandler { return &Switch{} }) }
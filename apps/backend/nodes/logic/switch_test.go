@@ -0,0 +1,58 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+func TestSwitchRules(t *testing.T) {
+	rules := []any{
+		map[string]any{"port": "high", "type": "numeric", "field": "score", "op": ">=", "value": 80},
+		map[string]any{"port": "gold", "type": "equals", "field": "user.tier", "value": "gold"},
+		map[string]any{"port": "tagged", "type": "contains", "field": "tags", "value": "vip"},
+		map[string]any{"port": "sku", "type": "regex", "field": "sku", "value": `^A-\d+$`},
+		map[string]any{"port": "ided", "type": "exists", "field": "id"},
+		map[string]any{"port": "many", "type": "template", "value": `{{if gt .n 1.0}}true{{end}}`},
+	}
+	in := model.Items{
+		{"score": 95.0, "user": map[string]any{"tier": "gold"}, "n": 0.0},
+		{"score": "12", "tags": []any{"vip"}, "n": 0.0},
+		{"sku": "A-17", "n": 0.0},
+		{"id": nil, "n": 5.0},
+		{"n": 0.0},
+	}
+	node := model.Node{Config: map[string]any{"rules": rules}}
+	s := &Switch{}
+	out, err := s.ProcessPorted(context.Background(), model.Workflow{}, node, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for port, want := range map[model.Port]int{"high": 1, "gold": 0, "tagged": 1, "sku": 1, "ided": 0, "many": 1, "fallback": 1} {
+		if len(out[port]) != want {
+			t.Errorf("port %s: got %d items, want %d", port, len(out[port]), want)
+		}
+	}
+	if _, dup := out[model.PortMain]; dup {
+		t.Error("items must not be copied to main")
+	}
+
+	node.Config["mode"] = "all"
+	node.Config["fallback"] = "rest"
+	out, err = s.ProcessPorted(context.Background(), model.Workflow{}, node, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out["high"]) != 1 || len(out["gold"]) != 1 || len(out["rest"]) != 1 {
+		t.Fatalf("all mode: %v", out)
+	}
+	if got := s.OutputPorts(node); len(got) != 7 || got[6] != "rest" {
+		t.Fatalf("ports: %v", got)
+	}
+
+	node.Config["rules"] = []any{map[string]any{"port": "x", "type": "numeric", "op": "~"}}
+	if _, err := s.ProcessPorted(context.Background(), model.Workflow{}, node, in); err == nil {
+		t.Fatal("expected an unknown op to be rejected")
+	}
+}
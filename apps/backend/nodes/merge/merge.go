@@ -2,6 +2,8 @@ package merge
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/Tsinling0525/rivulet/model"
 	"github.com/Tsinling0525/rivulet/plugin"
@@ -17,3 +19,167 @@ func (n *Concat) Process(ctx context.Context, wf model.Workflow, node model.Node
 }
 
 func init() { plugin.Register("merge.concat", func() plugin.NodeHandler { return &Concat{} }) }
+
+// Merge combines the items on its input1 and input2 ports; direct inputs
+// and edges into main count as input1.
+// Config:
+// - mode: "append" | "zip" | "join" | "choose" (default: "append")
+// - key: string (join field present in both inputs), or key1 / key2 per input
+// - join: "inner" | "left" | "outer" (default: "inner")
+// - prefer: "input1" | "input2" (which value wins when zip or join merge a field both items have; default: "input2")
+// - include_unpaired: bool (zip: keep items without a partner; default: false)
+// - branch: "input1" | "input2" (choose: which input to output; default: "input1")
+type Merge struct{ deps plugin.Deps }
+
+const (
+	PortInput1 model.Port = "input1"
+	PortInput2 model.Port = "input2"
+)
+
+func (n *Merge) Init(ctx context.Context, deps plugin.Deps) error { n.deps = deps; return nil }
+
+func (n *Merge) ProcessInputs(ctx context.Context, wf model.Workflow, node model.Node, in map[model.Port]model.Items) (map[model.Port]model.Items, error) {
+	a := append(append(model.Items{}, in[model.PortMain]...), in[PortInput1]...)
+	b := in[PortInput2]
+	// inputs are numbered main, input1, input2, the order the engine
+	// tracks their lineage in
+	pairAll(a, 0)
+	pairAll(b, len(a))
+	preferFirst := node.Config["prefer"] == string(PortInput1)
+
+	var out model.Items
+	mode, _ := node.Config["mode"].(string)
+	switch mode {
+	case "", "append":
+		out = append(a, b...)
+	case "zip":
+		unpaired, _ := node.Config["include_unpaired"].(bool)
+		for i := 0; i < max(len(a), len(b)); i++ {
+			switch {
+			case i < len(a) && i < len(b):
+				out = append(out, combine(a[i], b[i], preferFirst))
+			case !unpaired:
+			case i < len(a):
+				out = append(out, a[i])
+			default:
+				out = append(out, b[i])
+			}
+		}
+	case "join":
+		var err error
+		if out, err = join(node, a, b, preferFirst); err != nil {
+			return nil, err
+		}
+	case "choose":
+		switch node.Config["branch"] {
+		case nil, string(PortInput1):
+			out = a
+		case string(PortInput2):
+			out = b
+		default:
+			return nil, fmt.Errorf("unknown branch %v", node.Config["branch"])
+		}
+	default:
+		return nil, fmt.Errorf("unknown merge mode %q", mode)
+	}
+	if out == nil {
+		out = model.Items{}
+	}
+	return map[model.Port]model.Items{model.PortMain: out}, nil
+}
+
+// InputPorts lists the ports Merge reads besides main
+func (n *Merge) InputPorts(node model.Node) []model.Port {
+	return []model.Port{PortInput1, PortInput2}
+}
+
+func (n *Merge) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	return in, nil
+}
+
+// join matches items by key; unmatched items are kept on the left side
+// for left joins and on both sides for outer joins
+func join(node model.Node, a, b model.Items, preferFirst bool) (model.Items, error) {
+	key, _ := node.Config["key"].(string)
+	key1, _ := node.Config["key1"].(string)
+	key2, _ := node.Config["key2"].(string)
+	if key1 == "" {
+		key1 = key
+	}
+	if key2 == "" {
+		key2 = key
+	}
+	if key1 == "" || key2 == "" {
+		return nil, errors.New("join needs key, or key1 and key2")
+	}
+	kind, _ := node.Config["join"].(string)
+	switch kind {
+	case "":
+		kind = "inner"
+	case "inner", "left", "outer":
+	default:
+		return nil, fmt.Errorf("unknown join %q", kind)
+	}
+
+	byKey := map[string][]int{}
+	for i, it := range b {
+		if v, ok := it[key2]; ok {
+			k := fmt.Sprint(v)
+			byKey[k] = append(byKey[k], i)
+		}
+	}
+	matched := make([]bool, len(b))
+	out := model.Items{}
+	for _, it := range a {
+		v, ok := it[key1]
+		idx := byKey[fmt.Sprint(v)]
+		if !ok || len(idx) == 0 {
+			if kind != "inner" {
+				out = append(out, it)
+			}
+			continue
+		}
+		for _, i := range idx {
+			matched[i] = true
+			out = append(out, combine(it, b[i], preferFirst))
+		}
+	}
+	if kind == "outer" {
+		for i, it := range b {
+			if !matched[i] {
+				out = append(out, it)
+			}
+		}
+	}
+	return out, nil
+}
+
+// pairAll pairs each item with its own index, starting at offset
+func pairAll(items model.Items, offset int) {
+	for i, it := range items {
+		if it == nil {
+			items[i] = model.Item{}
+		}
+		plugin.Pair(items[i], offset+i)
+	}
+}
+
+// combine merges the fields of two items into a new one, paired with both
+func combine(a, b model.Item, preferFirst bool) model.Item {
+	first, second := a, b
+	if preferFirst {
+		first, second = b, a
+	}
+	out := make(model.Item, len(a)+len(b))
+	for k, v := range first {
+		out[k] = v
+	}
+	for k, v := range second {
+		out[k] = v
+	}
+	pa, _ := a[plugin.PairedKey].([]int)
+	pb, _ := b[plugin.PairedKey].([]int)
+	return plugin.Pair(out, append(append([]int{}, pa...), pb...)...)
+}
+
+func init() { plugin.Register("merge", func() plugin.NodeHandler { return &Merge{} }) }
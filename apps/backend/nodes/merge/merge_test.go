@@ -0,0 +1,52 @@
+package merge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+func mergeWith(t *testing.T, config map[string]any) model.Items {
+	t.Helper()
+	in := map[model.Port]model.Items{
+		PortInput1: {{"id": 1.0, "name": "ada"}, {"id": 2.0, "name": "bob"}},
+		PortInput2: {{"id": 1.0, "plan": "pro"}, {"id": 3.0, "plan": "free"}},
+	}
+	out, err := (&Merge{}).ProcessInputs(context.Background(), model.Workflow{}, model.Node{Config: config}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out[model.PortMain]
+}
+
+func TestMergeModes(t *testing.T) {
+	if got := mergeWith(t, map[string]any{}); len(got) != 4 {
+		t.Fatalf("append: %v", got)
+	}
+	if got := mergeWith(t, map[string]any{"mode": "zip"}); len(got) != 2 || got[1]["name"] != "bob" || got[1]["plan"] != "free" {
+		t.Fatalf("zip: %v", got)
+	}
+	if got := mergeWith(t, map[string]any{"mode": "join", "key": "id"}); len(got) != 1 || got[0]["plan"] != "pro" {
+		t.Fatalf("inner join: %v", got)
+	}
+	if got := mergeWith(t, map[string]any{"mode": "join", "key": "id", "join": "left"}); len(got) != 2 || got[1]["plan"] != nil {
+		t.Fatalf("left join: %v", got)
+	}
+	if got := mergeWith(t, map[string]any{"mode": "join", "key": "id", "join": "outer"}); len(got) != 3 || got[2]["plan"] != "free" {
+		t.Fatalf("outer join: %v", got)
+	}
+	if got := mergeWith(t, map[string]any{"mode": "choose", "branch": "input2"}); len(got) != 2 || got[0]["plan"] != "pro" {
+		t.Fatalf("choose: %v", got)
+	}
+}
+
+func TestMergePairsWithBothInputs(t *testing.T) {
+	got := mergeWith(t, map[string]any{"mode": "zip"})
+	paired, _ := got[1][plugin.PairedKey].([]int)
+	// input2 items follow the two input1 items
+	if len(paired) != 2 || paired[0] != 1 || paired[1] != 3 {
+		t.Fatalf("zip pairs %v", got[1][plugin.PairedKey])
+	}
+}
@@ -21,7 +21,7 @@ import (
 // Config:
 // - script: string (required) absolute or relative path to the python script
 // - args: []string (optional) additional args passed before the input file path
-// - file_id_field: string (optional, default: "file_id") item field containing FileStore file ID
+// - file_id_field: string (optional, default: "file_id") item field containing a FileStore file ID or a binary reference
 // - output_field: string (optional, default: "latex") item field to write stdout
 // - python_bin: string (optional, default: "python3") interpreter to use
 type ScriptNode struct {
@@ -94,14 +94,20 @@ func (n *ScriptNode) Process(ctx context.Context, wf model.Workflow, node model.
 		if !ok {
 			return nil, fmt.Errorf("missing %s in item", fileIDField)
 		}
-		fileID, ok := rawID.(string)
-		if !ok || strings.TrimSpace(fileID) == "" {
-			return nil, fmt.Errorf("%s must be string", fileIDField)
+		// references must point into this workflow
+		ref, isRef := model.AsBinaryRef(rawID)
+		if !isRef {
+			fileID, ok := rawID.(string)
+			if !ok || strings.TrimSpace(fileID) == "" {
+				return nil, fmt.Errorf("%s must be a string or binary reference", fileIDField)
+			}
+			ref = model.BinaryRef{WorkflowID: wf.ID, FileID: fileID}
 		}
+		fileID := ref.FileID
 
-		name, _, content, err := n.deps.Files.Get(ctx, string(wf.ID), fileID)
+		name, _, content, err := plugin.ReadBinary(ctx, n.deps.Files, wf.ID, ref)
 		if err != nil {
-			return nil, fmt.Errorf("get file %s: %w", fileID, err)
+			return nil, err
 		}
 
 		// write temp input file preserving extension if any
@@ -0,0 +1,29 @@
+package trigger
+
+import (
+	"context"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// FSWatch starts a workflow for each file that appears or changes in a
+// directory. The instance imports the file into the workflow's files and
+// passes on {"file_id", "file_name", "path", "size", "media_type"}, so
+// files:load and python:script can use it directly.
+// Config (read by the instance running the watch):
+// - path: string (required; directory, relative to the working directory)
+// - pattern: string (glob on file names; default: "*")
+// - settle: string (Go duration a file must stay unchanged before import; default: 500ms)
+// - poll: bool (poll instead of using inotify; default: false)
+// - poll_interval: string (Go duration; default: 2s)
+// - include_existing: bool (import files already there on start; default: false)
+type FSWatch struct{}
+
+func (n *FSWatch) Init(ctx context.Context, deps plugin.Deps) error { return nil }
+
+func (n *FSWatch) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	return in, nil
+}
+
+func init() { plugin.Register("trigger:fs_watch", func() plugin.NodeHandler { return &FSWatch{} }) }
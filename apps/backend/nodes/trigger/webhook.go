@@ -0,0 +1,127 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Tsinling0525/rivulet/model"
+	"github.com/Tsinling0525/rivulet/plugin"
+)
+
+// Webhook starts a workflow for each request to /webhook/<path> on the API
+// server and passes the request item on:
+// {"method", "path", "params", "query", "headers", "body"}.
+// Config (read by the instance serving the route):
+// - path: string (required; segments like ":id" are parameters)
+// - method: string (default: POST)
+// - response_mode: string on_received | last_node | respond_node (default: on_received)
+// - response_timeout: string (Go duration; default: 30s)
+// - auth: object {type: none|header|basic|bearer, name, value, username, password, token}
+type Webhook struct{}
+
+func (n *Webhook) Init(ctx context.Context, deps plugin.Deps) error { return nil }
+
+func (n *Webhook) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	return in, nil
+}
+
+// Respond answers the webhook request that started the execution, when
+// its trigger uses response_mode respond_node, and passes items on. Only
+// the first response of an execution is sent.
+// Config:
+// - status: number (default: 200)
+// - headers: object
+// - respond_with: string first | items | field | none (default: first)
+// - field: string (first item's field to send; a binary reference sends the file)
+// - content_type: string (default: from the data)
+type Respond struct{ deps plugin.Deps }
+
+func (n *Respond) Init(ctx context.Context, deps plugin.Deps) error { n.deps = deps; return nil }
+
+func (n *Respond) Process(ctx context.Context, wf model.Workflow, node model.Node, in model.Items) (model.Items, error) {
+	if n.deps.Webhooks == nil {
+		return in, nil
+	}
+	resp := plugin.WebhookResponse{Status: http.StatusOK, Headers: map[string]string{}}
+	switch v := node.Config["status"].(type) {
+	case int:
+		resp.Status = v
+	case float64:
+		resp.Status = int(v)
+	}
+	if resp.Status < 100 || resp.Status > 599 {
+		return nil, fmt.Errorf("invalid status %d", resp.Status)
+	}
+	contentType := "application/json; charset=utf-8"
+	var err error
+	switch mode, _ := node.Config["respond_with"].(string); mode {
+	case "", "first":
+		var first model.Item
+		if len(in) > 0 {
+			first = in[0]
+		}
+		resp.Body, err = json.Marshal(first)
+	case "items":
+		if in == nil {
+			in = model.Items{}
+		}
+		resp.Body, err = json.Marshal(in)
+	case "field":
+		field, _ := node.Config["field"].(string)
+		if field == "" {
+			return nil, fmt.Errorf("field is required when respond_with is field")
+		}
+		var v any
+		if len(in) > 0 {
+			v = in[0][field]
+		}
+		contentType, resp.Body, err = n.fieldBody(ctx, wf.ID, v)
+	case "none":
+		contentType = ""
+	default:
+		return nil, fmt.Errorf("unknown respond_with %q", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ct, _ := node.Config["content_type"].(string); ct != "" {
+		contentType = ct
+	}
+	if contentType != "" {
+		resp.Headers["Content-Type"] = contentType
+	}
+	if headers, ok := node.Config["headers"].(map[string]any); ok {
+		for k, v := range headers {
+			resp.Headers[k] = fmt.Sprint(v)
+		}
+	}
+	if err := n.deps.Webhooks.RespondWebhook(ctx, resp); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// fieldBody encodes a field value: strings as text, binary references as
+// the file they point to and anything else as JSON
+func (n *Respond) fieldBody(ctx context.Context, workflowID model.ID, v any) (string, []byte, error) {
+	if s, ok := v.(string); ok {
+		return "text/plain; charset=utf-8", []byte(s), nil
+	}
+	if _, ok := model.AsBinaryRef(v); ok {
+		_, mediaType, contents, err := plugin.ReadBinary(ctx, n.deps.Files, workflowID, v)
+		if strings.TrimSpace(mediaType) == "" {
+			mediaType = "application/octet-stream"
+		}
+		return mediaType, contents, err
+	}
+	b, err := json.Marshal(v)
+	return "application/json; charset=utf-8", b, err
+}
+
+func init() {
+	plugin.Register("trigger:webhook", func() plugin.NodeHandler { return &Webhook{} })
+	plugin.Register("webhook:respond", func() plugin.NodeHandler { return &Respond{} })
+}
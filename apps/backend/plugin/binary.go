@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Tsinling0525/rivulet/model"
+)
+
+// ErrForeignBinary is returned for references to another workflow's files
+var ErrForeignBinary = errors.New("file belongs to another workflow")
+
+// StoreBinary puts contents in the FileStore and returns a reference to it
+func StoreBinary(ctx context.Context, files FileStore, workflowID model.ID, name string, contents []byte, mediaType string) (model.BinaryRef, error) {
+	if files == nil {
+		return model.BinaryRef{}, errors.New("files store not configured")
+	}
+	id, err := files.Put(ctx, string(workflowID), name, contents, mediaType)
+	if err != nil {
+		return model.BinaryRef{}, err
+	}
+	return model.BinaryRef{WorkflowID: workflowID, FileID: id, Name: name, MediaType: mediaType, Size: int64(len(contents))}, nil
+}
+
+// ReadBinary loads the contents of v: a BinaryRef (resolved through
+// files), inline bytes or a string. Name and media type are only known
+// for references. References are only resolved within workflowID, the
+// running workflow, since item data may carry any workflow ID.
+func ReadBinary(ctx context.Context, files FileStore, workflowID model.ID, v any) (name, mediaType string, contents []byte, err error) {
+	switch b := v.(type) {
+	case []byte:
+		return "", "", b, nil
+	case string:
+		return "", "", []byte(b), nil
+	}
+	ref, ok := model.AsBinaryRef(v)
+	if !ok {
+		return "", "", nil, fmt.Errorf("expected binary data, got %T", v)
+	}
+	if ref.WorkflowID != workflowID {
+		return "", "", nil, fmt.Errorf("file %s: %w", ref.FileID, ErrForeignBinary)
+	}
+	if files == nil {
+		return "", "", nil, errors.New("files store not configured")
+	}
+	name, mediaType, contents, err = files.Get(ctx, string(ref.WorkflowID), ref.FileID)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("file %s: %w", ref.FileID, err)
+	}
+	return name, mediaType, contents, nil
+}
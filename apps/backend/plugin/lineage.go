@@ -0,0 +1,16 @@
+package plugin
+
+import "github.com/Tsinling0525/rivulet/model"
+
+// PairedKey is the item field through which a node declares which of its
+// input items an output item was derived from. The engine removes it and
+// records the item's lineage instead.
+const PairedKey = "$paired"
+
+// Pair marks out as derived from the input items at the given indexes of
+// the batch the node was called with, and returns it. Nodes that emit one
+// item per input in order don't need to; that mapping is assumed.
+func Pair(out model.Item, inputs ...int) model.Item {
+	out[PairedKey] = append([]int(nil), inputs...)
+	return out
+}
@@ -7,9 +7,11 @@ import (
 )
 
 type Deps struct {
-	State StateStore
-	Bus   EventBus
-	Files FileStore
+	State     StateStore
+	Bus       EventBus
+	Files     FileStore
+	Workflows WorkflowRunner   // nil when nodes cannot start other workflows
+	Webhooks  WebhookResponder // nil when no webhook caller can be answered
 }
 
 type NodeHandler interface {
@@ -30,6 +32,50 @@ type EventBus interface {
 type FileStore interface {
 	Put(ctx context.Context, workflowID string, filename string, contents []byte, mediaType string) (fileID string, err error)
 	Get(ctx context.Context, workflowID string, fileID string) (filename string, mediaType string, contents []byte, err error)
+	// Stat returns a file's metadata without reading its contents
+	Stat(ctx context.Context, workflowID string, fileID string) (model.FileMeta, error)
 	List(ctx context.Context, workflowID string) ([]model.FileMeta, error)
 	Delete(ctx context.Context, workflowID string, fileID string) error
 }
+
+// WorkflowRunner runs another workflow as a child of the current execution
+type WorkflowRunner interface {
+	RunWorkflow(ctx context.Context, run WorkflowRun) (execID string, out model.Items, err error)
+}
+
+// WorkflowRun describes a child workflow execution: its items go to the
+// Entry node and the Output node's items are returned. Empty Entry and
+// Output select the workflow's only root and sink node.
+type WorkflowRun struct {
+	Ref      string // workflow file under the workflows dir, or stored workflow ID
+	Node     model.ID
+	Entry    model.ID
+	Output   model.ID
+	Items    model.Items
+	MaxDepth int // nesting limit, 0 for the default
+}
+
+// WebhookResponder answers the webhook request that started an execution
+type WebhookResponder interface {
+	RespondWebhook(ctx context.Context, resp WebhookResponse) error
+}
+
+// WebhookResponse is the HTTP response sent to a waiting webhook caller
+type WebhookResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
+
+type execIDKey struct{}
+
+// WithExecution returns ctx carrying the ID of the running execution
+func WithExecution(ctx context.Context, execID string) context.Context {
+	return context.WithValue(ctx, execIDKey{}, execID)
+}
+
+// ExecutionID returns the execution ID carried by ctx, or ""
+func ExecutionID(ctx context.Context) string {
+	id, _ := ctx.Value(execIDKey{}).(string)
+	return id
+}